@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/meesooqa/files2tg/app/config"
+)
+
+// Command is a subcommand of the CLI
+type Command struct {
+	Name  string
+	Usage string
+	// Run executes the command with the arguments following its name
+	Run func(env *Env, args []string) error
+}
+
+// Env is shared by the commands
+type Env struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	// ConfigPath is the value of the global --config flag
+	ConfigPath string
+}
+
+// Config loads the config file and validates the settings of the scope
+func (e *Env) Config(scope config.Scope) (*config.Config, error) {
+	return config.Load(e.ConfigPath, scope)
+}
+
+// flagSet returns a flag set printing errors and usage to Stderr
+func (e *Env) flagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.Stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.Stderr, "Usage: files2tg %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func commands() []Command {
+	return []Command{
+		{Name: "serve", Usage: "serve [--dry-run]", Run: serve},
+		{Name: "scan", Usage: "scan [--json]", Run: scan},
+		{Name: "send", Usage: "send [--dry-run] [--stars N] [--caption HTML] [--destination NAME] file...", Run: sendFiles},
+		{Name: "queue", Usage: "queue [--url URL] [--token TOKEN] list|retry ID|cancel ID", Run: queue},
+	}
+}
+
+// Run parses the arguments without the program name and executes the subcommand,
+// "serve" is the default one. It returns the exit code.
+func Run(args []string, stdout, stderr io.Writer) int {
+	env := &Env{Stdout: stdout, Stderr: stderr}
+
+	global := flag.NewFlagSet("files2tg", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.StringVar(&env.ConfigPath, "config", os.Getenv("CONFIG"), "path to the config file, "+config.DefaultPath+" by default")
+	global.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: files2tg [--config path] <command> [arguments]")
+		fmt.Fprintln(stderr, "\nCommands:")
+		for _, c := range commands() {
+			fmt.Fprintf(stderr, "  %s\n", c.Usage)
+		}
+		fmt.Fprintln(stderr, "\nFlags:")
+		global.PrintDefaults()
+	}
+	if err := global.Parse(args); err != nil {
+		return 2
+	}
+
+	args = global.Args()
+	name := "serve"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	for _, c := range commands() {
+		if c.Name != name {
+			continue
+		}
+		if err := c.Run(env, args); err != nil {
+			if err == flag.ErrHelp {
+				return 0
+			}
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "unknown command %q, expected one of: %s\n", name, strings.Join(commandNames(), ", "))
+	global.Usage()
+	return 2
+}
+
+func commandNames() []string {
+	var names []string
+	for _, c := range commands() {
+		names = append(names, c.Name)
+	}
+	return names
+}
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/send"
+)
+
+func newTestEnv(t *testing.T) (*Env, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	return &Env{Stdout: &stdout, Stderr: &stderr, ConfigPath: filepath.Join(t.TempDir(), "missing.yml")}, &stdout, &stderr
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := Run([]string{"unknown"}, &stdout, &stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), `unknown command "unknown"`)
+	assert.Contains(t, stderr.String(), "queue")
+}
+
+func TestRun_Help(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, Run([]string{"scan", "-h"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "Usage: files2tg scan")
+}
+
+func TestListenURL(t *testing.T) {
+	assert.Equal(t, "http://localhost:8080", listenURL(":8080"))
+	assert.Equal(t, "http://127.0.0.1:9000", listenURL("127.0.0.1:9000"))
+	assert.Equal(t, "http://localhost:80", listenURL("0.0.0.0:80"))
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", formatSize(512))
+	assert.Equal(t, "1.5 KiB", formatSize(1536))
+	assert.Equal(t, "2.0 MiB", formatSize(2<<20))
+}
+
+func TestFormatAudio(t *testing.T) {
+	assert.Equal(t, "-", formatAudio(nil))
+	assert.Equal(t, "aac/eng, ac3", formatAudio([]finder.AudioInfo{{Codec: "aac", Language: "eng"}, {Codec: "ac3"}}))
+}
+
+// fakeVIProvider treats every *.mp4 file as a video
+type fakeVIProvider struct{}
+
+func (fakeVIProvider) GetVideoInfo(path string) (*finder.VideoInfo, error) {
+	if filepath.Ext(path) != ".mp4" {
+		return nil, errors.New("not a video")
+	}
+	return &finder.VideoInfo{CodecType: "video", Width: 640, Height: 360, Duration: 5}, nil
+}
+
+// fakeClient records sent posts
+type fakeClient struct {
+	posts []send.Post
+}
+
+func (c *fakeClient) Send(post send.Post) error {
+	c.posts = append(c.posts, post)
+	return nil
+}
+
+func TestSendPaths(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "a.mp4")
+	notes := filepath.Join(dir, "notes.txt")
+	require.NoError(t, os.WriteFile(video, []byte("data"), 0o600))
+	require.NoError(t, os.WriteFile(notes, []byte("data"), 0o600))
+
+	env, stdout, stderr := newTestEnv(t)
+	client := &fakeClient{}
+	history, err := finder.NewHistory(filepath.Join(t.TempDir(), "history.json"))
+	require.NoError(t, err)
+	err = sendPaths(env, client, finder.NewProvider(fakeVIProvider{}), nil, history, []string{video, notes},
+		send.Post{Stars: 5, Caption: "hi", Destination: "@other"})
+	require.EqualError(t, err, "1 of 2 files failed")
+	require.Len(t, history.Records(), 1, "only the sent file is recorded")
+	assert.Equal(t, video, history.Records()[0].Path)
+
+	require.Len(t, client.posts, 1)
+	assert.Equal(t, "a.mp4", client.posts[0].File.Name)
+	assert.Equal(t, 5, client.posts[0].Stars)
+	assert.Equal(t, "hi", client.posts[0].Caption)
+	assert.Equal(t, "@other", client.posts[0].Destination)
+	assert.Contains(t, stdout.String(), "OK   "+video)
+	assert.Contains(t, stderr.String(), "FAIL "+notes)
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("sources:\n  - dir: "+dir+"\n"), 0o600))
+
+	env, stdout, _ := newTestEnv(t)
+	env.ConfigPath = cfgPath
+	require.NoError(t, scan(env, []string{"--json"}))
+	assert.JSONEq(t, "[]", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, scan(env, nil))
+	assert.Contains(t, stdout.String(), "PATH")
+}
+
+func TestScan_Skipped(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.mp4")
+	require.NoError(t, os.WriteFile(notes, []byte("not a video"), 0o600))
+	cfgPath := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(cfgPath, []byte("sources:\n  - dir: "+dir+"\nscan:\n  probe: native\n  cache: \"\"\n"), 0o600))
+
+	env, stdout, stderr := newTestEnv(t)
+	env.ConfigPath = cfgPath
+	require.NoError(t, scan(env, []string{"--json"}))
+	assert.JSONEq(t, "[]", stdout.String())
+	assert.Contains(t, stderr.String(), "Skipped 1 files:\n  "+notes+": ")
+}
+
+func TestPrintSkipped_Duplicates(t *testing.T) {
+	env, _, stderr := newTestEnv(t)
+	printSkipped(env, finder.ScanReport{
+		Skipped:    []finder.Skipped{{Path: "b.mp4", Reason: "duplicate of a.mp4"}},
+		Duplicates: []finder.Duplicates{{Hash: "fast:00", Paths: []string{"a.mp4", "b.mp4"}}},
+		Similar: []finder.Similar{
+			{Path: "c-720p.mp4", Of: "c.mp4", Similarity: 0.9},
+			{Path: "d.mp4", Of: "old/d.mp4", Similarity: 1, SentAt: time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)},
+		},
+	})
+	assert.Equal(t, "The same video in 2 files:\n  a.mp4\n  b.mp4\n"+
+		"c-720p.mp4 is 90% similar to c.mp4\n"+
+		"d.mp4 is 100% similar to old/d.mp4, sent 2025-03-01 18:00:00\n"+
+		"Skipped 1 files:\n  b.mp4: duplicate of a.mp4\n", stderr.String())
+}
+
+func TestQueue(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/jobs":
+			json.NewEncoder(w).Encode([]map[string]any{
+				{"id": "a.mp4-1", "status": "failed", "error": "boom", "stars": 10, "file": map[string]any{"path": "var/files/a.mp4"}},
+			})
+		case "POST /api/v1/jobs/a.mp4-1/retry":
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(map[string]any{"id": "a.mp4-1", "status": "queued"})
+		case "DELETE /api/v1/jobs/a.mp4-1":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]any{"error": map[string]any{"code": "not_found", "message": "job not found"}})
+		}
+	}))
+	defer ts.Close()
+
+	env, stdout, _ := newTestEnv(t)
+	flags := []string{"--url", ts.URL, "--token", "secret"}
+
+	require.NoError(t, queue(env, append(flags, "list")))
+	assert.Contains(t, stdout.String(), "a.mp4-1")
+	assert.Contains(t, stdout.String(), "var/files/a.mp4")
+	assert.Contains(t, stdout.String(), "boom")
+
+	stdout.Reset()
+	require.NoError(t, queue(env, append(flags, "retry", "a.mp4-1")))
+	assert.Equal(t, "a.mp4-1 is queued\n", stdout.String())
+
+	stdout.Reset()
+	require.NoError(t, queue(env, append(flags, "cancel", "a.mp4-1")))
+	assert.Equal(t, "a.mp4-1 is canceled\n", stdout.String())
+
+	err := queue(env, append(flags, "cancel", "unknown"))
+	assert.EqualError(t, err, "404 Not Found: job not found")
+
+	assert.Error(t, queue(env, append(flags, "retry")))
+	assert.Equal(t, []string{
+		"GET /api/v1/jobs", "POST /api/v1/jobs/a.mp4-1/retry", "DELETE /api/v1/jobs/a.mp4-1", "DELETE /api/v1/jobs/unknown",
+	}, requests)
+}
+
+func TestSendPaths_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	video := filepath.Join(dir, "a.mp4")
+	require.NoError(t, os.WriteFile(video, []byte("data"), 0o600))
+
+	env, stdout, _ := newTestEnv(t)
+	client := &send.DryRunClient{Opts: &send.Options{Channel: "@main"}}
+	require.NoError(t, sendPaths(env, client, finder.NewProvider(fakeVIProvider{}), nil, nil, []string{video}, send.Post{Caption: "<b>A</b>\nline"}))
+	printPreviews(env, client.Previews())
+
+	out := stdout.String()
+	assert.Contains(t, out, "chat:       @main")
+	assert.Contains(t, out, "stars:      free")
+	assert.Contains(t, out, "video:      640x360, 5s, streaming: true, 4 B")
+	assert.Contains(t, out, "thumbnail:  none")
+	assert.Contains(t, out, "caption:\n    <b>A</b>\n    line")
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"text/tabwriter"
+	"time"
+)
+
+// queue manages the jobs of a running instance with the API
+func queue(env *Env, args []string) error {
+	usage := "queue [--url URL] [--token TOKEN] list|retry ID|cancel ID"
+	fs := env.flagSet("queue", usage)
+	baseURL := fs.String("url", "", "URL of the running instance, derived from web.listen by default")
+	token := fs.String("token", "", "API bearer token, auth.api_token by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("action is required")
+	}
+
+	if *baseURL == "" || *token == "" {
+		// only web.listen and auth.api_token are read, so nothing is validated
+		cfg, err := env.Config(0)
+		if err != nil {
+			return err
+		}
+		if *baseURL == "" {
+			*baseURL = listenURL(cfg.Web.Listen)
+		}
+		if *token == "" {
+			*token = cfg.Auth.APIToken
+		}
+	}
+	c := &apiClient{baseURL: *baseURL, token: *token, http: &http.Client{Timeout: 30 * time.Second}}
+
+	action, rest := fs.Arg(0), fs.Args()[1:]
+	switch {
+	case action == "list" && len(rest) == 0:
+		var jobs []apiJob
+		if err := c.do(http.MethodGet, "/api/v1/jobs", &jobs); err != nil {
+			return err
+		}
+		return printJobs(env, jobs)
+	case action == "retry" && len(rest) == 1:
+		var j apiJob
+		if err := c.do(http.MethodPost, "/api/v1/jobs/"+url.PathEscape(rest[0])+"/retry", &j); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "%s is %s\n", j.ID, j.Status)
+		return nil
+	case action == "cancel" && len(rest) == 1:
+		if err := c.do(http.MethodDelete, "/api/v1/jobs/"+url.PathEscape(rest[0]), nil); err != nil {
+			return err
+		}
+		fmt.Fprintf(env.Stdout, "%s is canceled\n", rest[0])
+		return nil
+	}
+	fs.Usage()
+	return fmt.Errorf("invalid action %q", action)
+}
+
+// listenURL returns URL of the local server listening on addr
+func listenURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// apiJob is the job as returned by the API
+type apiJob struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Stars  int    `json:"stars"`
+	File   *struct {
+		Path string `json:"path"`
+	} `json:"file"`
+}
+
+type apiClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// do calls the API and decodes the response into out if it is not nil
+func (c *apiClient) do(method, path string, out any) error {
+	req, err := http.NewRequest(method, c.baseURL+path, http.NoBody)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var apiErr struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Error.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func printJobs(env *Env, jobs []apiJob) error {
+	w := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tSTARS\tPATH\tERROR")
+	for _, j := range jobs {
+		path := ""
+		if j.File != nil {
+			path = j.File.Path
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", j.ID, j.Status, j.Stars, path, j.Error)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/meesooqa/files2tg/app/config"
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// scan prints the files which would be sent by Run
+func scan(env *Env, args []string) error {
+	fs := env.flagSet("scan", "scan [--json]")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := env.Config(config.ScopeSources | config.ScopeScan)
+	if err != nil {
+		return err
+	}
+
+	history, err := cfg.History()
+	if err != nil {
+		return err
+	}
+	scanner := &finder.Scanner{
+		Provider:      cfg.FilesProvider(),
+		Dirs:          cfg.SourceDirs(),
+		Manifests:     cfg.Manifests(),
+		Remotes:       cfg.Remotes(),
+		Archives:      cfg.Archives(),
+		Deduplicator:  cfg.Deduplicator(),
+		SimilarFinder: cfg.SimilarFinder(history),
+	}
+	files, report, err := scanner.Scan()
+	if err != nil {
+		return err
+	}
+	// the skipped files go to stderr to keep the output parsable
+	printSkipped(env, report)
+
+	if *asJSON {
+		enc := json.NewEncoder(env.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(files)
+	}
+	return printFiles(env, files)
+}
+
+// printSkipped lists the skipped files with the output of the probe, the copies of the same video
+// and the near-duplicates
+func printSkipped(env *Env, report finder.ScanReport) {
+	for _, group := range report.Duplicates {
+		fmt.Fprintf(env.Stderr, "The same video in %d files:\n", len(group.Paths))
+		for _, path := range group.Paths {
+			fmt.Fprintf(env.Stderr, "  %s\n", path)
+		}
+	}
+	for _, similar := range report.Similar {
+		sent := ""
+		if !similar.SentAt.IsZero() {
+			sent = ", sent " + similar.SentAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(env.Stderr, "%s is %.0f%% similar to %s%s\n", similar.Path, similar.Similarity*100, similar.Of, sent)
+	}
+	if len(report.Skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(env.Stderr, "Skipped %d files:\n", len(report.Skipped))
+	for _, skipped := range report.Skipped {
+		fmt.Fprintf(env.Stderr, "  %s: %s\n", skipped.Path, skipped.Reason)
+		for _, line := range strings.Split(skipped.Stderr, "\n") {
+			if line != "" {
+				fmt.Fprintf(env.Stderr, "    %s\n", line)
+			}
+		}
+	}
+}
+
+func printFiles(env *Env, files []finder.File) error {
+	w := tabwriter.NewWriter(env.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tPATH\tDURATION\tRESOLUTION\tCODEC\tAUDIO\tSIZE\tMODIFIED")
+	for i, file := range files {
+		// the pending files of the remote sources are probed when they are downloaded
+		duration, resolution, codec, audio := "-", "-", "-", "-"
+		if file.Info != nil {
+			duration = (time.Duration(file.Info.Duration) * time.Second).String()
+			resolution = fmt.Sprintf("%dx%d", file.Info.Width, file.Info.Height)
+			codec, audio = orDash(file.Info.Codec), formatAudio(file.Info.Audio)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1,
+			file.Path,
+			duration,
+			resolution,
+			codec,
+			audio,
+			formatSize(file.Size),
+			file.ModTime.Format(time.DateTime),
+		)
+	}
+	return w.Flush()
+}
+
+// formatAudio returns the codecs and languages of the audio streams, e.g. "aac/eng, ac3"
+func formatAudio(audio []finder.AudioInfo) string {
+	list := make([]string, 0, len(audio))
+	for _, a := range audio {
+		if a.Language != "" {
+			list = append(list, a.Codec+"/"+a.Language)
+			continue
+		}
+		list = append(list, a.Codec)
+	}
+	return orDash(strings.Join(list, ", "))
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// formatSize returns human-readable size
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
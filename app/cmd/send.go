@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/meesooqa/files2tg/app/config"
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/process"
+	"github.com/meesooqa/files2tg/app/send"
+)
+
+// sendFiles uploads the files one by one without the server
+func sendFiles(env *Env, args []string) error {
+	fs := env.flagSet("send", "send [--dry-run] [--stars N] [--caption HTML] [--destination NAME] file...")
+	dryRun := fs.Bool("dry-run", false, "print what would be sent without contacting Telegram")
+	stars := fs.Int("stars", 0, "price in Telegram Stars, 0 sends a free video")
+	caption := fs.String("caption", "", "caption instead of the formatted one")
+	destination := fs.String("destination", "", "destination name or chat ID instead of the default one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no files to send")
+	}
+	if *stars < 0 {
+		return errors.New("stars must not be negative")
+	}
+
+	cfg, err := env.Config(config.ScopeScan | config.ScopeSend)
+	if err != nil {
+		return err
+	}
+	sendOpts := cfg.SendOptions()
+	sendOpts.DryRun = sendOpts.DryRun || *dryRun
+	client, err := send.NewClient(sendOpts)
+	if err != nil {
+		return err
+	}
+	var history *finder.History
+	if !sendOpts.DryRun {
+		if history, err = cfg.History(); err != nil {
+			return err
+		}
+	}
+	err = sendPaths(env, client, cfg.FilesProvider(), cfg.Pipeline(), history, fs.Args(), send.Post{
+		Stars:       *stars,
+		Caption:     *caption,
+		Destination: *destination,
+	})
+	if previewer, ok := client.(send.Previewer); ok {
+		printPreviews(env, previewer.Previews())
+	}
+	return err
+}
+
+// sendPaths processes and sends every path with the options of the template post and reports the failed ones,
+// the sent files are recorded in the history unless it is nil
+func sendPaths(env *Env, client send.Client, filesProvider *finder.Provider, pipeline *process.Pipeline,
+	history *finder.History, paths []string, template send.Post) error {
+	failed := 0
+	for _, path := range paths {
+		file, err := filesProvider.GetFile(path)
+		if err == nil {
+			post := template
+			if post.File, err = pipeline.Process(file, post.Destination, nil); err == nil {
+				err = client.Send(post)
+			}
+		}
+		if err != nil {
+			failed++
+			fmt.Fprintf(env.Stderr, "FAIL %s: %v\n", path, err)
+			continue
+		}
+		fmt.Fprintf(env.Stdout, "OK   %s\n", path)
+		if history != nil {
+			if err = history.Add(file, time.Now()); err != nil {
+				log.Printf("[WARN] can't record %s in the history: %v", path, err)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed", failed, len(paths))
+	}
+	return nil
+}
+
+// printPreviews prints the posts recorded in the dry run
+func printPreviews(env *Env, previews []send.Preview) {
+	for _, p := range previews {
+		fmt.Fprintf(env.Stdout, "\n%s\n", p.Path)
+		fmt.Fprintf(env.Stdout, "  chat:       %s\n", p.Chat)
+		if p.Stars > 0 {
+			fmt.Fprintf(env.Stdout, "  stars:      %d\n", p.Stars)
+		} else {
+			fmt.Fprintln(env.Stdout, "  stars:      free")
+		}
+		fmt.Fprintf(env.Stdout, "  video:      %dx%d, %ds, streaming: %t, %s\n", p.Width, p.Height, p.Duration, p.Streaming, formatSize(p.Size))
+		if p.Fallback != "" {
+			fmt.Fprintf(env.Stdout, "  too large:  fallback %s\n", p.Fallback)
+		}
+		if len(p.Processed) > 0 {
+			fmt.Fprintf(env.Stdout, "  processed:  %s\n", strings.Join(p.Processed, ", "))
+		}
+		if len(p.Thumbnail) > 0 {
+			fmt.Fprintf(env.Stdout, "  thumbnail:  %s\n", formatSize(int64(len(p.Thumbnail))))
+		} else {
+			fmt.Fprintln(env.Stdout, "  thumbnail:  none")
+		}
+		fmt.Fprintf(env.Stdout, "  parse mode: %s\n", p.ParseMode)
+		fmt.Fprintf(env.Stdout, "  caption:\n    %s\n", strings.ReplaceAll(p.Caption, "\n", "\n    "))
+		if p.Overflow != "" {
+			fmt.Fprintf(env.Stdout, "  reply:\n    %s\n", strings.ReplaceAll(p.Overflow, "\n", "\n    "))
+		}
+	}
+}
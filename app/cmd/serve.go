@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/meesooqa/files2tg/app/config"
+	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/web"
+	"github.com/meesooqa/files2tg/app/web/auth"
+)
+
+// serve starts the workers and the web server
+func serve(env *Env, args []string) error {
+	fs := env.flagSet("serve", "serve [--dry-run]")
+	dryRun := fs.Bool("dry-run", false, "record the posts instead of sending them, see /dry-run")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("serve takes no arguments")
+	}
+
+	cfg, err := env.Config(config.ScopeAll)
+	if err != nil {
+		return err
+	}
+
+	sendOpts := cfg.SendOptions()
+	sendOpts.DryRun = sendOpts.DryRun || *dryRun
+	if !sendOpts.DryRun && sendOpts.Token == "" {
+		log.Printf("[WARN] telegram token is not set, jobs will fail, use --dry-run to preview them")
+	}
+	tgClient, err := send.NewClient(sendOpts)
+	if err != nil {
+		return err
+	}
+
+	history, err := cfg.History()
+	if err != nil {
+		return err
+	}
+
+	jq := job.NewJobQueue()
+	// Start workers
+	for i := 1; i <= cfg.Workers; i++ {
+		go job.Worker(i, jq)
+	}
+	server := web.NewServer(jq, tgClient)
+	server.AssetsDir = cfg.Web.AssetsDir
+	server.FilesDirs = cfg.SourceDirs()
+	server.Manifests = cfg.Manifests()
+	server.Remotes = cfg.Remotes()
+	server.Archives = cfg.Archives()
+	server.Deduplicator = cfg.Deduplicator()
+	server.SimilarFinder = cfg.SimilarFinder(history)
+	server.Pipeline = cfg.Pipeline()
+	server.Stars = cfg.Stars
+	server.VideoInfoProvider = cfg.VideoInfoProvider()
+	server.ScanWorkers = cfg.Scan.Workers
+	server.Sorters = cfg.Sorters()
+	// the dry run sends nothing, so the history is only compared with
+	if !sendOpts.DryRun {
+		server.History = history
+	}
+	if authOpts := cfg.AuthOptions(); authOpts.Enabled() {
+		if server.Auth, err = auth.New(authOpts); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("[WARN] no credentials configured, the control panel is open to everyone")
+	}
+	server.Run(context.Background(), cfg.Web.Listen)
+	return nil
+}
@@ -0,0 +1,651 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/finder/storage"
+	"github.com/meesooqa/files2tg/app/process"
+	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/web/auth"
+)
+
+// DefaultPath is used when the path of the config file is not set
+const DefaultPath = "config.yml"
+
+// DefaultSourceDir is the source of the videos when the config has no sources, it may be missing
+const DefaultSourceDir = "var/files"
+
+// Config is the structure of the config file
+type Config struct {
+	Sources      []Source      `yaml:"sources"`
+	Destinations []Destination `yaml:"destinations"`
+	Telegram     Telegram      `yaml:"telegram"`
+	Formatter    Formatter     `yaml:"formatter"`
+	Scan         Scan          `yaml:"scan"`
+	Process      Process       `yaml:"process"`
+	Pricing      Pricing       `yaml:"pricing"`
+	Workers      int           `yaml:"workers"`
+	Web          Web           `yaml:"web"`
+	Auth         Auth          `yaml:"auth"`
+}
+
+// Source is a directory with the videos, a manifest listing them, archives or a remote storage
+type Source struct {
+	Dir string `yaml:"dir"`
+	// Manifest is an M3U, CSV or JSON lines file with the videos in the order of sending, instead of Dir
+	Manifest string `yaml:"manifest"`
+	// Archive is the path or the glob of the ZIP and TAR archives with the videos, instead of Dir
+	Archive string `yaml:"archive"`
+	// Album sends the videos of each archive together
+	Album bool `yaml:"album"`
+
+	// Name of a remote source or archives names its directory in Scan.WorkDir
+	Name   string  `yaml:"name"`
+	S3     *S3     `yaml:"s3"`
+	SFTP   *SFTP   `yaml:"sftp"`
+	WebDAV *WebDAV `yaml:"webdav"`
+	// AfterSend is done with a sent file of a remote source: keep, delete or move to MoveTo
+	AfterSend string `yaml:"after_send"`
+	MoveTo    string `yaml:"move_to"`
+
+	// Sort is the order of sending: mtime, name, created, size, duration, random or playlist
+	Sort string `yaml:"sort"`
+	// Seed of the random order, zero shuffles the files on every scan
+	Seed int64 `yaml:"seed"`
+	// Playlist is the file with the order of the playlist sort, relative to Dir
+	Playlist string `yaml:"playlist"`
+}
+
+// S3 is a bucket of an S3-compatible storage
+type S3 struct {
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Prefix    string `yaml:"prefix"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	Region    string `yaml:"region"`
+	// Insecure uses plain HTTP
+	Insecure bool `yaml:"insecure"`
+}
+
+// SFTP is a directory on an SFTP server
+type SFTP struct {
+	Addr     string `yaml:"addr"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	KeyFile  string `yaml:"key_file"`
+	// KnownHosts is required unless InsecureHostKey skips the check of the host key
+	KnownHosts      string `yaml:"known_hosts"`
+	InsecureHostKey bool   `yaml:"insecure_host_key"`
+	Dir             string `yaml:"dir"`
+}
+
+// WebDAV is a directory on a WebDAV server
+type WebDAV struct {
+	URL      string `yaml:"url"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+}
+
+// remoteTimeout limits the connections to the remote sources
+const remoteTimeout = time.Minute
+
+// Remote returns the storage of a remote source, nil if the source is local
+func (s Source) Remote() (finder.Source, error) {
+	switch {
+	case s.S3 != nil:
+		return storage.NewS3(storage.S3Options{
+			Endpoint:  s.S3.Endpoint,
+			Bucket:    s.S3.Bucket,
+			Prefix:    s.S3.Prefix,
+			AccessKey: s.S3.AccessKey,
+			SecretKey: s.S3.SecretKey,
+			Region:    s.S3.Region,
+			Insecure:  s.S3.Insecure,
+		})
+	case s.SFTP != nil:
+		dial, err := storage.DialSFTP(storage.SFTPOptions{
+			Addr:            s.SFTP.Addr,
+			User:            s.SFTP.User,
+			Password:        s.SFTP.Password,
+			KeyFile:         s.SFTP.KeyFile,
+			KnownHosts:      s.SFTP.KnownHosts,
+			InsecureHostKey: s.SFTP.InsecureHostKey,
+			Timeout:         remoteTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return storage.NewSFTP(dial, s.SFTP.Dir), nil
+	case s.WebDAV != nil:
+		return storage.NewWebDAV(storage.WebDAVOptions{
+			URL:      s.WebDAV.URL,
+			User:     s.WebDAV.User,
+			Password: s.WebDAV.Password,
+			Timeout:  remoteTimeout,
+		}), nil
+	}
+	return nil, nil
+}
+
+// Sorter returns the sorter of the files of the source
+func (s Source) Sorter() (finder.Sorter, error) {
+	playlist := s.Playlist
+	if playlist != "" && !filepath.IsAbs(playlist) {
+		playlist = filepath.Join(s.Dir, playlist)
+	}
+	return finder.NewSorter(s.Sort, s.Seed, playlist)
+}
+
+// Destination is a named chat, the first one is the default
+type Destination struct {
+	Name string `yaml:"name"`
+	Chat string `yaml:"chat"`
+	// ParseMode and Caption override the formatter for the destination
+	ParseMode string `yaml:"parse_mode"`
+	Caption   string `yaml:"caption"`
+	// Watermark is overlaid on the videos sent to the destination
+	Watermark *Watermark `yaml:"watermark"`
+}
+
+// Watermark is a PNG image or a text, e.g. the channel name, overlaid on the videos with ffmpeg
+type Watermark struct {
+	Image string `yaml:"image"`
+	Text  string `yaml:"text"`
+	// Position is a corner: top_left, top_right, bottom_left or bottom_right (default)
+	Position string  `yaml:"position"`
+	Opacity  float64 `yaml:"opacity"`
+	FontSize int     `yaml:"font_size"`
+	Font     string  `yaml:"font"`
+}
+
+func (w *Watermark) options() *process.Watermark {
+	if w == nil {
+		return nil
+	}
+	return &process.Watermark{Image: w.Image, Text: w.Text, Position: w.Position, Opacity: w.Opacity, FontSize: w.FontSize, Font: w.Font}
+}
+
+type Telegram struct {
+	Token   string        `yaml:"token"`
+	Server  string        `yaml:"server"`
+	Timeout time.Duration `yaml:"timeout"`
+	// DryRun records what would be sent instead of sending it
+	DryRun bool `yaml:"dry_run"`
+	// MaxUploadSize is the upload limit, 0 is the limit of the server, negative disables the check
+	MaxUploadSize ByteSize `yaml:"max_upload_size"`
+	// Fallback for the files exceeding the limit: fail, text, compress, split or link
+	Fallback string `yaml:"fallback"`
+	// LinkURL is the base URL of the files for the link fallback
+	LinkURL string `yaml:"link_url"`
+}
+
+type Formatter struct {
+	// Caption is a text/template of the caption, see send.CaptionData
+	Caption string `yaml:"caption"`
+	// Overflow of a caption longer than 1024 characters: truncate or reply
+	Overflow string `yaml:"overflow"`
+	// ParseMode of the caption: HTML or MarkdownV2
+	ParseMode string `yaml:"parse_mode"`
+}
+
+type Scan struct {
+	// Probe reads the video info: ffprobe, native (MP4/MOV only, no external tools)
+	// or auto (ffprobe with the native reader as the fallback)
+	Probe string `yaml:"probe"`
+	// Cache is the file keeping the video info between the runs, empty disables it
+	Cache string `yaml:"cache"`
+	// Workers is the number of files probed at once
+	Workers int `yaml:"workers"`
+	// WorkDir keeps the files downloaded from the remote sources and extracted from the archives
+	WorkDir string `yaml:"work_dir"`
+	// Duplicates is done with the copies of the same video: off, warn, keep_first or skip
+	Duplicates string `yaml:"duplicates"`
+	// Hash finds the copies: fast (size, head and tail) or sha256 (the whole file)
+	Hash string `yaml:"hash"`
+	// History is the file with the sent videos, empty disables it
+	History string `yaml:"history"`
+	// Similarity flags the re-encoded and trimmed copies of a video: the least share of the similar frames,
+	// from 0 to 1, 0 disables the fingerprints
+	Similarity float64 `yaml:"similarity"`
+}
+
+// Process is the pipeline processing the videos before they are sent, e.g. with the watermarks
+type Process struct {
+	// WorkDir keeps the outputs of the steps until the input or the settings of a step change
+	WorkDir string `yaml:"work_dir"`
+	// MaxAge removes the outputs unused for longer, 0 keeps them
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+type Pricing struct {
+	// Stars is the price of a paid video
+	Stars int `yaml:"stars"`
+	// FreeEvery sends every N-th video for free starting from the first one, 0 makes all videos paid
+	FreeEvery int `yaml:"free_every"`
+}
+
+type Web struct {
+	Listen string `yaml:"listen"`
+	// AssetsDir overrides the embedded templates and static files
+	AssetsDir string `yaml:"assets_dir"`
+}
+
+type Auth struct {
+	APIToken string `yaml:"api_token"`
+	// Users maps user names to bcrypt hashes of their passwords
+	Users         map[string]string `yaml:"users"`
+	Mode          string            `yaml:"mode"`
+	SessionSecret string            `yaml:"session_secret"`
+	SessionTTL    time.Duration     `yaml:"session_ttl"`
+	TelegramLogin TelegramLogin     `yaml:"telegram_login"`
+	// HTTPSProxy is set when a proxy serves the control panel over HTTPS
+	HTTPSProxy bool `yaml:"https_proxy"`
+}
+
+type TelegramLogin struct {
+	Bot   string  `yaml:"bot"`
+	Users []int64 `yaml:"users"`
+}
+
+// Default returns the config used when there is no config file
+func Default() *Config {
+	return &Config{
+		Sources:  []Source{{Dir: DefaultSourceDir}},
+		Telegram: Telegram{Timeout: time.Minute},
+		Scan:     Scan{Probe: ProbeAuto, Cache: "var/cache/probe.json", Workers: 4, WorkDir: "var/work", Duplicates: DuplicatesOff, Hash: finder.HashFast, History: "var/history.json"},
+		Process:  Process{WorkDir: "var/cache/process", MaxAge: 7 * 24 * time.Hour},
+		Pricing:  Pricing{Stars: 10, FreeEvery: 10},
+		Workers:  1,
+		Web:      Web{Listen: ":8080"},
+		Auth:     Auth{SessionTTL: 24 * time.Hour},
+	}
+}
+
+// Load reads the config file over the defaults, applies env overrides and validates the settings of the scope.
+// A missing file at DefaultPath is not an error, so the app can be configured with env only.
+func Load(path string, scope Scope) (*Config, error) {
+	cfg := Default()
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("parse %s: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+		// env only
+	default:
+		return nil, fmt.Errorf("read config: %w", err)
+	}
+
+	if err = cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err = cfg.Validate(scope); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the config with the environment variables
+func (c *Config) applyEnv() error {
+	var problems []string
+	setString := func(name string, target *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*target = v
+		}
+	}
+	setDuration := func(name string, target *time.Duration) {
+		if v, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %q is not a duration like 90s, 5m or 24h", name, v))
+			}
+			*target = d
+		}
+	}
+
+	setString("TELEGRAM_TOKEN", &c.Telegram.Token)
+	setString("TELEGRAM_SERVER", &c.Telegram.Server)
+	setDuration("TELEGRAM_TIMEOUT", &c.Telegram.Timeout)
+	if v, ok := os.LookupEnv("TELEGRAM_DRY_RUN"); ok {
+		dryRun, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TELEGRAM_DRY_RUN: %q is not a boolean", v))
+		}
+		c.Telegram.DryRun = dryRun
+	}
+	if v, ok := os.LookupEnv("TELEGRAM_MAX_UPLOAD_SIZE"); ok {
+		size, err := ParseByteSize(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("TELEGRAM_MAX_UPLOAD_SIZE: %v", err))
+		}
+		c.Telegram.MaxUploadSize = size
+	}
+	setString("TELEGRAM_FALLBACK", &c.Telegram.Fallback)
+	setString("TELEGRAM_LINK_URL", &c.Telegram.LinkURL)
+	if v, ok := os.LookupEnv("TELEGRAM_CHAN"); ok {
+		if len(c.Destinations) == 0 {
+			c.Destinations = []Destination{{Name: "default"}}
+		}
+		c.Destinations[0].Chat = v
+	}
+
+	setString("SCAN_PROBE", &c.Scan.Probe)
+	setString("SCAN_CACHE", &c.Scan.Cache)
+	setString("SCAN_WORK_DIR", &c.Scan.WorkDir)
+	setString("SCAN_DUPLICATES", &c.Scan.Duplicates)
+	setString("SCAN_HASH", &c.Scan.Hash)
+	setString("PROCESS_WORK_DIR", &c.Process.WorkDir)
+	setDuration("PROCESS_MAX_AGE", &c.Process.MaxAge)
+	if v, ok := os.LookupEnv("SCAN_WORKERS"); ok {
+		workers, err := strconv.Atoi(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("SCAN_WORKERS: %q is not a number", v))
+		}
+		c.Scan.Workers = workers
+	}
+	setString("SCAN_HISTORY", &c.Scan.History)
+	if v, ok := os.LookupEnv("SCAN_SIMILARITY"); ok {
+		similarity, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("SCAN_SIMILARITY: %q is not a number", v))
+		}
+		c.Scan.Similarity = similarity
+	}
+
+	setString("WEB_LISTEN", &c.Web.Listen)
+	setString("WEB_ASSETS_DIR", &c.Web.AssetsDir)
+
+	setString("WEB_API_TOKEN", &c.Auth.APIToken)
+	setString("WEB_AUTH_MODE", &c.Auth.Mode)
+	setString("WEB_SESSION_SECRET", &c.Auth.SessionSecret)
+	if v, ok := os.LookupEnv("WEB_USERS"); ok {
+		users, err := auth.ParseUsers(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("WEB_USERS: %v", err))
+		}
+		c.Auth.Users = users
+	}
+	setDuration("WEB_SESSION_TTL", &c.Auth.SessionTTL)
+	if v, ok := os.LookupEnv("WEB_HTTPS_PROXY"); ok {
+		httpsProxy, err := strconv.ParseBool(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("WEB_HTTPS_PROXY: %q is not a boolean", v))
+		}
+		c.Auth.HTTPSProxy = httpsProxy
+	}
+	setString("TELEGRAM_LOGIN_BOT", &c.Auth.TelegramLogin.Bot)
+	if v, ok := os.LookupEnv("TELEGRAM_LOGIN_USERS"); ok {
+		c.Auth.TelegramLogin.Users = nil
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id == "" {
+				continue
+			}
+			userID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("TELEGRAM_LOGIN_USERS: invalid user id %q", id))
+				continue
+			}
+			c.Auth.TelegramLogin.Users = append(c.Auth.TelegramLogin.Users, userID)
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// SendOptions returns the options of the Telegram client
+func (c *Config) SendOptions() *send.Options {
+	opts := &send.Options{
+		Server:  c.Telegram.Server,
+		Token:   c.Telegram.Token,
+		Timeout: c.Telegram.Timeout,
+		Caption: c.Formatter.Caption,
+		DryRun:  c.Telegram.DryRun,
+
+		MaxUploadSize: int64(c.Telegram.MaxUploadSize),
+		LinkURL:       c.Telegram.LinkURL,
+	}
+	// the policies are checked by Validate
+	opts.Fallback, _ = send.ParseFallback(c.Telegram.Fallback)
+	opts.CaptionOverflow, _ = send.ParseCaptionOverflow(c.Formatter.Overflow)
+	opts.ParseMode, _ = send.ParseParseMode(c.Formatter.ParseMode)
+	for _, d := range c.Destinations {
+		dest := send.Destination{Name: d.Name, Chat: d.Chat, Caption: d.Caption}
+		if d.ParseMode != "" {
+			dest.ParseMode, _ = send.ParseParseMode(d.ParseMode)
+		}
+		opts.Destinations = append(opts.Destinations, dest)
+	}
+	if len(c.Destinations) > 0 {
+		opts.Channel = c.Destinations[0].Chat
+	}
+	return opts
+}
+
+// Probes of the video info, see Scan.Probe
+const (
+	ProbeAuto    = "auto"
+	ProbeFFprobe = "ffprobe"
+	ProbeNative  = "native"
+)
+
+// DuplicatesOff is Scan.Duplicates disabling the search of the copies of a video
+const DuplicatesOff = "off"
+
+// VideoInfoProvider returns the provider of the video info selected by Scan.Probe,
+// cached in Scan.Cache if it is set
+func (c *Config) VideoInfoProvider() finder.VIProvider {
+	provider := c.prober()
+	if c.Scan.Cache == "" {
+		return provider
+	}
+	return finder.NewCachedProvider(provider, c.Scan.Cache)
+}
+
+// prober returns the provider of the video info selected by Scan.Probe
+func (c *Config) prober() finder.VIProvider {
+	switch c.Scan.Probe {
+	case ProbeFFprobe:
+		return finder.NewVideoInfoProvider()
+	case ProbeNative:
+		return finder.NewMP4InfoProvider()
+	}
+	return finder.NewChainProvider(finder.NewVideoInfoProvider(), finder.NewMP4InfoProvider())
+}
+
+// Pipeline returns the processing of the videos before they are sent: the trim by the sidecars
+// and the watermarks of the destinations. The processed videos aren't cached in Scan.Cache.
+func (c *Config) Pipeline() *process.Pipeline {
+	steps := []process.Processor{&process.TrimStep{}}
+	watermark := &process.WatermarkStep{Destinations: map[string]*process.Watermark{}}
+	for i, d := range c.Destinations {
+		if d.Watermark == nil {
+			continue
+		}
+		watermark.Destinations[d.Name] = d.Watermark.options()
+		if i == 0 {
+			watermark.Default = d.Watermark.options()
+		}
+	}
+	if len(watermark.Destinations) > 0 {
+		steps = append(steps, watermark)
+	}
+	p := process.NewPipeline(c.Process.WorkDir, c.prober(), steps...)
+	p.MaxAge = c.Process.MaxAge
+	return p
+}
+
+// Deduplicator returns the search of the copies of the same video, nil if it is off
+func (c *Config) Deduplicator() *finder.Deduplicator {
+	if c.Scan.Duplicates == "" || c.Scan.Duplicates == DuplicatesOff {
+		return nil
+	}
+	d := finder.NewDeduplicator(c.Scan.Hash, c.Scan.Duplicates)
+	d.Workers = c.Scan.Workers
+	return d
+}
+
+// History returns the history of the sent videos, nil if it is disabled
+func (c *Config) History() (*finder.History, error) {
+	if c.Scan.History == "" {
+		return nil, nil
+	}
+	return finder.NewHistory(c.Scan.History)
+}
+
+// SimilarFinder returns the search of the near-duplicates compared to the history, nil if it is disabled
+func (c *Config) SimilarFinder(history *finder.History) *finder.SimilarFinder {
+	if c.Scan.Similarity <= 0 {
+		return nil
+	}
+	f := finder.NewSimilarFinder(c.Scan.Similarity, history)
+	f.Workers = c.Scan.Workers
+	return f
+}
+
+// FilesProvider returns the provider listing the files of the sources
+func (c *Config) FilesProvider() *finder.Provider {
+	p := finder.NewProvider(c.VideoInfoProvider())
+	p.Workers = c.Scan.Workers
+	p.Sorters = c.Sorters()
+	return p
+}
+
+// Sorters returns the sorters of the source directories
+func (c *Config) Sorters() map[string]finder.Sorter {
+	sorters := make(map[string]finder.Sorter, len(c.Sources))
+	for _, s := range c.Sources {
+		// the remote sources and the archives are sorted by their names
+		key := s.Dir
+		if s.Name != "" {
+			key = s.Name
+		}
+		if key == "" {
+			continue
+		}
+		// the sorters are checked by Validate
+		if sorter, err := s.Sorter(); err == nil {
+			sorters[key] = sorter
+		}
+	}
+	return sorters
+}
+
+// Remotes returns the remote sources downloading into Scan.WorkDir
+func (c *Config) Remotes() []*finder.Remote {
+	var remotes []*finder.Remote
+	for _, s := range c.Sources {
+		// the remote sources are checked by Validate
+		source, err := s.Remote()
+		if err != nil || source == nil {
+			continue
+		}
+		remotes = append(remotes, &finder.Remote{
+			Name:      s.Name,
+			Source:    source,
+			WorkDir:   filepath.Join(c.Scan.WorkDir, s.Name),
+			AfterSend: s.AfterSend,
+			MoveTo:    s.MoveTo,
+		})
+	}
+	return remotes
+}
+
+// Archives returns the archive sources extracting into Scan.WorkDir
+func (c *Config) Archives() []*finder.Archives {
+	var archives []*finder.Archives
+	for _, s := range c.Sources {
+		if s.Archive == "" {
+			continue
+		}
+		archives = append(archives, &finder.Archives{
+			Name:    s.Name,
+			Pattern: s.Archive,
+			WorkDir: filepath.Join(c.Scan.WorkDir, s.Name),
+			Album:   s.Album,
+		})
+	}
+	return archives
+}
+
+// AuthOptions returns the options of the control panel authentication
+func (c *Config) AuthOptions() auth.Options {
+	return auth.Options{
+		APIToken:         c.Auth.APIToken,
+		Users:            c.Auth.Users,
+		Mode:             auth.Mode(c.Auth.Mode),
+		SessionSecret:    c.Auth.SessionSecret,
+		SessionTTL:       c.Auth.SessionTTL,
+		TelegramBotToken: c.Telegram.Token,
+		TelegramBotName:  c.Auth.TelegramLogin.Bot,
+		TelegramUsers:    c.Auth.TelegramLogin.Users,
+		HTTPSProxy:       c.Auth.HTTPSProxy,
+	}
+}
+
+// SourceDirs returns the directories of the sources, DefaultSourceDir is left out while it is missing
+func (c *Config) SourceDirs() []string {
+	dirs := make([]string, 0, len(c.Sources))
+	for _, s := range c.Sources {
+		if s.Dir == "" {
+			continue
+		}
+		if _, err := os.Stat(s.Dir); s.Dir == DefaultSourceDir && errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		dirs = append(dirs, s.Dir)
+	}
+	return dirs
+}
+
+// Manifests returns the manifests of the sources
+func (c *Config) Manifests() []string {
+	var manifests []string
+	for _, s := range c.Sources {
+		if s.Manifest != "" {
+			manifests = append(manifests, s.Manifest)
+		}
+	}
+	return manifests
+}
+
+// Stars returns the price of i-th video of a batch
+func (c *Config) Stars(i int) int {
+	if c.Pricing.FreeEvery > 0 && i%c.Pricing.FreeEvery == 0 {
+		return 0
+	}
+	return c.Pricing.Stars
+}
+
+// isValidListen checks "host:port" address
+func isValidListen(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535
+}
@@ -0,0 +1,510 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	tb "gopkg.in/telebot.v4"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/process"
+	"github.com/meesooqa/files2tg/app/send"
+)
+
+// clearEnv unsets the env overrides for the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{
+		"TELEGRAM_TOKEN", "TELEGRAM_SERVER", "TELEGRAM_TIMEOUT", "TELEGRAM_CHAN", "TELEGRAM_DRY_RUN",
+		"TELEGRAM_MAX_UPLOAD_SIZE", "TELEGRAM_FALLBACK", "TELEGRAM_LINK_URL", "SCAN_PROBE", "SCAN_CACHE", "SCAN_WORKERS",
+		"SCAN_WORK_DIR", "SCAN_DUPLICATES", "SCAN_HASH", "SCAN_HISTORY", "SCAN_SIMILARITY",
+		"PROCESS_WORK_DIR", "PROCESS_MAX_AGE",
+		"WEB_LISTEN", "WEB_HTTPS_PROXY", "WEB_ASSETS_DIR", "WEB_API_TOKEN", "WEB_AUTH_MODE", "WEB_SESSION_SECRET",
+		"WEB_USERS", "WEB_SESSION_TTL", "TELEGRAM_LOGIN_BOT", "TELEGRAM_LOGIN_USERS",
+	} {
+		t.Setenv(name, "")
+		require.NoError(t, os.Unsetenv(name))
+	}
+}
+
+func writeConfig(t *testing.T, text string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(text), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	path := writeConfig(t, `
+sources:
+  - dir: `+dir+`
+    sort: playlist
+    playlist: order.m3u
+  - name: bucket
+    s3:
+      endpoint: minio:9000
+      bucket: videos
+      prefix: incoming
+    after_send: move
+    move_to: sent
+    sort: name
+  - name: nas
+    webdav:
+      url: https://nas.example.com/dav/videos
+  - name: zips
+    archive: `+dir+`/*.zip
+    album: true
+    sort: name
+destinations:
+  - name: main
+    chat: "@main"
+    watermark:
+      text: "@main"
+      position: top_left
+      opacity: 0.5
+  - name: backup
+    chat: "-100123"
+    parse_mode: MarkdownV2
+    caption: "*{{.Title}}*"
+telegram:
+  token: tok
+  timeout: 2m
+  max_upload_size: 20MB
+  fallback: link
+  link_url: https://files.example.com/videos
+formatter:
+  caption: "<b>{{.Title}}</b>"
+  overflow: reply
+pricing:
+  stars: 5
+  free_every: 3
+workers: 2
+web:
+  listen: 127.0.0.1:9000
+auth:
+  users:
+    admin: "`+string(hash)+`"
+  session_ttl: 1h
+`)
+
+	cfg, err := Load(path, ScopeAll)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dir}, cfg.SourceDirs())
+	assert.Equal(t, 2*time.Minute, cfg.Telegram.Timeout)
+	assert.Equal(t, 2, cfg.Workers)
+	assert.Equal(t, "127.0.0.1:9000", cfg.Web.Listen)
+	assert.Equal(t, time.Hour, cfg.Auth.SessionTTL)
+	assert.Equal(t, map[string]finder.Sorter{
+		dir:      finder.PlaylistSorter{Path: filepath.Join(dir, "order.m3u")},
+		"bucket": finder.NameSorter{},
+		"nas":    finder.ModTimeSorter{},
+		"zips":   finder.NameSorter{},
+	}, cfg.Sorters())
+	assert.Equal(t, []*finder.Archives{{
+		Name: "zips", Pattern: dir + "/*.zip", WorkDir: filepath.Join("var", "work", "zips"), Album: true,
+	}}, cfg.Archives())
+	remotes := cfg.Remotes()
+	require.Len(t, remotes, 2)
+	assert.Equal(t, "bucket", remotes[0].Name)
+	assert.Equal(t, filepath.Join("var", "work", "bucket"), remotes[0].WorkDir)
+	assert.Equal(t, finder.AfterSendMove, remotes[0].AfterSend)
+	assert.Equal(t, "sent", remotes[0].MoveTo)
+	assert.Equal(t, []string{dir}, cfg.SourceDirs())
+	assert.Equal(t, cfg.Sorters(), cfg.FilesProvider().Sorters)
+
+	opts := cfg.SendOptions()
+	assert.Equal(t, "@main", opts.Channel)
+	assert.Equal(t, "tok", opts.Token)
+	assert.Len(t, opts.Destinations, 2)
+	assert.Equal(t, "<b>{{.Title}}</b>", opts.Caption)
+	assert.Equal(t, int64(20<<20), opts.MaxUploadSize)
+	assert.Equal(t, send.FallbackLink, opts.Fallback)
+	assert.Equal(t, "https://files.example.com/videos", opts.LinkURL)
+	assert.Equal(t, send.OverflowReply, opts.CaptionOverflow)
+	assert.Equal(t, tb.ModeHTML, opts.ParseMode)
+	assert.Equal(t, send.Destination{Name: "backup", Chat: "-100123", ParseMode: tb.ModeMarkdownV2, Caption: "*{{.Title}}*"}, opts.Destinations[1])
+
+	pipeline := cfg.Pipeline()
+	require.NotNil(t, pipeline)
+	assert.Equal(t, "var/cache/process", pipeline.WorkDir)
+	assert.Equal(t, 7*24*time.Hour, pipeline.MaxAge)
+	wm := &process.Watermark{Text: "@main", Position: process.TopLeft, Opacity: 0.5}
+	assert.Equal(t, []process.Processor{&process.TrimStep{}, &process.WatermarkStep{Default: wm, Destinations: map[string]*process.Watermark{"main": wm}}}, pipeline.Steps)
+
+	authOpts := cfg.AuthOptions()
+	assert.True(t, authOpts.Enabled())
+	assert.Equal(t, "tok", authOpts.TelegramBotToken)
+
+	assert.Equal(t, []int{0, 5, 5, 0}, []int{cfg.Stars(0), cfg.Stars(1), cfg.Stars(2), cfg.Stars(3)})
+}
+
+func TestLoad_EnvOverrides(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	path := writeConfig(t, `
+sources:
+  - dir: `+dir+`
+destinations:
+  - name: main
+    chat: "@main"
+`)
+	t.Setenv("TELEGRAM_CHAN", "@env")
+	t.Setenv("TELEGRAM_TOKEN", "env-token")
+	t.Setenv("TELEGRAM_SERVER", "https://t.me")
+	t.Setenv("TELEGRAM_TIMEOUT", "5m")
+	t.Setenv("TELEGRAM_DRY_RUN", "true")
+	t.Setenv("TELEGRAM_MAX_UPLOAD_SIZE", "1GB")
+	t.Setenv("TELEGRAM_FALLBACK", "split")
+	t.Setenv("WEB_LISTEN", ":9999")
+	t.Setenv("TELEGRAM_LOGIN_USERS", "1, 2")
+	t.Setenv("TELEGRAM_LOGIN_BOT", "bot")
+	t.Setenv("WEB_SESSION_SECRET", strings.Repeat("s", 32))
+	t.Setenv("SCAN_SIMILARITY", "0.85")
+
+	cfg, err := Load(path, ScopeAll)
+	require.NoError(t, err)
+	assert.Equal(t, "@env", cfg.Destinations[0].Chat)
+	assert.Equal(t, "main", cfg.Destinations[0].Name)
+	assert.Equal(t, "env-token", cfg.Telegram.Token)
+	assert.Equal(t, 5*time.Minute, cfg.Telegram.Timeout)
+	opts := cfg.SendOptions()
+	assert.Equal(t, "@env", opts.Channel)
+	assert.Equal(t, "https://t.me", opts.Server)
+	assert.Equal(t, "env-token", opts.Token)
+	assert.Equal(t, 5*time.Minute, opts.Timeout)
+	assert.True(t, opts.DryRun)
+	assert.Equal(t, int64(1<<30), opts.MaxUploadSize)
+	assert.Equal(t, send.FallbackSplit, opts.Fallback)
+	assert.Equal(t, ":9999", cfg.Web.Listen)
+	assert.Equal(t, []int64{1, 2}, cfg.Auth.TelegramLogin.Users)
+	assert.Equal(t, 0.85, cfg.Scan.Similarity)
+}
+
+func TestLoad_DefaultPathIsOptional(t *testing.T) {
+	clearEnv(t)
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll("var/files", 0o755))
+	t.Setenv("TELEGRAM_CHAN", "@chan")
+
+	cfg, err := Load("", ScopeAll)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"var/files"}, cfg.SourceDirs())
+	assert.Equal(t, "@chan", cfg.SendOptions().Channel)
+	assert.Equal(t, 1, cfg.Workers)
+	assert.Equal(t, ":8080", cfg.Web.Listen)
+
+	_, err = Load("missing.yml", ScopeAll)
+	assert.ErrorContains(t, err, "read config")
+}
+
+func TestLoad_DefaultSourceDirIsOptional(t *testing.T) {
+	clearEnv(t)
+	t.Chdir(t.TempDir())
+
+	cfg, err := Load("", ScopeAll)
+	require.NoError(t, err)
+	assert.Empty(t, cfg.SourceDirs())
+
+	// a configured directory must exist
+	_, err = Load(writeConfig(t, "sources:\n  - dir: var/other\n"), ScopeAll)
+	assert.ErrorContains(t, err, "sources[0].dir")
+}
+
+func TestLoad_Scope(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+sources:
+  - dir: /nonexistent
+scan:
+  workers: 0
+destinations:
+  - name: main
+telegram:
+  fallback: zip
+web:
+  listen: nowhere
+`)
+	problems := func(scope Scope) []string {
+		_, err := Load(path, scope)
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			require.NoError(t, err)
+			return nil
+		}
+		return verr.Problems
+	}
+
+	assert.Empty(t, problems(0))
+	assert.Equal(t, []string{"sources[0].dir: stat /nonexistent: no such file or directory"}, problems(ScopeSources))
+	assert.Equal(t, []string{"scan.workers: must be at least 1"}, problems(ScopeScan))
+	assert.Equal(t, []string{
+		"destinations[0].chat: is required",
+		`telegram.fallback: unknown fallback "zip", expected one of fail, text, compress, split, link`,
+	}, problems(ScopeSend))
+	assert.Equal(t, []string{`web.listen: "nowhere" is not a host:port address`}, problems(ScopeServe))
+	assert.Len(t, problems(ScopeAll), 5)
+}
+
+func TestLoad_EnvDurations(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, "sources:\n  - dir: "+t.TempDir()+"\n")
+	t.Setenv("TELEGRAM_TIMEOUT", "90s")
+	t.Setenv("PROCESS_MAX_AGE", "48h")
+	t.Setenv("WEB_SESSION_TTL", "30m")
+
+	cfg, err := Load(path, ScopeAll)
+	require.NoError(t, err)
+	assert.Equal(t, 90*time.Second, cfg.Telegram.Timeout)
+	assert.Equal(t, 48*time.Hour, cfg.Process.MaxAge)
+	assert.Equal(t, 30*time.Minute, cfg.Auth.SessionTTL)
+
+	t.Setenv("TELEGRAM_TIMEOUT", "5")
+	_, err = Load(path, ScopeAll)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []string{`TELEGRAM_TIMEOUT: "5" is not a duration like 90s, 5m or 24h`}, verr.Problems)
+}
+
+func TestLoad_UnknownField(t *testing.T) {
+	clearEnv(t)
+	_, err := Load(writeConfig(t, "worker: 2\n"), ScopeAll)
+	assert.ErrorContains(t, err, "field worker not found")
+}
+
+func TestValidate_ListsEveryProblem(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+sources:
+  - dir: /nonexistent/dir
+    sort: alpha
+  - dir: ""
+  - manifest: /nonexistent/list.csv
+    sort: name
+  - dir: /tmp
+    webdav:
+      url: https://nas
+  - name: "bad name"
+    s3:
+      endpoint: minio:9000
+    after_send: move
+  - name: nas
+    sftp:
+      addr: nas:22
+      user: bot
+  - name: dav
+    after_send: archive
+    webdav:
+      url: nas/dav
+  - name: dav
+    archive: "[clips"
+  - dir: /tmp
+    album: true
+destinations:
+  - name: main
+  - name: main
+    chat: "@x"
+    parse_mode: markdown
+  - name: md
+    chat: "@md"
+    parse_mode: MarkdownV2
+    caption: "{{.Title}} v1.0"
+telegram:
+  token: tok
+  fallback: zip
+formatter:
+  caption: "{{.Title"
+  overflow: drop
+  parse_mode: html
+scan:
+  probe: magic
+  workers: 0
+  duplicates: drop
+  hash: md5
+  similarity: 90
+pricing:
+  stars: -1
+workers: 0
+web:
+  listen: "8080"
+auth:
+  mode: magic
+  users:
+    admin: plain
+  telegram_login:
+    users: [1]
+`)
+
+	_, err := Load(path, ScopeAll)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	expected := []string{
+		"sources[0].dir",
+		`sources[0].sort: "alpha" is not one of name, mtime, created, size, duration, random, playlist`,
+		"sources[1].dir: is required",
+		"sources[2].sort: the files of a manifest are sent in its order",
+		"sources[2].manifest: failed to read manifest",
+		"sources[3]: only one of dir, manifest, archive, s3, sftp and webdav is allowed",
+		`sources[4].name: "bad name" may contain letters, digits, _ and - only`,
+		"sources[4].move_to: is required to move the sent files",
+		"sources[4].s3.bucket: is required",
+		"sources[5]: known hosts file is required to check the host key",
+		`sources[6].after_send: "archive" is not one of keep, delete, move`,
+		"sources[6].webdav.url: an http(s) URL is required",
+		`sources[7].name: "dav" is duplicated`,
+		"sources[7].archive: syntax error in pattern",
+		"sources[8].album: is for the archives only",
+		"destinations[0].chat: is required",
+		`destinations[1].name: "main" is duplicated`,
+		`destinations[1].parse_mode: unsupported parse mode "markdown"`,
+		"destinations[2].caption: invalid caption: character '.'",
+		"telegram.fallback: unknown fallback",
+		"formatter.caption",
+		"formatter.overflow: unknown overflow",
+		`scan.probe: "magic" is not one of auto, ffprobe, native`,
+		"scan.workers: must be at least 1",
+		`scan.duplicates: "drop" is not one of off, warn, keep_first, skip`,
+		"scan.similarity: must be between 0 and 1",
+		`scan.hash: "md5" is not one of fast, sha256`,
+		"pricing.stars",
+		"workers: must be at least 1",
+		"web.listen",
+		"auth.mode",
+		"auth.users.admin",
+		"auth.session_secret",
+		"auth.telegram_login.bot: is required",
+	}
+	require.Len(t, verr.Problems, len(expected), err.Error())
+	for i, want := range expected {
+		assert.Contains(t, verr.Problems[i], want)
+	}
+	assert.Contains(t, err.Error(), "invalid config:\n  - sources[0].dir")
+}
+
+func TestConfig_VideoInfoProvider(t *testing.T) {
+	cfg := Default()
+	cached, ok := cfg.VideoInfoProvider().(*finder.CachedProvider)
+	require.True(t, ok)
+	assert.IsType(t, &finder.ChainProvider{}, cached.Provider)
+	assert.Equal(t, "var/cache/probe.json", cached.Path)
+	assert.Equal(t, 4, cfg.FilesProvider().Workers)
+	assert.Nil(t, cfg.Deduplicator(), "off by default")
+	cfg.Scan.Duplicates = finder.DuplicatesKeepFirst
+	d := cfg.Deduplicator()
+	require.NotNil(t, d)
+	assert.Equal(t, finder.HashFast, d.Hash)
+	assert.Equal(t, finder.DuplicatesKeepFirst, d.Action)
+	assert.Equal(t, 4, d.Workers)
+
+	assert.Nil(t, cfg.SimilarFinder(nil), "off by default")
+	cfg.Scan.History = filepath.Join(t.TempDir(), "history.json")
+	history, err := cfg.History()
+	require.NoError(t, err)
+	cfg.Scan.Similarity = 0.8
+	similar := cfg.SimilarFinder(history)
+	require.NotNil(t, similar)
+	assert.Equal(t, 0.8, similar.Threshold)
+	assert.Same(t, history, similar.History)
+	cfg.Scan.History = ""
+	history, err = cfg.History()
+	assert.NoError(t, err)
+	assert.Nil(t, history)
+
+	cfg.Scan.Cache = ""
+	assert.IsType(t, &finder.ChainProvider{}, cfg.VideoInfoProvider())
+	cfg.Scan.Probe = ProbeFFprobe
+	assert.IsType(t, &finder.VideoInfoProvider{}, cfg.VideoInfoProvider())
+	cfg.Scan.Probe = ProbeNative
+	assert.IsType(t, &finder.MP4InfoProvider{}, cfg.VideoInfoProvider())
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{"1024": 1024, "50MB": 50 << 20, "2 gb": 2 << 30, "10KB": 10 << 10, "-1": -1}
+	for text, want := range tests {
+		got, err := ParseByteSize(text)
+		require.NoError(t, err, text)
+		assert.Equal(t, want, got, text)
+	}
+	_, err := ParseByteSize("big")
+	assert.Error(t, err)
+}
+
+func TestValidate_LinkFallback(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+sources:
+  - dir: `+t.TempDir()+`
+telegram:
+  fallback: link
+`)
+	_, err := Load(path, ScopeAll)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []string{"telegram.link_url: an http(s) URL is required by the link fallback"}, verr.Problems)
+}
+
+func TestValidate_Watermark(t *testing.T) {
+	clearEnv(t)
+	path := writeConfig(t, `
+sources:
+  - dir: `+t.TempDir()+`
+destinations:
+  - name: main
+    chat: "@main"
+    watermark:
+      image: missing.png
+  - name: backup
+    chat: "@backup"
+    watermark:
+      image: logo.png
+      text: "@backup"
+  - name: other
+    chat: "@other"
+    watermark:
+      text: "@other"
+      position: center
+      opacity: 2
+`)
+	_, err := Load(path, ScopeAll)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []string{
+		"destinations[0].watermark.image: stat missing.png: no such file or directory",
+		"destinations[1].watermark: one of image and text is required",
+		`destinations[2].watermark: unknown position "center", expected one of top_left, top_right, bottom_left, bottom_right`,
+	}, verr.Problems)
+}
+
+func TestValidate_ManifestDestinations(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("video"), 0o600))
+	}
+	manifest := filepath.Join(dir, "list.csv")
+	require.NoError(t, os.WriteFile(manifest, []byte("path,destination\na.mp4,main\nb.mp4,-100123\nc.mp4,@raw\nd.mp4,mian\n"), 0o600))
+	path := writeConfig(t, `
+sources:
+  - manifest: `+manifest+`
+destinations:
+  - name: main
+    chat: "@main"
+`)
+	_, err := Load(path, ScopeAll)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []string{
+		`sources[0].manifest: destination of ` + filepath.Join(dir, "d.mp4") + `: "mian": unknown destination`,
+	}, verr.Problems)
+}
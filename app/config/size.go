@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ByteSize is a size in bytes written as a number or with a KB, MB or GB suffix, the multiplier is 1024
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseByteSize parses "50MB", "2GB" or a number of bytes
+func ParseByteSize(s string) (ByteSize, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text, multiplier = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix)), unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a size like 50MB", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(node *yaml.Node) error {
+	size, err := ParseByteSize(node.Value)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	tb "gopkg.in/telebot.v4"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/web/auth"
+)
+
+// ValidationError lists every problem of the config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Scope selects the settings checked by Validate, every command uses a part of the config
+type Scope uint
+
+const (
+	// ScopeSources are the sources of the videos
+	ScopeSources Scope = 1 << iota
+	// ScopeScan are the scan settings and the history
+	ScopeScan
+	// ScopeSend are the destinations, the Telegram, formatter and processing settings
+	ScopeSend
+	// ScopeServe are the web, auth, pricing and workers settings of the server
+	ScopeServe
+	// ScopeAll is the whole config
+	ScopeAll = ScopeSources | ScopeScan | ScopeSend | ScopeServe
+)
+
+// Validate checks the settings of the scope and reports all problems at once
+func (c *Config) Validate(scope Scope) error {
+	var problems []string
+	if scope&ScopeSources != 0 {
+		problems = append(problems, c.validateSources()...)
+	}
+	if scope&ScopeSend != 0 {
+		problems = append(problems, c.validateSend()...)
+	}
+	if scope&ScopeScan != 0 {
+		problems = append(problems, c.validateScan()...)
+	}
+	if scope&ScopeServe != 0 {
+		problems = append(problems, c.validateServe()...)
+		problems = append(problems, c.validateAuth()...)
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func (c *Config) validateSources() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Sources) == 0 {
+		add("sources: at least one source is required")
+	}
+	remoteNames := map[string]bool{}
+	for i, s := range c.Sources {
+		kinds := 0
+		for _, set := range []bool{s.Dir != "", s.Manifest != "", s.Archive != "", s.S3 != nil, s.SFTP != nil, s.WebDAV != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			add("sources[%d]: only one of dir, manifest, archive, s3, sftp and webdav is allowed", i)
+			continue
+		}
+		if s.Archive != "" {
+			problems = append(problems, s.validateName(fmt.Sprintf("sources[%d]", i), remoteNames)...)
+			if _, err := filepath.Glob(s.Archive); err != nil {
+				add("sources[%d].archive: %v", i, err)
+			}
+			continue
+		}
+		if s.Album {
+			add("sources[%d].album: is for the archives only", i)
+		}
+		if s.S3 != nil || s.SFTP != nil || s.WebDAV != nil {
+			problems = append(problems, s.validateRemote(fmt.Sprintf("sources[%d]", i), remoteNames)...)
+			continue
+		}
+		if s.Manifest != "" {
+			if s.Sort != "" {
+				add("sources[%d].sort: the files of a manifest are sent in its order", i)
+			}
+			files, err := finder.LoadManifest(s.Manifest)
+			if err != nil {
+				add("sources[%d].manifest: %v", i, err)
+			}
+			for _, file := range files {
+				if err := c.SendOptions().CheckDestination(file.Destination); err != nil {
+					add("sources[%d].manifest: destination of %s: %v", i, file.Path, err)
+				}
+			}
+			continue
+		}
+		if s.Dir == "" {
+			add("sources[%d].dir: is required", i)
+			continue
+		}
+		switch info, err := os.Stat(s.Dir); {
+		case errors.Is(err, os.ErrNotExist) && s.Dir == DefaultSourceDir:
+			// the default directory may be created later
+		case err != nil:
+			add("sources[%d].dir: %v", i, err)
+		case !info.IsDir():
+			add("sources[%d].dir: %s is not a directory", i, s.Dir)
+		}
+		if _, err := s.Sorter(); err != nil {
+			add("sources[%d].sort: %v", i, err)
+		}
+	}
+	if len(remoteNames) > 0 && c.Scan.WorkDir == "" {
+		add("scan.work_dir: is required by the remote sources and the archives")
+	}
+	return problems
+}
+
+func (c *Config) validateScan() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.Scan.Probe {
+	case ProbeAuto, ProbeFFprobe, ProbeNative:
+	default:
+		add("scan.probe: %q is not one of auto, ffprobe, native", c.Scan.Probe)
+	}
+	if c.Scan.Workers < 1 {
+		add("scan.workers: must be at least 1")
+	}
+	switch c.Scan.Duplicates {
+	case "", DuplicatesOff, finder.DuplicatesWarn, finder.DuplicatesKeepFirst, finder.DuplicatesSkip:
+	default:
+		add("scan.duplicates: %q is not one of off, warn, keep_first, skip", c.Scan.Duplicates)
+	}
+	if c.Scan.Similarity < 0 || c.Scan.Similarity > 1 {
+		add("scan.similarity: must be between 0 and 1")
+	}
+	if _, err := c.History(); err != nil {
+		add("scan.history: %v", err)
+	}
+	switch c.Scan.Hash {
+	case finder.HashFast, finder.HashSHA256:
+	default:
+		add("scan.hash: %q is not one of fast, sha256", c.Scan.Hash)
+	}
+	return problems
+}
+
+func (c *Config) validateSend() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	names := make(map[string]bool, len(c.Destinations))
+	for i, d := range c.Destinations {
+		if d.Name == "" {
+			add("destinations[%d].name: is required", i)
+		} else if names[d.Name] {
+			add("destinations[%d].name: %q is duplicated", i, d.Name)
+		}
+		names[d.Name] = true
+		if d.Chat == "" {
+			add("destinations[%d].chat: is required", i)
+		}
+		if wm := d.Watermark.options(); wm != nil {
+			if err := wm.Validate(); err != nil {
+				add("destinations[%d].watermark: %v", i, err)
+			} else if _, err := os.Stat(wm.Image); wm.Image != "" && err != nil {
+				add("destinations[%d].watermark.image: %v", i, err)
+			}
+		}
+		if d.Caption == "" && d.ParseMode == "" {
+			continue
+		}
+		mode, err := send.ParseParseMode(d.ParseMode)
+		if err != nil {
+			add("destinations[%d].parse_mode: %v", i, err)
+			continue
+		}
+		if d.ParseMode == "" {
+			mode, _ = send.ParseParseMode(c.Formatter.ParseMode)
+		}
+		caption := d.Caption
+		if caption == "" {
+			caption = c.Formatter.Caption
+		}
+		if err := checkCaption(caption, mode); err != nil {
+			add("destinations[%d].caption: %v", i, err)
+		}
+	}
+	if c.Telegram.Token != "" && len(c.Destinations) == 0 {
+		add("destinations: at least one destination is required to send with the telegram token")
+	}
+	if c.Telegram.DryRun && len(c.Destinations) == 0 {
+		add("destinations: at least one destination is required for the dry run")
+	}
+
+	if c.Process.MaxAge < 0 {
+		add("process.max_age: must not be negative")
+	}
+	if c.Process.WorkDir == "" {
+		add("process.work_dir: is required to process the videos")
+	}
+
+	if c.Telegram.Timeout < 0 {
+		add("telegram.timeout: must not be negative")
+	}
+	if fallback, err := send.ParseFallback(c.Telegram.Fallback); err != nil {
+		add("telegram.fallback: %v", err)
+	} else if fallback == send.FallbackLink {
+		if u, err := url.Parse(c.Telegram.LinkURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("telegram.link_url: an http(s) URL is required by the link fallback")
+		}
+	}
+	if mode, err := send.ParseParseMode(c.Formatter.ParseMode); err != nil {
+		add("formatter.parse_mode: %v", err)
+	} else if err := checkCaption(c.Formatter.Caption, mode); err != nil {
+		add("formatter.caption: %v", err)
+	}
+	if _, err := send.ParseCaptionOverflow(c.Formatter.Overflow); err != nil {
+		add("formatter.overflow: %v", err)
+	}
+	return problems
+}
+
+func (c *Config) validateServe() []string {
+	var problems []string
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Pricing.Stars < 0 {
+		add("pricing.stars: must not be negative")
+	}
+	if c.Pricing.FreeEvery < 0 {
+		add("pricing.free_every: must not be negative")
+	}
+	if c.Workers < 1 {
+		add("workers: must be at least 1")
+	}
+	if !isValidListen(c.Web.Listen) {
+		add("web.listen: %q is not a host:port address", c.Web.Listen)
+	}
+	if c.Web.AssetsDir != "" {
+		if _, err := os.Stat(c.Web.AssetsDir); err != nil {
+			add("web.assets_dir: %v", err)
+		}
+	}
+	return problems
+}
+
+// validRemoteName is used as a directory name of the work directory
+var validRemoteName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateName checks the name of the remote source or the archives, the names must be unique
+func (s Source) validateName(prefix string, names map[string]bool) []string {
+	var problems []string
+	switch {
+	case s.Name == "":
+		problems = append(problems, prefix+".name: is required for a remote source and archives")
+	case !validRemoteName.MatchString(s.Name):
+		problems = append(problems, prefix+fmt.Sprintf(".name: %q may contain letters, digits, _ and - only", s.Name))
+	case names[s.Name]:
+		problems = append(problems, prefix+fmt.Sprintf(".name: %q is duplicated", s.Name))
+	}
+	names[s.Name] = true
+	return problems
+}
+
+// validateRemote checks the remote source, the names must be unique
+func (s Source) validateRemote(prefix string, names map[string]bool) []string {
+	problems := s.validateName(prefix, names)
+	add := func(format string, args ...any) {
+		problems = append(problems, prefix+fmt.Sprintf(format, args...))
+	}
+	switch s.AfterSend {
+	case "", finder.AfterSendKeep, finder.AfterSendDelete:
+	case finder.AfterSendMove:
+		if s.MoveTo == "" {
+			add(".move_to: is required to move the sent files")
+		}
+	default:
+		add(".after_send: %q is not one of keep, delete, move", s.AfterSend)
+	}
+
+	switch {
+	case s.S3 != nil:
+		if s.S3.Endpoint == "" {
+			add(".s3.endpoint: is required")
+		}
+		if s.S3.Bucket == "" {
+			add(".s3.bucket: is required")
+		}
+	case s.SFTP != nil:
+		if s.SFTP.Addr == "" {
+			add(".sftp.addr: is required")
+		}
+		if s.SFTP.User == "" {
+			add(".sftp.user: is required")
+		}
+	case s.WebDAV != nil:
+		if u, err := url.Parse(s.WebDAV.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add(".webdav.url: an http(s) URL is required")
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	if _, err := s.Remote(); err != nil {
+		add(": %v", err)
+	}
+	return problems
+}
+
+// checkCaption parses the caption template and validates a sample caption in the parse mode
+func checkCaption(text string, mode tb.ParseMode) error {
+	tf, err := send.NewTelegramFormatter(text, mode)
+	if err != nil {
+		return err
+	}
+	return tf.Check()
+}
+
+func (c *Config) validateAuth() []string {
+	var problems []string
+	a := c.Auth
+	switch auth.Mode(a.Mode) {
+	case "", auth.ModeBasic, auth.ModeSession:
+	default:
+		problems = append(problems, fmt.Sprintf("auth.mode: %q is not one of basic, session", a.Mode))
+	}
+	users := make([]string, 0, len(a.Users))
+	for user := range a.Users {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	for _, user := range users {
+		if _, err := auth.ParseUsers(user + ":" + a.Users[user]); err != nil {
+			problems = append(problems, fmt.Sprintf("auth.users.%s: %v", user, err))
+		}
+	}
+	session := auth.Mode(a.Mode) == auth.ModeSession || len(a.TelegramLogin.Users) > 0
+	if session && len(a.SessionSecret) < 32 {
+		problems = append(problems, "auth.session_secret: must be at least 32 characters long in session mode")
+	}
+	if len(a.TelegramLogin.Users) > 0 {
+		if c.Telegram.Token == "" {
+			problems = append(problems, "auth.telegram_login: requires telegram.token")
+		}
+		if a.TelegramLogin.Bot == "" {
+			problems = append(problems, "auth.telegram_login.bot: is required")
+		}
+	}
+	return problems
+}
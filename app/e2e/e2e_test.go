@@ -0,0 +1,305 @@
+// Package e2e runs the web server, the job queue and the real Telegram client against the fake Bot API.
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/send/telegramtest"
+	"github.com/meesooqa/files2tg/app/web"
+)
+
+// fakeVIProvider treats every *.mp4 file as a video, ffprobe is not required
+type fakeVIProvider struct{}
+
+func (fakeVIProvider) GetVideoInfo(path string) (*finder.VideoInfo, error) {
+	if filepath.Ext(path) != ".mp4" {
+		return nil, errors.New("not a video")
+	}
+	return &finder.VideoInfo{CodecType: "video", Width: 640, Height: 360, Duration: 5}, nil
+}
+
+type env struct {
+	tg    *telegramtest.Server
+	web   *httptest.Server
+	files string
+}
+
+func newEnv(t *testing.T, names ...string) *env {
+	t.Helper()
+	return newEnvWith(t, nil, names...)
+}
+
+// newEnvWith creates the environment with the client options changed by setup
+func newEnvWith(t *testing.T, setup func(opts *send.Options), names ...string) *env {
+	t.Helper()
+	e := &env{tg: telegramtest.NewServer(), files: t.TempDir()}
+	t.Cleanup(e.tg.Close)
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(e.files, name), []byte("video "+name), 0o600))
+	}
+
+	opts := &send.Options{
+		Server:       e.tg.URL,
+		Token:        telegramtest.Token,
+		Timeout:      5 * time.Second,
+		Channel:      "@main",
+		Destinations: []send.Destination{{Name: "main", Chat: "@main"}, {Name: "other", Chat: "-100500"}},
+		Caption:      "<b>{{.Title}}</b>",
+	}
+	if setup != nil {
+		setup(opts)
+	}
+	client, err := send.NewTelegramClient(opts)
+	require.NoError(t, err)
+
+	jq := job.NewJobQueue()
+	go job.Worker(1, jq)
+	server := web.NewServer(jq, client)
+	server.FilesDirs = []string{e.files}
+	server.VideoInfoProvider = fakeVIProvider{}
+	handler, err := server.Handler()
+	require.NoError(t, err)
+	e.web = httptest.NewServer(handler)
+	t.Cleanup(e.web.Close)
+	return e
+}
+
+type jobResponse struct {
+	ID     string        `json:"id"`
+	Status job.JobStatus `json:"status"`
+	Error  string        `json:"error"`
+}
+
+// enqueue posts the jobs request and returns the created jobs
+func (e *env) enqueue(t *testing.T, body string) []jobResponse {
+	t.Helper()
+	body = strings.ReplaceAll(body, "$DIR", e.files)
+	resp, err := http.Post(e.web.URL+"/api/v1/jobs", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+	var jobs []jobResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&jobs))
+	return jobs
+}
+
+// wait returns the job once it is finished
+func (e *env) wait(t *testing.T, id string) jobResponse {
+	t.Helper()
+	var j jobResponse
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(e.web.URL + "/api/v1/jobs/" + id)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		j = jobResponse{}
+		if json.NewDecoder(resp.Body).Decode(&j) != nil {
+			return false
+		}
+		return j.Status == job.StatusDone || j.Status == job.StatusFailed
+	}, 5*time.Second, 10*time.Millisecond)
+	return j
+}
+
+func TestE2E_SendFreeAndPaidVideos(t *testing.T) {
+	e := newEnv(t, "a.mp4", "b.mp4")
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4"},{"path":"$DIR/b.mp4","stars":5,"destination":"other"}]}`)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, job.StatusDone, e.wait(t, jobs[0].ID).Status)
+	assert.Equal(t, job.StatusDone, e.wait(t, jobs[1].ID).Status)
+
+	videos := e.tg.Requests("sendVideo")
+	require.Len(t, videos, 1)
+	p := videos[0].Params
+	assert.Equal(t, "@main", p["chat_id"])
+	assert.Equal(t, "<b>a</b>", p["caption"])
+	assert.Equal(t, "HTML", p["parse_mode"])
+	assert.Equal(t, "true", p["supports_streaming"])
+	assert.Equal(t, "640", p["width"])
+	assert.Equal(t, "5", p["duration"])
+	assert.Equal(t, telegramtest.File{Name: "a.mp4", Data: []byte("video a.mp4")}, videos[0].Files["video"])
+
+	paid := e.tg.Requests("sendPaidMedia")
+	require.Len(t, paid, 1)
+	p = paid[0].Params
+	assert.Equal(t, "-100500", p["chat_id"])
+	assert.Equal(t, "5", p["star_count"])
+	assert.Equal(t, "<b>b</b>", p["caption"])
+	assert.Equal(t, "HTML", p["parse_mode"])
+	assert.Contains(t, p["media"], `"media":"attach://0"`)
+	assert.Equal(t, "b.mp4", paid[0].Files["0"].Name)
+}
+
+func TestE2E_TooLargeFallsBackToText(t *testing.T) {
+	e := newEnv(t, "a.mp4")
+	e.tg.FailNext("sendVideo", telegramtest.EntityTooLarge())
+
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4","caption":"<i>big</i> one"}]}`)
+	assert.Equal(t, job.StatusDone, e.wait(t, jobs[0].ID).Status)
+
+	messages := e.tg.Requests("sendMessage")
+	require.Len(t, messages, 1)
+	assert.Equal(t, "<i>big</i> one", messages[0].Params["text"])
+	assert.Equal(t, "HTML", messages[0].Params["parse_mode"])
+	assert.Equal(t, "true", messages[0].Params["disable_web_page_preview"])
+}
+
+func TestE2E_UploadLimit(t *testing.T) {
+	e := newEnv(t, "a.mp4")
+	e.tg.MaxUploadSize = 10
+
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4"}]}`)
+	assert.Equal(t, job.StatusDone, e.wait(t, jobs[0].ID).Status)
+	assert.Len(t, e.tg.Requests("sendVideo"), 0, "rejected uploads are not recorded")
+	assert.Len(t, e.tg.Requests("sendMessage"), 1)
+}
+
+func TestE2E_FloodFailsAndRetrySucceeds(t *testing.T) {
+	e := newEnv(t, "a.mp4")
+	e.tg.FailNext("sendVideo", telegramtest.TooManyRequests(3))
+
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4"}]}`)
+	j := e.wait(t, jobs[0].ID)
+	assert.Equal(t, job.StatusFailed, j.Status)
+	assert.Contains(t, j.Error, "retry after 3")
+
+	resp, err := http.Post(e.web.URL+"/api/v1/jobs/"+jobs[0].ID+"/retry", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, job.StatusDone, e.wait(t, jobs[0].ID).Status)
+	assert.Len(t, e.tg.Requests("sendVideo"), 2)
+}
+
+func TestE2E_Errors(t *testing.T) {
+	e := newEnv(t, "a.mp4", "b.mp4")
+	e.tg.Chats = []string{"@main"}
+
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4","destination":"@unknown"}]}`)
+	j := e.wait(t, jobs[0].ID)
+	assert.Equal(t, job.StatusFailed, j.Status)
+	assert.Contains(t, j.Error, "chat not found")
+
+	// captions are validated before sending, so the server rejects a valid one
+	e.tg.FailNext("sendVideo", telegramtest.Failure{Code: http.StatusBadRequest, Description: "Bad Request: can't parse entities: unsupported start tag"})
+	jobs = e.enqueue(t, `{"files":[{"path":"$DIR/b.mp4","caption":"<b>x</b>"}]}`)
+	j = e.wait(t, jobs[0].ID)
+	assert.Equal(t, job.StatusFailed, j.Status)
+	assert.Contains(t, j.Error, "invalid caption: ")
+	assert.Contains(t, j.Error, "can't parse entities")
+}
+
+func TestE2E_PreflightSizeCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback send.Fallback
+		status   job.JobStatus
+		text     string
+	}{
+		{"text", send.FallbackText, job.StatusDone, "<b>a</b>"},
+		{"link", send.FallbackLink, job.StatusDone, "<b>a</b>\n\n" + `<a href="https://files.example.com/v/a.mp4">a.mp4</a>`},
+		{"fail", send.FallbackFail, job.StatusFailed, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEnvWith(t, func(opts *send.Options) {
+				opts.MaxUploadSize = 5
+				opts.Fallback = tt.fallback
+				opts.LinkURL = "https://files.example.com/v/"
+			}, "a.mp4")
+
+			jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4"}]}`)
+			j := e.wait(t, jobs[0].ID)
+			assert.Equal(t, tt.status, j.Status)
+			assert.Empty(t, e.tg.Requests("sendVideo"), "the upload isn't even tried")
+
+			messages := e.tg.Requests("sendMessage")
+			if tt.text == "" {
+				assert.Empty(t, messages)
+				assert.Contains(t, j.Error, "file is too large")
+				return
+			}
+			require.Len(t, messages, 1)
+			assert.Equal(t, tt.text, messages[0].Params["text"])
+		})
+	}
+}
+
+func TestE2E_LongCaption(t *testing.T) {
+	long := strings.Repeat("<b>word</b> ", 300)
+	for _, overflow := range []send.CaptionOverflow{send.OverflowTruncate, send.OverflowReply} {
+		t.Run(string(overflow), func(t *testing.T) {
+			e := newEnvWith(t, func(opts *send.Options) {
+				opts.Caption = long
+				opts.CaptionOverflow = overflow
+			}, "a.mp4")
+
+			jobs := e.enqueue(t, `{"files":[{"path":"$DIR/a.mp4"}]}`)
+			assert.Equal(t, job.StatusDone, e.wait(t, jobs[0].ID).Status)
+
+			videos := e.tg.Requests("sendVideo")
+			require.Len(t, videos, 1)
+			caption := videos[0].Params["caption"]
+			assert.LessOrEqual(t, send.CaptionLength(caption, tb.ModeHTML), send.MaxCaptionLength)
+			assert.True(t, strings.HasSuffix(caption, "word</b>…"), caption)
+
+			replies := e.tg.Requests("sendMessage")
+			if overflow == send.OverflowTruncate {
+				assert.Empty(t, replies)
+				return
+			}
+			require.Len(t, replies, 1)
+			assert.Equal(t, "1", replies[0].Params["reply_to_message_id"])
+			assert.True(t, strings.HasPrefix(replies[0].Params["text"], "<b>word</b>"), replies[0].Params["text"])
+			assert.Equal(t, 300, strings.Count(caption+replies[0].Params["text"], "word"))
+		})
+	}
+}
+
+func TestE2E_EscapedCaption(t *testing.T) {
+	e := newEnvWith(t, func(opts *send.Options) {
+		opts.Destinations = append(opts.Destinations, send.Destination{Name: "md", Chat: "@md", ParseMode: tb.ModeMarkdownV2, Caption: "*{{.Title}}*"})
+	}, "Tom & Jerry <1.5>.mp4", "x_y (1).mp4")
+
+	jobs := e.enqueue(t, `{"files":[{"path":"$DIR/Tom & Jerry <1.5>.mp4"},{"path":"$DIR/x_y (1).mp4","destination":"md"}]}`)
+	for _, j := range jobs {
+		assert.Equal(t, job.StatusDone, e.wait(t, j.ID).Status)
+	}
+	videos := e.tg.Requests("sendVideo")
+	require.Len(t, videos, 2)
+	assert.Equal(t, "<b>Tom &amp; Jerry &lt;1.5&gt;</b>", videos[0].Params["caption"])
+	assert.Equal(t, "HTML", videos[0].Params["parse_mode"])
+	assert.Equal(t, `*x\_y \(1\)*`, videos[1].Params["caption"])
+	assert.Equal(t, "MarkdownV2", videos[1].Params["parse_mode"])
+}
+
+func TestE2E_InvalidCaption(t *testing.T) {
+	e := newEnv(t, "a.mp4")
+	body := strings.NewReader(`{"files":[{"path":"` + filepath.Join(e.files, "a.mp4") + `","caption":"<div>a</div>"}]}`)
+	resp, err := http.Post(e.web.URL+"/api/v1/jobs", "application/json", body)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+	var apiErr struct {
+		Error struct{ Code string } `json:"error"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&apiErr))
+	assert.Equal(t, "invalid_caption", apiErr.Error.Code)
+	assert.Empty(t, e.tg.Requests("sendVideo", "sendMessage"))
+}
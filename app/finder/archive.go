@@ -0,0 +1,442 @@
+package finder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"cmp"
+	"compress/gzip"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxAlbumSize is the number of files Telegram allows in an album
+const MaxAlbumSize = 10
+
+// ArchiveFile is the origin of a file extracted from an archive
+type ArchiveFile struct {
+	Archive string `json:"archive"`
+	// Entry is the slash-separated path inside the archive
+	Entry string `json:"entry"`
+	// Pending is true until the file is extracted by Archives.Extract
+	Pending bool `json:"pending,omitempty"`
+}
+
+// Archives lists the files of the ZIP and TAR archives matching a pattern, a file is extracted into
+// a work directory by the job sending it, so it is probed and sent like the local files
+type Archives struct {
+	Name string
+	// Pattern is the path or the glob of the .zip, .tar, .tar.gz or .tgz files
+	Pattern string
+	// WorkDir keeps the extracted files in a directory per archive,
+	// an entry is pending again when its size or modification time change
+	WorkDir string
+	// Album groups the files of each archive, they are sent together
+	Album bool
+}
+
+// IsArchive reports whether the file is a supported archive by its extension
+func IsArchive(name string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenArchive returns the file system of a ZIP or TAR archive, it is closed by the returned closer
+func OpenArchive(name string) (fs.FS, io.Closer, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case strings.HasSuffix(lower, ".tar"):
+		t, err := newTarFS(name, false)
+		return t, t, err
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		t, err := newTarFS(name, true)
+		return t, t, err
+	}
+	return nil, nil, fmt.Errorf("unsupported archive %s, use .zip, .tar, .tar.gz or .tgz", name)
+}
+
+// Fetch lists the entries of the matching archives, the directories of the archives which don't match anymore
+// are removed. The videos are pending unless their copy is extracted already, only the sidecars are extracted.
+// The files are grouped by archive in the order of the archive names.
+// The archives and the sidecars which can't be read are added to the report.
+func (a *Archives) Fetch() ([]File, ScanReport, error) {
+	var report ScanReport
+	paths, err := filepath.Glob(a.Pattern)
+	if err != nil {
+		return nil, report, errors.Wrapf(err, "failed to match archives of %s", a.Name)
+	}
+	if err = os.MkdirAll(a.WorkDir, 0o755); err != nil {
+		return nil, report, errors.Wrap(err, "failed to create work directory")
+	}
+
+	var files []File
+	dirs := map[string]bool{}
+	for _, p := range paths {
+		if !IsArchive(p) {
+			continue
+		}
+		dir := archiveDir(p)
+		dirs[dir] = true
+		archiveFiles, err := a.list(p, filepath.Join(a.WorkDir, dir), &report)
+		if err != nil {
+			report.Add(p, err)
+			continue
+		}
+		files = append(files, archiveFiles...)
+	}
+	a.prune(dirs)
+	return files, report, nil
+}
+
+// list returns the files of the archive in dir, extracts the sidecars and removes the files not in the archive
+func (a *Archives) list(name, dir string, report *ScanReport) ([]File, error) {
+	fsys, closer, err := OpenArchive(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive")
+	}
+	defer closer.Close()
+
+	var entries []string
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case p != "." && (strings.HasPrefix(d.Name(), ".") || d.Name() == "__MACOSX"):
+			// hidden files and the resource forks of macOS
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		case d.Type().IsRegular():
+			entries = append(entries, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read archive")
+	}
+	if t, ok := fsys.(*tarFS); ok {
+		// a TAR archive is read forward only
+		t.sortByPosition(entries)
+	}
+
+	album := ""
+	if a.Album {
+		album = name
+	}
+	files := make([]File, 0, len(entries))
+	listed := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		info, err := fs.Stat(fsys, entry)
+		if err != nil {
+			report.Add(name+":"+entry, err)
+			continue
+		}
+		local := filepath.Join(dir, filepath.FromSlash(entry))
+		listed[local] = true
+		// the sidecars are small and read by the scan
+		if strings.HasSuffix(entry, sidecarExt) {
+			open := func() (io.ReadCloser, error) { return fsys.Open(entry) }
+			if err := fetch(name+":"+entry, local, info.Size(), info.ModTime(), open); err != nil {
+				report.Add(name+":"+entry, err)
+				continue
+			}
+		}
+		files = append(files, File{
+			Name:    path.Base(entry),
+			ModTime: info.ModTime(),
+			Size:    info.Size(),
+			Path:    local,
+			Archive: &ArchiveFile{Archive: name, Entry: entry, Pending: !fresh(local, info.Size(), info.ModTime())},
+			Album:   album,
+		})
+	}
+	pruneFiles(dir, listed)
+	return files, nil
+}
+
+// Matches tells if the archive matches the pattern of the archives
+func (a *Archives) Matches(archive string) bool {
+	ok, err := filepath.Match(a.Pattern, archive)
+	return err == nil && ok
+}
+
+// Extract copies the pending file of the archive to its path in the work directory
+// and returns the extracted file
+func (a *Archives) Extract(file File) (File, error) {
+	if file.Archive == nil || !a.Matches(file.Archive.Archive) {
+		return file, fmt.Errorf("%s is not a file of %s", file.Path, a.Name)
+	}
+	origin := file.Archive.Archive + ":" + file.Archive.Entry
+	fsys, closer, err := OpenArchive(file.Archive.Archive)
+	if err != nil {
+		return file, errors.Wrapf(err, "failed to open archive %s", file.Archive.Archive)
+	}
+	defer closer.Close()
+	open := func() (io.ReadCloser, error) { return fsys.Open(file.Archive.Entry) }
+	if err := fetch(origin, file.Path, file.Size, file.ModTime, open); err != nil {
+		return file, errors.Wrapf(err, "failed to extract %s", origin)
+	}
+	archive := *file.Archive
+	archive.Pending = false
+	file.Archive = &archive
+	return file, nil
+}
+
+// archiveDir returns the name of the directory of the extracted archive,
+// the hash of the path tells apart the archives with the same name
+func archiveDir(name string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	return fmt.Sprintf("%s-%08x", filepath.Base(name), h.Sum32())
+}
+
+// prune removes the directories of the archives which don't match the pattern anymore
+func (a *Archives) prune(dirs map[string]bool) {
+	entries, err := os.ReadDir(a.WorkDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || dirs[entry.Name()] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(a.WorkDir, entry.Name())); err != nil {
+			log.Printf("[WARN] can't remove %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// pruneFiles removes the files of dir which aren't listed
+func pruneFiles(dir string, listed map[string]bool) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || listed[p] {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			log.Printf("[WARN] can't remove %s: %v", p, err)
+		}
+		return nil
+	})
+}
+
+// Albums groups the consecutive files of the same album by at most MaxAlbumSize files,
+// a file without an album is a group of its own
+func Albums(files []File) [][]File {
+	var groups [][]File
+	for i, file := range files {
+		last := len(groups) - 1
+		if i > 0 && file.Album != "" && file.Album == files[i-1].Album && len(groups[last]) < MaxAlbumSize {
+			groups[last] = append(groups[last], file)
+			continue
+		}
+		groups = append(groups, []File{file})
+	}
+	return groups
+}
+
+// tarFS is a read-only file system of a TAR archive, gzipped or not. The archive is read forward:
+// opening a file stored before the last opened one reads the archive from the start again,
+// and an opened file is valid until the next Open.
+type tarFS struct {
+	name    string
+	gzipped bool
+	// files are the regular files by their paths, dirs are the entries of the directories
+	files map[string]tarEntry
+	dirs  map[string][]fs.DirEntry
+
+	mu  sync.Mutex
+	f   *os.File
+	tr  *tar.Reader
+	pos int // position of the next header of tr
+}
+
+type tarEntry struct {
+	info fs.FileInfo
+	pos  int
+}
+
+// newTarFS reads the headers of the archive
+func newTarFS(name string, gzipped bool) (*tarFS, error) {
+	t := &tarFS{name: name, gzipped: gzipped, files: map[string]tarEntry{}, dirs: map[string][]fs.DirEntry{".": nil}}
+	if err := t.rewind(); err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	for {
+		hdr, err := t.next()
+		if errors.Is(err, io.EOF) {
+			return t, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		p := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if !fs.ValidPath(p) || p == "." {
+			// the names escaping the archive are ignored like in the file system of a ZIP archive
+			continue
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			t.addDir(p)
+		case tar.TypeReg:
+			if _, ok := t.files[p]; !ok {
+				t.addDir(path.Dir(p))
+				dir := path.Dir(p)
+				t.dirs[dir] = append(t.dirs[dir], fs.FileInfoToDirEntry(hdr.FileInfo()))
+			}
+			// the later copy of a file replaces the earlier one like on extraction by tar
+			t.files[p] = tarEntry{info: hdr.FileInfo(), pos: t.pos - 1}
+		}
+	}
+}
+
+// addDir adds the directory and its parents
+func (t *tarFS) addDir(p string) {
+	for ; p != "."; p = path.Dir(p) {
+		if _, ok := t.dirs[p]; ok {
+			return
+		}
+		t.dirs[p] = nil
+		parent := path.Dir(p)
+		t.dirs[parent] = append(t.dirs[parent], fs.FileInfoToDirEntry(dirInfo(path.Base(p))))
+	}
+}
+
+// rewind opens the archive from the start
+func (t *tarFS) rewind() error {
+	t.Close()
+	f, err := os.Open(t.name)
+	if err != nil {
+		return err
+	}
+	var r io.Reader = f
+	if t.gzipped {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		r = gz
+	}
+	t.f, t.tr, t.pos = f, tar.NewReader(r), 0
+	return nil
+}
+
+func (t *tarFS) next() (*tar.Header, error) {
+	hdr, err := t.tr.Next()
+	if err == nil {
+		t.pos++
+	}
+	return hdr, err
+}
+
+func (t *tarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if _, ok := t.dirs[name]; ok {
+		return &tarFile{info: dirInfo(path.Base(name))}, nil
+	}
+	entry, ok := t.files[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tr == nil || t.pos > entry.pos {
+		if err := t.rewind(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	for t.pos <= entry.pos {
+		if _, err := t.next(); err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	return &tarFile{info: entry.info, r: t.tr}, nil
+}
+
+func (t *tarFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, ok := t.dirs[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int { return cmp.Compare(a.Name(), b.Name()) })
+	return entries, nil
+}
+
+func (t *tarFS) Stat(name string) (fs.FileInfo, error) {
+	if _, ok := t.dirs[name]; ok {
+		return dirInfo(path.Base(name)), nil
+	}
+	if entry, ok := t.files[name]; ok {
+		return entry.info, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// sortByPosition orders the files as they are stored in the archive
+func (t *tarFS) sortByPosition(names []string) {
+	slices.SortFunc(names, func(a, b string) int { return cmp.Compare(t.files[a].pos, t.files[b].pos) })
+}
+
+// Close closes the archive, it is opened again by Open
+func (t *tarFS) Close() error {
+	if t.f == nil {
+		return nil
+	}
+	err := t.f.Close()
+	t.f, t.tr = nil, nil
+	return err
+}
+
+// tarFile is a file or a directory of tarFS, the file is read from the archive reader
+type tarFile struct {
+	info fs.FileInfo
+	r    io.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *tarFile) Read(b []byte) (int, error) {
+	if f.r == nil {
+		return 0, &fs.PathError{Op: "read", Path: f.info.Name(), Err: fs.ErrInvalid}
+	}
+	return f.r.Read(b)
+}
+
+func (f *tarFile) Close() error { return nil }
+
+// dirInfo is a directory implied by the paths of the archive
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
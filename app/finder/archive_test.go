@@ -0,0 +1,173 @@
+package finder
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type archiveEntry struct {
+	name, data string
+	modTime    time.Time
+}
+
+func writeZip(t *testing.T, name string, entries ...archiveEntry) {
+	t.Helper()
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: e.modTime})
+		require.NoError(t, err)
+		_, err = io.WriteString(w, e.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+}
+
+func writeTar(t *testing.T, name string, gzipped bool, entries ...archiveEntry) {
+	t.Helper()
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), ModTime: e.modTime}))
+		_, err = io.WriteString(tw, e.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	if gz != nil {
+		require.NoError(t, gz.Close())
+	}
+	require.NoError(t, f.Close())
+}
+
+func TestOpenArchive_Tar(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "clips.tar.gz")
+	writeTar(t, name, true,
+		archiveEntry{name: "clips/b.mp4", data: "video b", modTime: time.Unix(100, 0)},
+		archiveEntry{name: "a.mp4", data: "video a", modTime: time.Unix(200, 0)},
+		archiveEntry{name: "../evil.mp4", data: "evil", modTime: time.Unix(200, 0)},
+	)
+	fsys, closer, err := OpenArchive(name)
+	require.NoError(t, err)
+	defer closer.Close()
+
+	var paths []string
+	require.NoError(t, fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		paths = append(paths, p)
+		return err
+	}))
+	assert.Equal(t, []string{".", "a.mp4", "clips", "clips/b.mp4"}, paths)
+
+	// the files are read in any order
+	for _, e := range []struct{ name, data string }{{"a.mp4", "video a"}, {"clips/b.mp4", "video b"}, {"a.mp4", "video a"}} {
+		data, err := fs.ReadFile(fsys, e.name)
+		require.NoError(t, err)
+		assert.Equal(t, e.data, string(data))
+	}
+	info, err := fs.Stat(fsys, "clips/b.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), info.Size())
+	assert.True(t, info.ModTime().Equal(time.Unix(100, 0)))
+	_, err = fsys.Open("evil.mp4")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	_, _, err = OpenArchive("clips.rar")
+	assert.ErrorContains(t, err, "unsupported archive")
+}
+
+func TestScanArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeZip(t, filepath.Join(dir, "1-first.zip"),
+		archiveEntry{name: "b.mp4", data: "video b", modTime: time.Unix(200, 0)},
+		archiveEntry{name: "clips/a.mp4", data: "video a", modTime: time.Unix(100, 0)},
+		archiveEntry{name: "__MACOSX/._a.mp4", data: "fork", modTime: time.Unix(100, 0)},
+		archiveEntry{name: "notes.txt", data: "notes", modTime: time.Unix(100, 0)},
+	)
+	writeTar(t, filepath.Join(dir, "2-second.tar"), false,
+		archiveEntry{name: "c.mp4", data: "video c", modTime: time.Unix(50, 0)},
+	)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "3-third.txt"), []byte("text"), 0o600))
+	a := &Archives{Name: "zips", Pattern: filepath.Join(dir, "*"), WorkDir: t.TempDir(), Album: true}
+	p := NewProvider(failingFor{"notes.txt": assert.AnError})
+
+	files, report, err := p.ScanArchives(a)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.mp4", "b.mp4", "c.mp4"}, names(files), "the files are grouped by archive")
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, filepath.Join(dir, "1-first.zip")+":notes.txt", report.Skipped[0].Path)
+	assert.Equal(t, &ArchiveFile{Archive: filepath.Join(dir, "1-first.zip"), Entry: "clips/a.mp4", Pending: true}, files[0].Archive)
+	assert.Equal(t, filepath.Join(dir, "1-first.zip"), files[0].Album)
+	assert.Equal(t, files[0].Album, files[1].Album)
+	assert.Equal(t, filepath.Join(dir, "2-second.tar"), files[2].Album)
+	assert.NoFileExists(t, files[0].Path, "the file is extracted by the job")
+
+	extracted, err := a.Extract(files[0])
+	require.NoError(t, err)
+	assert.False(t, extracted.Pending())
+	data, err := os.ReadFile(extracted.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "video a", string(data))
+	info, err := os.Stat(extracted.Path)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(time.Unix(100, 0)))
+	_, err = a.Extract(files[1])
+	require.NoError(t, err)
+	_, err = (&Archives{Name: "other", Pattern: filepath.Join(dir, "*.tar")}).Extract(files[0])
+	assert.ErrorContains(t, err, "is not a file of other")
+
+	// the extracted files are probed on the next scan
+	files, _, err = p.ScanArchives(a)
+	require.NoError(t, err)
+	assert.False(t, files[0].Pending())
+	assert.True(t, files[2].Pending())
+
+	// the changed entries are pending again, the removed entries and archives are pruned
+	writeZip(t, filepath.Join(dir, "1-first.zip"),
+		archiveEntry{name: "clips/a.mp4", data: "video a, edited", modTime: time.Unix(300, 0)},
+	)
+	require.NoError(t, os.Remove(filepath.Join(dir, "2-second.tar")))
+	files, _, err = p.ScanArchives(a)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a.mp4"}, names(files))
+	require.True(t, files[0].Pending())
+	extracted, err = a.Extract(files[0])
+	require.NoError(t, err)
+	data, err = os.ReadFile(extracted.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "video a, edited", string(data))
+	dirs, err := os.ReadDir(a.WorkDir)
+	require.NoError(t, err)
+	assert.Len(t, dirs, 1)
+	_, err = os.Stat(filepath.Join(filepath.Dir(files[0].Path), "..", "b.mp4"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestAlbums(t *testing.T) {
+	files := []File{{Name: "a"}, {Name: "b", Album: "x"}, {Name: "c", Album: "x"}, {Name: "d", Album: "y"}, {Name: "e"}, {Name: "f"}}
+	for range MaxAlbumSize + 1 {
+		files = append(files, File{Name: "z", Album: "z"})
+	}
+	var sizes []int
+	for _, group := range Albums(files) {
+		sizes = append(sizes, len(group))
+	}
+	assert.Equal(t, []int{1, 2, 1, 1, 1, MaxAlbumSize, 1}, sizes)
+}
@@ -0,0 +1,133 @@
+package finder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// cacheVersion is bumped when VideoInfo changes, the cache of another version is dropped
+const cacheVersion = 1
+
+// Saver is a VIProvider keeping its state between the runs
+type Saver interface {
+	Save() error
+}
+
+// CachedProvider remembers the video info of the files until their size or modification time change.
+// The failures are not cached, so a missing ffprobe doesn't hide the files forever.
+type CachedProvider struct {
+	Provider VIProvider
+	// Path of the cache file, the cache is kept in memory only if empty
+	Path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	dirty   bool
+}
+
+type cacheEntry struct {
+	Size    int64      `json:"size"`
+	ModTime time.Time  `json:"mod_time"`
+	Info    *VideoInfo `json:"info"`
+}
+
+type cacheFile struct {
+	Version int                   `json:"version"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// NewCachedProvider creates the cache of the provider loaded from the file at path.
+// A missing or broken cache file is not an error, the files are probed again.
+func NewCachedProvider(provider VIProvider, path string) *CachedProvider {
+	c := &CachedProvider{Provider: provider, Path: path, entries: map[string]cacheEntry{}}
+	if path == "" {
+		return c
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[WARN] can't read probe cache: %v", err)
+		}
+		return c
+	}
+	var cf cacheFile
+	if err = json.Unmarshal(data, &cf); err != nil || cf.Version != cacheVersion {
+		log.Printf("[INFO] probe cache %s is dropped: version %d, %v", path, cf.Version, err)
+		return c
+	}
+	if cf.Entries != nil {
+		c.entries = cf.Entries
+	}
+	return c
+}
+
+func (c *CachedProvider) GetVideoInfo(path string) (*VideoInfo, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[path]
+	c.mu.Unlock()
+	if ok && entry.Size == stat.Size() && entry.ModTime.Equal(stat.ModTime()) && entry.Info != nil {
+		return cloneInfo(entry.Info), nil
+	}
+
+	info, err := c.Provider.GetVideoInfo(path)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[path] = cacheEntry{Size: stat.Size(), ModTime: stat.ModTime(), Info: cloneInfo(info)}
+	c.dirty = true
+	c.mu.Unlock()
+	return info, nil
+}
+
+// cloneInfo copies the video info with its audio streams, so the callers can't change the cached one
+func cloneInfo(info *VideoInfo) *VideoInfo {
+	c := *info
+	c.Audio = slices.Clone(info.Audio)
+	return &c
+}
+
+// Save writes the cache file if anything is probed since the last save,
+// the entries of the deleted files are dropped
+func (c *CachedProvider) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Path == "" || !c.dirty {
+		return nil
+	}
+	for path := range c.entries {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(c.entries, path)
+		}
+	}
+
+	data, err := json.Marshal(cacheFile{Version: cacheVersion, Entries: c.entries})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.Path), 0o755); err != nil {
+		return fmt.Errorf("create probe cache directory: %w", err)
+	}
+	// the cache is replaced at once, so a crash doesn't leave a broken file
+	tmp := c.Path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, c.Path); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
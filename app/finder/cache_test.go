@@ -0,0 +1,168 @@
+package finder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingProvider counts the probes and the probes running at once
+type countingProvider struct {
+	calls, running, maxRunning atomic.Int32
+	delay                      time.Duration
+	err                        error
+}
+
+func (p *countingProvider) GetVideoInfo(path string) (*VideoInfo, error) {
+	p.calls.Add(1)
+	n := p.running.Add(1)
+	defer p.running.Add(-1)
+	for {
+		m := p.maxRunning.Load()
+		if n <= m || p.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(p.delay)
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &VideoInfo{CodecType: "video", Width: 640, Audio: []AudioInfo{{Codec: "aac"}}}, nil
+}
+
+func TestCachedProvider(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("video"), 0o600))
+	cachePath := filepath.Join(dir, "cache", "probe.json")
+
+	probe := &countingProvider{}
+	cache := NewCachedProvider(probe, cachePath)
+	for range 3 {
+		info, err := cache.GetVideoInfo(path)
+		require.NoError(t, err)
+		assert.Equal(t, 640, info.Width)
+	}
+	assert.Equal(t, int32(1), probe.calls.Load())
+	require.NoError(t, cache.Save())
+
+	// the next run reads the cache file
+	probe = &countingProvider{}
+	cache = NewCachedProvider(probe, cachePath)
+	info, err := cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, []AudioInfo{{Codec: "aac"}}, info.Audio)
+	assert.Zero(t, probe.calls.Load())
+
+	// a changed file is probed again
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Hour)))
+	_, err = cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), probe.calls.Load())
+	require.NoError(t, os.WriteFile(path, []byte("longer video"), 0o600))
+	_, err = cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), probe.calls.Load())
+
+	// the deleted files are dropped on save
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, cache.Save())
+	assert.Empty(t, NewCachedProvider(probe, cachePath).entries)
+}
+
+func TestCachedProvider_ReturnsCopies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("video"), 0o600))
+	cache := NewCachedProvider(&countingProvider{}, "")
+
+	probed, err := cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	probed.Audio[0].Codec = "opus"
+	cached, err := cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	cached.Width = 1
+	cached.Audio[0].Language = "eng"
+
+	info, err := cache.GetVideoInfo(path)
+	require.NoError(t, err)
+	assert.Equal(t, 640, info.Width)
+	assert.Equal(t, []AudioInfo{{Codec: "aac"}}, info.Audio)
+}
+
+func TestCachedProvider_FailuresAreNotCached(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	require.NoError(t, os.WriteFile(path, []byte("text"), 0o600))
+
+	probe := &countingProvider{err: errors.New("not a video")}
+	cache := NewCachedProvider(probe, "")
+	for range 2 {
+		_, err := cache.GetVideoInfo(path)
+		require.EqualError(t, err, "not a video")
+	}
+	assert.Equal(t, int32(2), probe.calls.Load())
+	assert.NoError(t, cache.Save(), "the cache without a file is not saved")
+
+	_, err := cache.GetVideoInfo(filepath.Join(dir, "missing.mp4"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCachedProvider_BrokenFile(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "probe.json")
+	require.NoError(t, os.WriteFile(cachePath, []byte(`{"version":0,"entries":{"a.mp4":{}}}`), 0o600))
+	assert.Empty(t, NewCachedProvider(&countingProvider{}, cachePath).entries, "another version is dropped")
+	require.NoError(t, os.WriteFile(cachePath, []byte("{"), 0o600))
+	assert.Empty(t, NewCachedProvider(&countingProvider{}, cachePath).entries)
+}
+
+func TestProvider_ProbesInParallel(t *testing.T) {
+	dir := t.TempDir()
+	for i := range 20 {
+		path := filepath.Join(dir, string(rune('a'+i))+".mp4")
+		require.NoError(t, os.WriteFile(path, []byte("video"), 0o600))
+		modTime := time.Date(2024, 1, 20-i, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	probe := &countingProvider{delay: 10 * time.Millisecond}
+	p := NewProvider(probe)
+	p.Workers = 5
+	files, err := p.GetListFilesSorted(dir, ".")
+	require.NoError(t, err)
+	require.Len(t, files, 20)
+	assert.Equal(t, "t.mp4", files[0].Name, "sorted by modification time")
+	assert.Equal(t, 640, files[19].Info.Width)
+	assert.Equal(t, int32(20), probe.calls.Load())
+	assert.LessOrEqual(t, probe.maxRunning.Load(), int32(5))
+	assert.Greater(t, probe.maxRunning.Load(), int32(1))
+}
+
+// the cache is saved after the scan and used concurrently
+func TestProvider_SavesCache(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+	cachePath := filepath.Join(t.TempDir(), "probe.json")
+	p := NewProvider(NewCachedProvider(&countingProvider{}, cachePath))
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			files, err := p.GetListFilesSorted(dir, ".")
+			assert.NoError(t, err)
+			assert.Len(t, files, 3)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, NewCachedProvider(&countingProvider{}, cachePath).entries, 3)
+}
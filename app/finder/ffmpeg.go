@@ -0,0 +1,19 @@
+package finder
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// RunFFmpeg runs ffmpeg with the arguments and returns its output, the error has the messages of ffmpeg
+func RunFFmpeg(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
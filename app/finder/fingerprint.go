@@ -0,0 +1,230 @@
+package finder
+
+import (
+	"fmt"
+	"log"
+	"math/bits"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Fingerprint is the perceptual hash of a video: the dHashes of the frames sampled along it.
+// Re-encoding changes a dHash by a few bits, so the copies have close fingerprints unlike their content hashes.
+type Fingerprint []uint64
+
+// Fingerprinter makes the fingerprints of the videos
+type Fingerprinter interface {
+	// Fingerprint returns the fingerprint of the video of the duration in seconds
+	Fingerprint(path string, duration int) (Fingerprint, error)
+}
+
+// dHash frames are scaled to dHashWidth x dHashHeight gray pixels, a bit tells if a pixel is brighter than the next one
+const (
+	dHashWidth  = 9
+	dHashHeight = 8
+)
+
+// frameDistance is the most differing bits of the dHashes of the same frame
+const frameDistance = 10
+
+// FFmpegFingerprinter samples the frames with ffmpeg
+type FFmpegFingerprinter struct {
+	// Samples is the number of the frames
+	Samples int
+}
+
+func NewFFmpegFingerprinter() *FFmpegFingerprinter {
+	return &FFmpegFingerprinter{Samples: 10}
+}
+
+func (o *FFmpegFingerprinter) Fingerprint(path string, duration int) (Fingerprint, error) {
+	samples := max(o.Samples, 1)
+	if duration <= 0 {
+		samples = 1
+	}
+	var fp Fingerprint
+	for i := range samples {
+		// the middles of the equal parts, the first and the last frames are often black
+		offset := float64(duration) * (float64(i) + 0.5) / float64(samples)
+		frame, err := o.grab(path, offset)
+		if err != nil {
+			return nil, err
+		}
+		if len(frame) < dHashWidth*dHashHeight {
+			continue
+		}
+		// a flat frame, e.g. a black one, is the same in every video
+		if hash := DHash(frame); hash != 0 {
+			fp = append(fp, hash)
+		}
+	}
+	if len(fp) == 0 {
+		return nil, fmt.Errorf("no distinct frames found in %s", path)
+	}
+	return fp, nil
+}
+
+// grab returns the gray pixels of the frame at offset seconds scaled for DHash
+func (o *FFmpegFingerprinter) grab(path string, offset float64) ([]byte, error) {
+	return RunFFmpeg(
+		"-v", "error",
+		"-ss", strconv.FormatFloat(offset, 'f', 3, 64),
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:%d:flags=area,format=gray", dHashWidth, dHashHeight),
+		"-f", "rawvideo",
+		"-")
+}
+
+// DHash returns the difference hash of dHashWidth x dHashHeight gray pixels
+func DHash(gray []byte) uint64 {
+	var hash uint64
+	for y := range dHashHeight {
+		row := gray[y*dHashWidth : (y+1)*dHashWidth]
+		for x := range dHashWidth - 1 {
+			hash <<= 1
+			if row[x] > row[x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// Similarity returns the share of the frames of the shorter fingerprint with a close frame in the other one,
+// from 0 to 1. The frames are matched at any position, so a trimmed copy is still similar.
+func Similarity(a, b Fingerprint) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	matched := 0
+	for _, x := range a {
+		for _, y := range b {
+			if bits.OnesCount64(x^y) <= frameDistance {
+				matched++
+				break
+			}
+		}
+	}
+	return float64(matched) / float64(len(a))
+}
+
+// Similar is a video similar to an earlier file of the scan or to a sent video
+type Similar struct {
+	Path string `json:"path"`
+	// Of is the path of the similar file
+	Of         string  `json:"of"`
+	Similarity float64 `json:"similarity"`
+	// SentAt is the time the similar video was sent, zero for a file of the scan
+	SentAt time.Time `json:"sent_at,omitzero"`
+}
+
+// SimilarFinder flags the near-duplicates: re-encoded or trimmed copies of a video.
+// The fingerprints are kept while the size and the modification time of a file are the same.
+type SimilarFinder struct {
+	Fingerprinter Fingerprinter
+	// Threshold is the least Similarity of the near-duplicates
+	Threshold float64
+	// History has the fingerprints of the sent videos, the files are compared to each other only if nil
+	History *History
+	// Workers is the number of files fingerprinted at once, 1 if not positive
+	Workers int
+
+	mu           sync.Mutex
+	fingerprints map[string]cachedFingerprint
+}
+
+type cachedFingerprint struct {
+	size        int64
+	modTime     time.Time
+	fingerprint Fingerprint
+}
+
+// NewSimilarFinder creates SimilarFinder with ffmpeg fingerprints
+func NewSimilarFinder(threshold float64, history *History) *SimilarFinder {
+	return &SimilarFinder{
+		Fingerprinter: NewFFmpegFingerprinter(),
+		Threshold:     threshold,
+		History:       history,
+		Workers:       defaultWorkers,
+	}
+}
+
+// Flag sets the fingerprints of the files and adds the files similar to a sent video or to an earlier file
+// to the report, with the most similar one. The files are kept: the report warns before they are enqueued.
+// The pending files of the remote sources aren't fingerprinted.
+func (f *SimilarFinder) Flag(files []File, report *ScanReport) {
+	sem := make(chan struct{}, max(f.Workers, 1))
+	var wg sync.WaitGroup
+	for i := range files {
+		if files[i].Pending() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			fp, err := f.fingerprint(files[i])
+			if err != nil {
+				log.Printf("[WARN] can't fingerprint %s: %v", files[i].Path, err)
+				return
+			}
+			files[i].Fingerprint = fp
+		}()
+	}
+	wg.Wait()
+
+	var sent []SentRecord
+	if f.History != nil {
+		sent = f.History.Records()
+	}
+	for i, file := range files {
+		if len(file.Fingerprint) == 0 {
+			continue
+		}
+		best := Similar{Path: file.Path}
+		for _, record := range sent {
+			if s := Similarity(file.Fingerprint, record.Fingerprint); s >= f.Threshold && s > best.Similarity {
+				best.Of, best.Similarity, best.SentAt = record.Path, s, record.SentAt
+			}
+		}
+		for _, earlier := range files[:i] {
+			if s := Similarity(file.Fingerprint, earlier.Fingerprint); s >= f.Threshold && s > best.Similarity {
+				best.Of, best.Similarity, best.SentAt = earlier.Path, s, time.Time{}
+			}
+		}
+		if best.Of != "" {
+			log.Printf("[WARN] %s is %.0f%% similar to %s", best.Path, best.Similarity*100, best.Of)
+			report.Similar = append(report.Similar, best)
+		}
+	}
+}
+
+// fingerprint returns the fingerprint of the file, it is made again if its size or modification time change
+func (f *SimilarFinder) fingerprint(file File) (Fingerprint, error) {
+	f.mu.Lock()
+	cached, ok := f.fingerprints[file.Path]
+	f.mu.Unlock()
+	if ok && cached.size == file.Size && cached.modTime.Equal(file.ModTime) {
+		return cached.fingerprint, nil
+	}
+	duration := 0
+	if file.Info != nil {
+		duration = file.Info.Duration
+	}
+	fp, err := f.Fingerprinter.Fingerprint(file.Path, duration)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fingerprints == nil {
+		f.fingerprints = map[string]cachedFingerprint{}
+	}
+	f.fingerprints[file.Path] = cachedFingerprint{size: file.Size, modTime: file.ModTime, fingerprint: fp}
+	return fp, nil
+}
@@ -0,0 +1,126 @@
+package finder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDHash(t *testing.T) {
+	// every pixel is brighter than the next one in the odd rows
+	gray := make([]byte, 0, dHashWidth*dHashHeight)
+	for y := range dHashHeight {
+		for x := range dHashWidth {
+			if y%2 == 1 {
+				gray = append(gray, byte(100-x))
+			} else {
+				gray = append(gray, byte(100+x))
+			}
+		}
+	}
+	assert.Equal(t, uint64(0x00ff00ff00ff00ff), DHash(gray))
+	assert.Zero(t, DHash(bytes.Repeat([]byte{50}, dHashWidth*dHashHeight)))
+}
+
+func TestSimilarity(t *testing.T) {
+	a := Fingerprint{0xff00ff00ff00ff00, 0x0f0f0f0f0f0f0f0f, 0x123456789abcdef0, 0xaaaaaaaaaaaaaaaa}
+	reencoded := Fingerprint{0xff00ff00ff00ff01, 0x0f0f0f0f0f0f0f1f, 0x123456789abcdef3, 0xaaaaaaaaaaaaaaab}
+	trimmed := Fingerprint{0x0f0f0f0f0f0f0f0f, 0x123456789abcdef0}
+	other := Fingerprint{0x5555555555555555, 0x00ff00ff00ff00ff}
+
+	assert.InDelta(t, 1.0, Similarity(a, reencoded), 1e-9)
+	assert.InDelta(t, 1.0, Similarity(trimmed, a), 1e-9, "the frames match at any position")
+	assert.InDelta(t, 0.0, Similarity(a, other), 1e-9)
+	assert.InDelta(t, 0.5, Similarity(Fingerprint{0xff00ff00ff00ff00, 0x5555555555555555}, a), 1e-9)
+	assert.Zero(t, Similarity(nil, a))
+}
+
+func TestFFmpegFingerprinter(t *testing.T) {
+	offsets := filepath.Join(t.TempDir(), "offsets")
+	// the frame is a gradient unless the offset starts with 9, then it's flat
+	createFakeFFmpeg(t, `echo "$4" >> `+offsets+`
+case "$4" in 9*) printf '%072d' 0 ;; *) printf '987654321%.0s' 1 2 3 4 5 6 7 8 ;; esac`)
+
+	fp, err := (&FFmpegFingerprinter{Samples: 4}).Fingerprint("dummy.mp4", 20)
+	require.NoError(t, err)
+	assert.Equal(t, Fingerprint{0xffffffffffffffff, 0xffffffffffffffff, 0xffffffffffffffff, 0xffffffffffffffff}, fp)
+	data, err := os.ReadFile(offsets)
+	require.NoError(t, err)
+	assert.Equal(t, "2.500\n7.500\n12.500\n17.500\n", string(data))
+
+	fp, err = (&FFmpegFingerprinter{Samples: 4}).Fingerprint("dummy.mp4", 0)
+	require.NoError(t, err)
+	assert.Len(t, fp, 1, "a single frame of a video of unknown duration")
+
+	_, err = (&FFmpegFingerprinter{Samples: 1}).Fingerprint("dummy.mp4", 19)
+	assert.ErrorContains(t, err, "no distinct frames")
+}
+
+// fakeFingerprinter returns the fingerprints by file name
+type fakeFingerprinter map[string]Fingerprint
+
+func (f fakeFingerprinter) Fingerprint(path string, duration int) (Fingerprint, error) {
+	if fp, ok := f[filepath.Base(path)]; ok {
+		return fp, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func TestSimilarFinder(t *testing.T) {
+	history, err := NewHistory(filepath.Join(t.TempDir(), "history.json"))
+	require.NoError(t, err)
+	sentAt := time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)
+	require.NoError(t, history.Add(File{Path: "/sent/old.mp4", Name: "old.mp4", Fingerprint: Fingerprint{0x123456789abcdef0, 0xfedcba9876543210}}, sentAt))
+
+	f := &SimilarFinder{
+		Fingerprinter: fakeFingerprinter{
+			"a.mp4":       {0xff00ff00ff00ff00, 0x0f0f0f0f0f0f0f0f},
+			"a-720p.mp4":  {0xff00ff00ff00ff01, 0x0f0f0f0f0f0f0f1f},
+			"unique.mp4":  {0xaaaaaaaaaaaaaaaa},
+			"rerun.mp4":   {0x123456789abcdef0, 0xfedcba9876543210, 0x5555555555555555},
+			"noframe.mp4": nil,
+		},
+		Threshold: 0.9,
+		History:   history,
+	}
+	files := []File{{Path: "a.mp4"}, {Path: "unique.mp4"}, {Path: "a-720p.mp4"}, {Path: "rerun.mp4"}, {Path: "missing.mp4"}}
+	var report ScanReport
+	f.Flag(files, &report)
+
+	assert.Equal(t, []Similar{
+		{Path: "a-720p.mp4", Of: "a.mp4", Similarity: 1},
+		{Path: "rerun.mp4", Of: "/sent/old.mp4", Similarity: 1, SentAt: sentAt},
+	}, report.Similar)
+	assert.Equal(t, Fingerprint{0xff00ff00ff00ff00, 0x0f0f0f0f0f0f0f0f}, files[0].Fingerprint, "the fingerprint is kept for the history")
+	assert.Nil(t, files[4].Fingerprint)
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "history.json")
+	h, err := NewHistory(path)
+	require.NoError(t, err)
+	assert.Empty(t, h.Records())
+
+	sentAt := time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)
+	require.NoError(t, h.Add(File{Path: "a.mp4", Name: "a.mp4", Size: 10, Fingerprint: Fingerprint{42}}, sentAt))
+	require.NoError(t, h.Add(File{Path: "b.mp4", Name: "b.mp4"}, sentAt.Add(time.Hour)))
+
+	loaded, err := NewHistory(path)
+	require.NoError(t, err)
+	assert.Equal(t, []SentRecord{
+		{Path: "a.mp4", Name: "a.mp4", Size: 10, SentAt: sentAt, Fingerprint: Fingerprint{42}},
+		{Path: "b.mp4", Name: "b.mp4", SentAt: sentAt.Add(time.Hour)},
+	}, loaded.Records())
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2}`), 0o600))
+	_, err = NewHistory(path)
+	assert.ErrorContains(t, err, "unsupported version 2")
+	require.NoError(t, os.WriteFile(path, []byte(`{`), 0o600))
+	_, err = NewHistory(path)
+	assert.ErrorContains(t, err, "parse history")
+}
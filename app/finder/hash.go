@@ -0,0 +1,196 @@
+package finder
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Hash algorithms of HashFile
+const (
+	// HashFast hashes the size with the first and the last fastHashChunk bytes, it reads little of large videos
+	HashFast   = "fast"
+	HashSHA256 = "sha256"
+)
+
+// Actions of Deduplicator on the copies of a video
+const (
+	// DuplicatesWarn reports the copies and keeps them
+	DuplicatesWarn = "warn"
+	// DuplicatesKeepFirst keeps the first copy in the order of the scan
+	DuplicatesKeepFirst = "keep_first"
+	// DuplicatesSkip leaves out all the copies
+	DuplicatesSkip = "skip"
+)
+
+// fastHashChunk is the size of the head and the tail hashed by HashFast
+const fastHashChunk = 64 << 10
+
+// HashFile returns the hash of the content of the file prefixed with the algorithm, e.g. "sha256:2c26b4..."
+func HashFile(path, algorithm string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	switch algorithm {
+	case HashSHA256:
+		if _, err = io.Copy(h, f); err != nil {
+			return "", err
+		}
+	case HashFast:
+		info, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		_ = binary.Write(h, binary.BigEndian, info.Size())
+		if _, err = io.CopyN(h, f, fastHashChunk); err != nil && err != io.EOF {
+			return "", err
+		}
+		if tail := info.Size() - fastHashChunk; tail > fastHashChunk {
+			if _, err = io.Copy(h, io.NewSectionReader(f, tail, fastHashChunk)); err != nil {
+				return "", err
+			}
+		} else if tail > 0 {
+			// the tail overlaps the head, the rest of the file is hashed
+			if _, err = io.Copy(h, f); err != nil {
+				return "", err
+			}
+		}
+	default:
+		return "", fmt.Errorf("unknown hash %q, use fast or sha256", algorithm)
+	}
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Duplicates are the files with the same content in the order of the scan
+type Duplicates struct {
+	Hash  string   `json:"hash"`
+	Paths []string `json:"paths"`
+}
+
+// Deduplicator finds the copies of the same video in a scan, the hashes are kept
+// while the size and the modification time of a file are the same
+type Deduplicator struct {
+	// Hash is the algorithm of HashFile
+	Hash string
+	// Action is done with the copies: warn, keep_first or skip
+	Action string
+	// Workers is the number of files hashed at once, 1 if not positive
+	Workers int
+
+	mu     sync.Mutex
+	hashes map[string]fileHash
+}
+
+type fileHash struct {
+	size    int64
+	modTime time.Time
+	hash    string
+}
+
+// NewDeduplicator creates Deduplicator hashing defaultWorkers files at once
+func NewDeduplicator(hash, action string) *Deduplicator {
+	return &Deduplicator{Hash: hash, Action: action, Workers: defaultWorkers}
+}
+
+// Dedup adds the groups of the copies to the report and returns the files without the copies left out by Action,
+// they are added to the skipped files of the report. Only the files of the same size are hashed,
+// the pending files of the remote sources aren't.
+func (d *Deduplicator) Dedup(files []File, report *ScanReport) []File {
+	sizes := make(map[int64]int, len(files))
+	for _, file := range files {
+		sizes[file.Size]++
+	}
+	hashes := make([]string, len(files))
+	sem := make(chan struct{}, max(d.Workers, 1))
+	var wg sync.WaitGroup
+	for i, file := range files {
+		if sizes[file.Size] < 2 || file.Pending() {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			hash, err := d.hash(file)
+			if err != nil {
+				log.Printf("[WARN] can't hash %s: %v", file.Path, err)
+				return
+			}
+			hashes[i] = hash
+		}()
+	}
+	wg.Wait()
+
+	groups := map[string]*Duplicates{}
+	var order []*Duplicates
+	for i, file := range files {
+		if hashes[i] == "" {
+			continue
+		}
+		group, ok := groups[hashes[i]]
+		if !ok {
+			group = &Duplicates{Hash: hashes[i]}
+			groups[hashes[i]] = group
+			order = append(order, group)
+		}
+		group.Paths = append(group.Paths, file.Path)
+	}
+	leftOut := map[string]string{}
+	for _, group := range order {
+		if len(group.Paths) < 2 {
+			continue
+		}
+		report.Duplicates = append(report.Duplicates, *group)
+		log.Printf("[WARN] the same video: %s", strings.Join(group.Paths, ", "))
+		for i, path := range group.Paths {
+			switch {
+			case d.Action == DuplicatesKeepFirst && i > 0:
+				leftOut[path] = "duplicate of " + group.Paths[0]
+			case d.Action == DuplicatesSkip:
+				leftOut[path] = fmt.Sprintf("one of %d copies of the same video", len(group.Paths))
+			}
+		}
+	}
+
+	kept := files[:0]
+	for _, file := range files {
+		if reason, ok := leftOut[file.Path]; ok {
+			report.Skipped = append(report.Skipped, Skipped{Path: file.Path, Reason: reason})
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// hash returns the hash of the file, it is hashed again if its size or modification time change
+func (d *Deduplicator) hash(file File) (string, error) {
+	d.mu.Lock()
+	cached, ok := d.hashes[file.Path]
+	d.mu.Unlock()
+	if ok && cached.size == file.Size && cached.modTime.Equal(file.ModTime) {
+		return cached.hash, nil
+	}
+	hash, err := HashFile(file.Path, d.Hash)
+	if err != nil {
+		return "", err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.hashes == nil {
+		d.hashes = map[string]fileHash{}
+	}
+	d.hashes[file.Path] = fileHash{size: file.Size, modTime: file.ModTime, hash: hash}
+	return hash, nil
+}
@@ -0,0 +1,93 @@
+package finder
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+		return path
+	}
+	big := bytes.Repeat([]byte("a"), 3*fastHashChunk)
+	middle := bytes.Clone(big)
+	middle[len(big)/2] = 'b'
+	tail := bytes.Clone(big)
+	tail[len(big)-1] = 'b'
+
+	hash := func(path, algorithm string) string {
+		h, err := HashFile(path, algorithm)
+		require.NoError(t, err)
+		return h
+	}
+	assert.Equal(t, "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash(write("hello", []byte("hello")), HashSHA256))
+	assert.Contains(t, hash(write("small", []byte("hello")), HashFast), "fast:")
+	assert.Equal(t, hash(write("big", big), HashFast), hash(write("middle", middle), HashFast),
+		"the fast hash doesn't read the middle")
+	assert.NotEqual(t, hash(filepath.Join(dir, "big"), HashFast), hash(write("tail", tail), HashFast))
+	assert.NotEqual(t, hash(filepath.Join(dir, "big"), HashSHA256), hash(filepath.Join(dir, "middle"), HashSHA256))
+	assert.NotEqual(t, hash(write("short", big[:fastHashChunk+10]), HashFast), hash(write("short2", tail[:fastHashChunk+9]), HashFast))
+
+	_, err := HashFile(filepath.Join(dir, "big"), "md5")
+	assert.ErrorContains(t, err, `unknown hash "md5"`)
+}
+
+func TestDeduplicator(t *testing.T) {
+	dir := t.TempDir()
+	var files []File
+	for _, f := range []struct{ name, data string }{{"a.mp4", "video"}, {"b.mp4", "other"}, {"c.mp4", "video"}, {"d.mp4", "unique!"}, {"e.mp4", "video"}} {
+		path := filepath.Join(dir, f.name)
+		require.NoError(t, os.WriteFile(path, []byte(f.data), 0o600))
+		files = append(files, File{Name: f.name, Path: path, Size: int64(len(f.data)), ModTime: time.Unix(100, 0)})
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	tests := []struct {
+		action  string
+		kept    []string
+		skipped []string
+	}{
+		{DuplicatesWarn, []string{"a.mp4", "b.mp4", "c.mp4", "d.mp4", "e.mp4"}, nil},
+		{DuplicatesKeepFirst, []string{"a.mp4", "b.mp4", "d.mp4"}, []string{path("c.mp4"), path("e.mp4")}},
+		{DuplicatesSkip, []string{"b.mp4", "d.mp4"}, []string{path("a.mp4"), path("c.mp4"), path("e.mp4")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var report ScanReport
+			kept := NewDeduplicator(HashSHA256, tt.action).Dedup(append([]File{}, files...), &report)
+			assert.Equal(t, tt.kept, names(kept))
+			require.Len(t, report.Duplicates, 1)
+			assert.Equal(t, []string{path("a.mp4"), path("c.mp4"), path("e.mp4")}, report.Duplicates[0].Paths)
+			var skipped []string
+			for _, s := range report.Skipped {
+				skipped = append(skipped, s.Path)
+			}
+			assert.Equal(t, tt.skipped, skipped)
+		})
+	}
+
+	// the hashes are cached by size and modification time
+	d := NewDeduplicator(HashSHA256, DuplicatesKeepFirst)
+	var report ScanReport
+	d.Dedup(append([]File{}, files...), &report)
+	require.NoError(t, os.WriteFile(path("c.mp4"), []byte("edit!"), 0o600))
+	report = ScanReport{}
+	d.Dedup(append([]File{}, files...), &report)
+	require.Len(t, report.Duplicates, 1, "the cached hash is used for the same modification time")
+	files[2].ModTime = time.Unix(200, 0)
+	report = ScanReport{}
+	kept := d.Dedup(append([]File{}, files...), &report)
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, []string{path("a.mp4"), path("e.mp4")}, report.Duplicates[0].Paths)
+	assert.Equal(t, "duplicate of "+path("a.mp4"), report.Skipped[0].Reason)
+	assert.Len(t, kept, 4)
+}
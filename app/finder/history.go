@@ -0,0 +1,93 @@
+package finder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// historyVersion is bumped when SentRecord changes incompatibly
+const historyVersion = 1
+
+// SentRecord is a sent video
+type SentRecord struct {
+	Path   string    `json:"path"`
+	Name   string    `json:"name"`
+	Size   int64     `json:"size"`
+	SentAt time.Time `json:"sent_at"`
+	// Fingerprint is empty unless the near-duplicates are searched
+	Fingerprint Fingerprint `json:"fingerprint,omitempty"`
+}
+
+// History keeps the sent videos in a JSON file
+type History struct {
+	Path string
+
+	mu      sync.Mutex
+	records []SentRecord
+}
+
+type historyFile struct {
+	Version int          `json:"version"`
+	Sent    []SentRecord `json:"sent"`
+}
+
+// NewHistory loads the history from the file at path, a missing file is an empty history
+func NewHistory(path string) (*History, error) {
+	h := &History{Path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	var hf historyFile
+	if err = json.Unmarshal(data, &hf); err != nil {
+		return nil, fmt.Errorf("parse history %s: %w", path, err)
+	}
+	if hf.Version != historyVersion {
+		return nil, fmt.Errorf("history %s has unsupported version %d", path, hf.Version)
+	}
+	h.records = hf.Sent
+	return h, nil
+}
+
+// Add records the sent file and saves the history
+func (h *History) Add(file File, sentAt time.Time) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, SentRecord{
+		Path:        file.Path,
+		Name:        file.Name,
+		Size:        file.Size,
+		SentAt:      sentAt,
+		Fingerprint: file.Fingerprint,
+	})
+
+	data, err := json.Marshal(historyFile{Version: historyVersion, Sent: h.records})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(h.Path), 0o755); err != nil {
+		return fmt.Errorf("create history directory: %w", err)
+	}
+	// the history is replaced at once, so a crash doesn't leave a broken file
+	tmp := h.Path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.Path)
+}
+
+// Records returns the sent videos in the order of sending
+func (h *History) Records() []SentRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return slices.Clone(h.records)
+}
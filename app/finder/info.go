@@ -2,8 +2,11 @@ package finder
 
 import (
 	"encoding/json"
+	"math"
 	"os/exec"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -12,8 +15,40 @@ type VIProvider interface {
 	GetVideoInfo(path string) (*VideoInfo, error)
 }
 
+// FFProbe is the output of ffprobe -show_streams -show_format
 type FFProbe struct {
-	Streams []VideoInfo `json:"streams"`
+	Streams []FFProbeStream `json:"streams"`
+	Format  FFProbeFormat   `json:"format"`
+}
+
+// FFProbeStream is a stream reported by ffprobe, the numbers are strings as ffprobe prints them
+type FFProbeStream struct {
+	CodecType    string            `json:"codec_type"`
+	CodecName    string            `json:"codec_name"`
+	Profile      string            `json:"profile"`
+	PixFmt       string            `json:"pix_fmt"`
+	Width        int               `json:"width"`
+	Height       int               `json:"height"`
+	Duration     string            `json:"duration"`
+	BitRate      string            `json:"bit_rate"`
+	AvgFrameRate string            `json:"avg_frame_rate"`
+	RFrameRate   string            `json:"r_frame_rate"`
+	Channels     int               `json:"channels"`
+	SampleRate   string            `json:"sample_rate"`
+	Tags         map[string]string `json:"tags"`
+	SideDataList []struct {
+		SideDataType string  `json:"side_data_type"`
+		Rotation     float64 `json:"rotation"`
+	} `json:"side_data_list"`
+}
+
+// FFProbeFormat is the container reported by ffprobe
+type FFProbeFormat struct {
+	FormatName string            `json:"format_name"`
+	Duration   string            `json:"duration"`
+	Size       string            `json:"size"`
+	BitRate    string            `json:"bit_rate"`
+	Tags       map[string]string `json:"tags"`
 }
 
 // VideoInfo involves video file info
@@ -21,10 +56,69 @@ type VideoInfo struct {
 	CodecType   string `json:"codec_type"`
 	DurationRaw string `json:"duration"`
 
+	// Width and Height are the display size, swapped for the videos rotated by 90 or 270 degrees
 	Width  int `json:"width"`
 	Height int `json:"height"`
 	// Duration of the recording in seconds
-	Duration int
+	Duration int `json:"duration_seconds"`
+
+	// Codec, Profile and PixelFormat of the video stream, e.g. h264, High and yuv420p
+	Codec       string `json:"codec,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	PixelFormat string `json:"pixel_format,omitempty"`
+	// FrameRate in frames per second
+	FrameRate float64 `json:"frame_rate,omitempty"`
+	// Rotation in degrees clockwise from the display matrix or the rotate tag
+	Rotation int `json:"rotation,omitempty"`
+	// BitRate of the file in bits per second
+	BitRate int64 `json:"bit_rate,omitempty"`
+	// Container is the format name, e.g. "mov,mp4,m4a,3gp,3g2,mj2"
+	Container string `json:"container,omitempty"`
+	// Size of the file in bytes
+	Size int64 `json:"size,omitempty"`
+	// CreatedAt is the creation_time tag, zero if unknown
+	CreatedAt time.Time   `json:"created_at,omitzero"`
+	Audio     []AudioInfo `json:"audio,omitempty"`
+}
+
+// AudioInfo describes an audio stream
+type AudioInfo struct {
+	Codec      string `json:"codec"`
+	Channels   int    `json:"channels"`
+	SampleRate int    `json:"sample_rate"`
+	BitRate    int64  `json:"bit_rate,omitempty"`
+	// Language is the language tag, e.g. "eng", empty if unknown
+	Language string `json:"language,omitempty"`
+}
+
+// Portrait is true if the video is displayed taller than wide
+func (v *VideoInfo) Portrait() bool {
+	return v.Height > v.Width
+}
+
+// HasAudio is true if the file has an audio stream
+func (v *VideoInfo) HasAudio() bool {
+	return len(v.Audio) > 0
+}
+
+// ProbeError is a failure of an external probe with its output
+type ProbeError struct {
+	Tool   string
+	Err    error
+	Stderr string
+}
+
+func (e *ProbeError) Error() string {
+	msg := e.Tool + ": " + e.Err.Error()
+	// the last line of the output is usually the reason
+	if lines := strings.Split(e.Stderr, "\n"); e.Stderr != "" {
+		msg += ": " + strings.TrimSpace(lines[len(lines)-1])
+	}
+	return msg
+}
+
+func (e *ProbeError) Unwrap() error {
+	return e.Err
 }
 
 type VideoInfoProvider struct{}
@@ -36,35 +130,132 @@ func NewVideoInfoProvider() *VideoInfoProvider {
 func (o *VideoInfoProvider) GetVideoInfo(path string) (*VideoInfo, error) {
 	cmd := exec.Command("ffprobe",
 		"-v", "error",
-		"-select_streams", "v:0",
-		"-show_entries", "stream=codec_type,width,height,duration",
+		"-show_streams",
+		"-show_format",
 		"-of", "json", path)
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		probeErr := &ProbeError{Tool: "ffprobe", Err: err}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			probeErr.Stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return nil, probeErr
 	}
 
-	var info FFProbe
-	if err = json.Unmarshal(out, &info); err != nil {
+	var probe FFProbe
+	if err = json.Unmarshal(out, &probe); err != nil {
 		return nil, err
 	}
+	return probe.VideoInfo()
+}
 
-	var vid *VideoInfo
-	for i := range info.Streams {
-		if info.Streams[i].CodecType == "video" {
-			vid = &info.Streams[i]
+// VideoInfo returns the info of the first video stream and the audio streams
+func (p FFProbe) VideoInfo() (*VideoInfo, error) {
+	var vs *FFProbeStream
+	for i := range p.Streams {
+		if p.Streams[i].CodecType == "video" {
+			vs = &p.Streams[i]
 			break
 		}
 	}
-	if vid == nil {
+	if vs == nil {
 		return nil, errors.New("video stream not found")
 	}
 
-	durationFloat, err := strconv.ParseFloat(vid.DurationRaw, 64)
-	if err != nil {
-		return nil, err
+	vid := &VideoInfo{
+		CodecType:   vs.CodecType,
+		DurationRaw: vs.Duration,
+		Width:       vs.Width,
+		Height:      vs.Height,
+		Codec:       vs.CodecName,
+		Profile:     vs.Profile,
+		PixelFormat: vs.PixFmt,
+		Rotation:    vs.rotation(),
+		Container:   p.Format.FormatName,
+	}
+	// some containers, e.g. Matroska, have the duration of the format only
+	if vid.DurationRaw == "" {
+		vid.DurationRaw = p.Format.Duration
+	}
+	if vid.DurationRaw != "" {
+		durationFloat, err := strconv.ParseFloat(vid.DurationRaw, 64)
+		if err != nil {
+			return nil, err
+		}
+		vid.Duration = int(durationFloat)
+	}
+	if vid.Rotation == 90 || vid.Rotation == 270 {
+		vid.Width, vid.Height = vid.Height, vid.Width
+	}
+	if vid.FrameRate = parseRate(vs.AvgFrameRate); vid.FrameRate == 0 {
+		vid.FrameRate = parseRate(vs.RFrameRate)
+	}
+	if vid.BitRate = parseInt(p.Format.BitRate); vid.BitRate == 0 {
+		vid.BitRate = parseInt(vs.BitRate)
+	}
+	vid.Size = parseInt(p.Format.Size)
+	created := p.Format.Tags["creation_time"]
+	if created == "" {
+		created = vs.Tags["creation_time"]
+	}
+	if t, err := time.Parse(time.RFC3339Nano, created); err == nil {
+		vid.CreatedAt = t
 	}
-	vid.Duration = int(durationFloat)
 
+	for _, s := range p.Streams {
+		if s.CodecType != "audio" {
+			continue
+		}
+		vid.Audio = append(vid.Audio, AudioInfo{
+			Codec:      s.CodecName,
+			Channels:   s.Channels,
+			SampleRate: int(parseInt(s.SampleRate)),
+			BitRate:    parseInt(s.BitRate),
+			Language:   s.Tags["language"],
+		})
+	}
 	return vid, nil
 }
+
+// rotation returns the clockwise rotation in degrees normalized to [0, 360).
+// The display matrix of ffprobe is counterclockwise, the rotate tag of old versions is clockwise.
+func (s FFProbeStream) rotation() int {
+	degrees := 0.0
+	found := false
+	for _, sd := range s.SideDataList {
+		if sd.SideDataType == "Display Matrix" {
+			degrees, found = -sd.Rotation, true
+			break
+		}
+	}
+	if !found {
+		degrees = float64(parseInt(s.Tags["rotate"]))
+	}
+	rotation := int(math.Round(degrees)) % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	return rotation
+}
+
+// parseRate parses a frame rate like "30000/1001", 0 if it is unknown
+func parseRate(rate string) float64 {
+	num, den, ok := strings.Cut(rate, "/")
+	if !ok {
+		f, _ := strconv.ParseFloat(rate, 64)
+		return f
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return math.Round(n/d*1000) / 1000
+}
+
+// parseInt parses a number printed by ffprobe, 0 if it is unknown
+func parseInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -73,3 +74,69 @@ func TestNewVideoInfoFromFilepath_InvalidDuration(t *testing.T) {
 	require.Contains(t, err.Error(), "ParseFloat")
 	require.Nil(t, vid)
 }
+
+func TestNewVideoInfoFromFilepath_FullMetadata(t *testing.T) {
+	jsonOutput := `{
+  "streams": [
+    {"codec_type": "video", "codec_name": "hevc", "profile": "Main 10", "pix_fmt": "yuv420p10le",
+     "width": 1920, "height": 1080, "duration": "12.5", "avg_frame_rate": "30000/1001", "r_frame_rate": "30/1",
+     "bit_rate": "8000000", "side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]},
+    {"codec_type": "audio", "codec_name": "aac", "channels": 2, "sample_rate": "48000", "bit_rate": "128000",
+     "tags": {"language": "eng"}},
+    {"codec_type": "audio", "codec_name": "opus", "channels": 6, "sample_rate": "48000", "tags": {"language": "rus"}}
+  ],
+  "format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.6", "size": "12600000", "bit_rate": "8128000",
+    "tags": {"creation_time": "2024-05-01T10:20:30.000000Z"}}
+}`
+	createFakeFFProbe(t, jsonOutput)
+
+	vid, err := NewVideoInfoProvider().GetVideoInfo("dummy.mp4")
+	require.NoError(t, err)
+	require.Equal(t, 90, vid.Rotation)
+	require.Equal(t, 1080, vid.Width, "the portrait video is rotated")
+	require.Equal(t, 1920, vid.Height)
+	require.True(t, vid.Portrait())
+	require.Equal(t, 12, vid.Duration)
+	require.Equal(t, "hevc", vid.Codec)
+	require.Equal(t, "Main 10", vid.Profile)
+	require.Equal(t, "yuv420p10le", vid.PixelFormat)
+	require.Equal(t, 29.97, vid.FrameRate)
+	require.Equal(t, int64(8128000), vid.BitRate)
+	require.Equal(t, int64(12600000), vid.Size)
+	require.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", vid.Container)
+	require.Equal(t, time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC), vid.CreatedAt)
+	require.True(t, vid.HasAudio())
+	require.Equal(t, []AudioInfo{
+		{Codec: "aac", Channels: 2, SampleRate: 48000, BitRate: 128000, Language: "eng"},
+		{Codec: "opus", Channels: 6, SampleRate: 48000, Language: "rus"},
+	}, vid.Audio)
+}
+
+func TestNewVideoInfoFromFilepath_FormatDuration(t *testing.T) {
+	// Matroska streams have no duration, the rotate tag is set by old ffprobe versions
+	jsonOutput := `{"streams":[{"codec_type":"video","width":640,"height":480,"r_frame_rate":"25/1","tags":{"rotate":"180"}}],` +
+		`"format":{"format_name":"matroska,webm","duration":"61.2"}}`
+	createFakeFFProbe(t, jsonOutput)
+
+	vid, err := NewVideoInfoProvider().GetVideoInfo("dummy.mkv")
+	require.NoError(t, err)
+	require.Equal(t, 61, vid.Duration)
+	require.Equal(t, 180, vid.Rotation)
+	require.Equal(t, 640, vid.Width)
+	require.Equal(t, 25.0, vid.FrameRate)
+	require.False(t, vid.HasAudio())
+	require.True(t, vid.CreatedAt.IsZero())
+}
+
+func TestNewVideoInfoFromFilepath_ProbeError(t *testing.T) {
+	tmpDir := t.TempDir()
+	script := "#!/bin/sh\necho 'dummy.mp4: Invalid data found when processing input' >&2\nexit 1\n"
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "ffprobe"), []byte(script), 0755))
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	_, err := NewVideoInfoProvider().GetVideoInfo("dummy.mp4")
+	var probeErr *ProbeError
+	require.ErrorAs(t, err, &probeErr)
+	require.Equal(t, "dummy.mp4: Invalid data found when processing input", probeErr.Stderr)
+	require.EqualError(t, err, "ffprobe: exit status 1: dummy.mp4: Invalid data found when processing input")
+}
@@ -0,0 +1,225 @@
+package finder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestEntry is a file listed in a manifest with its overrides
+type ManifestEntry struct {
+	// Path is relative to the directory of the manifest unless it is absolute
+	Path        string    `json:"path"`
+	Caption     string    `json:"caption"`
+	Stars       *int      `json:"stars"`
+	Destination string    `json:"destination"`
+	PublishAt   time.Time `json:"publish_at"`
+	// Line of the entry in the manifest
+	Line int `json:"-"`
+}
+
+// manifestColumns are the columns of a CSV manifest, path is required
+var manifestColumns = []string{"path", "caption", "stars", "destination", "publish_at"}
+
+// ReadManifest reads the entries of the manifest by its extension:
+// M3U (.m3u, .m3u8) with the paths only, CSV (.csv) with a header or JSON lines (.jsonl, .ndjson).
+// The paths of the entries are resolved against the directory of the manifest.
+func ReadManifest(path string) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read manifest")
+	}
+
+	var entries []ManifestEntry
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".m3u", ".m3u8":
+		entries, err = readM3U(data)
+	case ".csv":
+		entries, err = readCSV(data)
+	case ".jsonl", ".ndjson":
+		entries, err = readJSONLines(data)
+	default:
+		return nil, errors.Errorf("unsupported manifest %s, expected .m3u, .csv or .jsonl", path)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "manifest %s", path)
+	}
+
+	dir := filepath.Dir(path)
+	for i, e := range entries {
+		if e.Path == "" {
+			return nil, errors.Errorf("manifest %s: line %d: path is required", path, e.Line)
+		}
+		if e.Stars != nil && *e.Stars < 0 {
+			return nil, errors.Errorf("manifest %s: line %d: stars must not be negative", path, e.Line)
+		}
+		if !filepath.IsAbs(e.Path) {
+			entries[i].Path = filepath.Join(dir, e.Path)
+		}
+	}
+	return entries, nil
+}
+
+// readM3U reads the paths of a playlist, the comments and #EXT directives are ignored
+func readM3U(data []byte) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entries = append(entries, ManifestEntry{Path: text, Line: line})
+	}
+	return entries, scanner.Err()
+}
+
+func readCSV(data []byte) ([]ManifestEntry, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read header")
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(manifestColumns, name) {
+			return nil, errors.Errorf("unknown column %q, expected %s", name, strings.Join(manifestColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, errors.New("path column is required")
+	}
+
+	var entries []ManifestEntry
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := r.FieldPos(0)
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		e := ManifestEntry{Path: field("path"), Caption: field("caption"), Destination: field("destination"), Line: line}
+		if v := field("stars"); v != "" {
+			stars, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, errors.Errorf("line %d: stars %q is not a number", line, v)
+			}
+			e.Stars = &stars
+		}
+		if v := field("publish_at"); v != "" {
+			if e.PublishAt, err = parsePublishAt(v); err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+// jsonManifestEntry is a line of a JSON lines manifest, its publish_at is parsed like the CSV column
+type jsonManifestEntry struct {
+	ManifestEntry
+	PublishAt string `json:"publish_at"`
+}
+
+func readJSONLines(data []byte) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var je jsonManifestEntry
+		dec := json.NewDecoder(bytes.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&je); err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		e := je.ManifestEntry
+		if je.PublishAt != "" {
+			var err error
+			if e.PublishAt, err = parsePublishAt(je.PublishAt); err != nil {
+				return nil, errors.Wrapf(err, "line %d", line)
+			}
+		}
+		e.Line = line
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// parsePublishAt accepts RFC 3339 or "2006-01-02 15:04[:05]" in the local time
+func parsePublishAt(v string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, time.DateTime, "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("publish_at %q is not a time like 2006-01-02T15:04:05Z07:00", v)
+}
+
+// LoadManifest returns the files of the manifest in its order with their overrides but without the video info.
+// It fails if a listed file is missing, isn't a regular file or is listed twice.
+func LoadManifest(path string) ([]File, error) {
+	entries, err := ReadManifest(path)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	files := make([]File, 0, len(entries))
+	seen := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if seen[e.Path] {
+			problems = append(problems, fmt.Sprintf("line %d: %s is listed twice", e.Line, e.Path))
+			continue
+		}
+		seen[e.Path] = true
+		info, err := os.Stat(e.Path)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", e.Line, err))
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			problems = append(problems, fmt.Sprintf("line %d: %s is not a regular file", e.Line, e.Path))
+			continue
+		}
+		files = append(files, File{
+			Name:        info.Name(),
+			ModTime:     info.ModTime(),
+			Size:        info.Size(),
+			Path:        e.Path,
+			Caption:     e.Caption,
+			Stars:       e.Stars,
+			Destination: e.Destination,
+			PublishAt:   e.PublishAt,
+		})
+	}
+	if len(problems) > 0 {
+		return nil, errors.Errorf("manifest %s:\n  %s", path, strings.Join(problems, "\n  "))
+	}
+	return files, nil
+}
@@ -0,0 +1,129 @@
+package finder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeManifest creates the manifest and empty files in a temp dir
+func writeManifest(t *testing.T, name, text string, files ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, f)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, f), []byte("video"), 0o600))
+	}
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(text), 0o600))
+	return path
+}
+
+func TestReadManifest(t *testing.T) {
+	stars := 5
+	publishAt := time.Date(2025, 3, 1, 18, 0, 0, 0, time.UTC)
+
+	t.Run("m3u", func(t *testing.T) {
+		path := writeManifest(t, "list.m3u", "#EXTM3U\n#EXTINF:10,Intro\nb.mp4\n\n/abs/a.mp4\n")
+		entries, err := ReadManifest(path)
+		require.NoError(t, err)
+		assert.Equal(t, []ManifestEntry{
+			{Path: filepath.Join(filepath.Dir(path), "b.mp4"), Line: 3},
+			{Path: "/abs/a.mp4", Line: 5},
+		}, entries)
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		path := writeManifest(t, "list.csv", "path,caption,stars,destination,publish_at\n"+
+			"b.mp4,\"<b>B</b>, the second\",5,backup,2025-03-01T18:00:00Z\n"+
+			"a.mp4,,,,\n")
+		entries, err := ReadManifest(path)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, ManifestEntry{
+			Path: filepath.Join(filepath.Dir(path), "b.mp4"), Caption: "<b>B</b>, the second", Stars: &stars,
+			Destination: "backup", PublishAt: publishAt, Line: 2,
+		}, entries[0])
+		assert.Nil(t, entries[1].Stars)
+		assert.True(t, entries[1].PublishAt.IsZero())
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		path := writeManifest(t, "list.jsonl", `{"path":"b.mp4","caption":"B","stars":5,"destination":"backup","publish_at":"2025-03-01T18:00:00Z"}`+"\n\n"+`{"path":"a.mp4"}`+"\n")
+		entries, err := ReadManifest(path)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, &stars, entries[0].Stars)
+		assert.Equal(t, publishAt, entries[0].PublishAt.UTC())
+		assert.Equal(t, 3, entries[1].Line)
+	})
+
+	t.Run("publish_at formats", func(t *testing.T) {
+		local := time.Date(2025, 3, 1, 18, 0, 0, 0, time.Local)
+		manifests := map[string]string{
+			"list.csv":   "path,publish_at\na.mp4,2025-03-01T18:00:00Z\nb.mp4,2025-03-01 18:00\n",
+			"list.jsonl": `{"path":"a.mp4","publish_at":"2025-03-01T18:00:00Z"}` + "\n" + `{"path":"b.mp4","publish_at":"2025-03-01 18:00"}` + "\n",
+		}
+		for name, text := range manifests {
+			entries, err := ReadManifest(writeManifest(t, name, text))
+			require.NoError(t, err, name)
+			require.Len(t, entries, 2, name)
+			assert.True(t, publishAt.Equal(entries[0].PublishAt), name)
+			assert.True(t, local.Equal(entries[1].PublishAt), name)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := map[string]string{
+			"list.txt":    "unsupported manifest",
+			"bad.csv":     `unknown column "title"`,
+			"nopath.csv":  "path column is required",
+			"stars.csv":   `line 2: stars "many" is not a number`,
+			"time.csv":    `line 2: publish_at "tomorrow" is not a time`,
+			"time.jsonl":  `line 1: publish_at "tomorrow" is not a time`,
+			"neg.jsonl":   "line 1: stars must not be negative",
+			"key.jsonl":   `line 1: json: unknown field "title"`,
+			"empty.jsonl": "line 1: path is required",
+		}
+		texts := map[string]string{
+			"list.txt":    "a.mp4",
+			"bad.csv":     "path,title\n",
+			"nopath.csv":  "caption\nx\n",
+			"stars.csv":   "path,stars\na.mp4,many\n",
+			"time.csv":    "path,publish_at\na.mp4,tomorrow\n",
+			"time.jsonl":  `{"path":"a.mp4","publish_at":"tomorrow"}`,
+			"neg.jsonl":   `{"path":"a.mp4","stars":-1}`,
+			"key.jsonl":   `{"path":"a.mp4","title":"A"}`,
+			"empty.jsonl": `{"caption":"A"}`,
+		}
+		for name, want := range tests {
+			_, err := ReadManifest(writeManifest(t, name, texts[name]))
+			assert.ErrorContains(t, err, want, name)
+		}
+	})
+}
+
+func TestScanManifest(t *testing.T) {
+	path := writeManifest(t, "list.csv", "path,stars\nsub/b.mp4,3\na.mp4,\nnotes.txt,\n", "a.mp4", "sub/b.mp4", "notes.txt")
+	dir := filepath.Dir(path)
+	p := NewProvider(failingFor{"notes.txt": assert.AnError})
+
+	files, report, err := p.ScanManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.mp4", "a.mp4"}, names(files), "the order of the manifest is kept")
+	require.NotNil(t, files[0].Stars)
+	assert.Equal(t, 3, *files[0].Stars)
+	assert.Nil(t, files[1].Stars)
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, filepath.Join(dir, "notes.txt"), report.Skipped[0].Path)
+
+	path = writeManifest(t, "list.m3u", "a.mp4\nmissing.mp4\na.mp4\n", "a.mp4")
+	_, _, err = p.ScanManifest(path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: stat "+filepath.Join(filepath.Dir(path), "missing.mp4"))
+	assert.Contains(t, err.Error(), "line 3: "+filepath.Join(filepath.Dir(path), "a.mp4")+" is listed twice")
+}
@@ -0,0 +1,409 @@
+package finder
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// maxMoovSize limits the moov atom read into memory
+const maxMoovSize = 64 << 20
+
+// mp4Epoch is the start of the MP4 timestamps
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// mp4TopLevel are the atoms expected at the top level of an MP4/MOV file
+var mp4TopLevel = map[string]bool{
+	"ftyp": true, "moov": true, "mdat": true, "free": true, "skip": true,
+	"wide": true, "pnot": true, "uuid": true, "meta": true, "styp": true, "sidx": true, "moof": true, "mfra": true,
+}
+
+// mp4Codecs maps the sample entry types to the codec names of ffprobe
+var mp4Codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264", "hvc1": "hevc", "hev1": "hevc", "mp4v": "mpeg4", "av01": "av1",
+	"vp08": "vp8", "vp09": "vp9", "jpeg": "mjpeg", "apcn": "prores", "apch": "prores", "apcs": "prores",
+	"mp4a": "aac", "ac-3": "ac3", "ec-3": "eac3", "Opus": "opus", ".mp3": "mp3", "alac": "alac",
+	"fLaC": "flac", "sowt": "pcm_s16le", "twos": "pcm_s16be", "lpcm": "pcm",
+}
+
+// MP4InfoProvider reads the video info from the MP4/MOV atoms without external tools.
+// It knows less than VideoInfoProvider: there are no profile, pixel format and audio bit rate.
+type MP4InfoProvider struct{}
+
+func NewMP4InfoProvider() *MP4InfoProvider {
+	return &MP4InfoProvider{}
+}
+
+func (o *MP4InfoProvider) GetVideoInfo(path string) (*VideoInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var moov []byte
+	for offset := int64(0); offset < stat.Size(); {
+		header := make([]byte, 16)
+		n, err := f.ReadAt(header, offset)
+		if n < 8 {
+			return nil, errors.Wrapf(err, "read atom at %d", offset)
+		}
+		size, typ, headerSize := int64(binary.BigEndian.Uint32(header)), string(header[4:8]), int64(8)
+		switch size {
+		case 0:
+			size = stat.Size() - offset
+		case 1:
+			if n < 16 {
+				return nil, errors.Errorf("truncated atom %q at %d", typ, offset)
+			}
+			size, headerSize = int64(binary.BigEndian.Uint64(header[8:])), 16
+		}
+		if !mp4TopLevel[typ] || size < headerSize {
+			return nil, errors.Errorf("not an MP4/MOV file: unexpected atom %q at %d", typ, offset)
+		}
+
+		if typ == "moov" {
+			if size-headerSize > maxMoovSize {
+				return nil, errors.Errorf("moov atom of %d bytes is too large", size)
+			}
+			moov = make([]byte, size-headerSize)
+			if _, err := f.ReadAt(moov, offset+headerSize); err != nil {
+				return nil, errors.Wrap(err, "read moov")
+			}
+		}
+		offset += size
+	}
+	if moov == nil {
+		return nil, errors.New("moov atom not found")
+	}
+
+	vid, err := parseMoov(moov)
+	if err != nil {
+		return nil, err
+	}
+	vid.Size = stat.Size()
+	if vid.Duration > 0 {
+		vid.BitRate = vid.Size * 8 / int64(vid.Duration)
+	}
+	// the format name of ffprobe for all the brands
+	vid.Container = "mov,mp4,m4a,3gp,3g2,mj2"
+	return vid, nil
+}
+
+// mp4Track is what parseMoov needs from a trak atom
+type mp4Track struct {
+	handler        string
+	codec          string
+	width, height  int
+	rotation       int
+	timescale      uint32
+	duration       uint64
+	samples        uint64
+	language       string
+	channels       int
+	sampleRate     int
+	entryW, entryH int
+}
+
+func parseMoov(moov []byte) (*VideoInfo, error) {
+	vid := &VideoInfo{}
+	var timescale uint32
+	var duration uint64
+	var tracks []mp4Track
+	err := eachAtom(moov, func(typ string, data []byte) error {
+		switch typ {
+		case "mvhd":
+			created, ts, d, err := parseMediaHeader(data)
+			if err != nil {
+				return errors.Wrap(err, "mvhd")
+			}
+			timescale, duration = ts, d
+			if created > 0 {
+				vid.CreatedAt = mp4Epoch.Add(time.Duration(created) * time.Second)
+			}
+		case "trak":
+			track, err := parseTrack(data)
+			if err != nil {
+				return errors.Wrap(err, "trak")
+			}
+			tracks = append(tracks, track)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var video *mp4Track
+	for i := range tracks {
+		t := tracks[i]
+		switch t.handler {
+		case "vide":
+			if video == nil {
+				video = &tracks[i]
+			}
+		case "soun":
+			vid.Audio = append(vid.Audio, AudioInfo{Codec: t.codec, Channels: t.channels, SampleRate: t.sampleRate, Language: t.language})
+		}
+	}
+	if video == nil {
+		return nil, errors.New("video stream not found")
+	}
+
+	vid.CodecType = "video"
+	vid.Codec = video.codec
+	vid.Rotation = video.rotation
+	vid.Width, vid.Height = video.width, video.height
+	if vid.Width == 0 || vid.Height == 0 {
+		// the coded size of the sample entry is rotated here, tkhd one is rotated by parseTrackHeader
+		vid.Width, vid.Height = video.entryW, video.entryH
+		if vid.Rotation == 90 || vid.Rotation == 270 {
+			vid.Width, vid.Height = vid.Height, vid.Width
+		}
+	}
+	seconds := 0.0
+	if timescale > 0 {
+		seconds = float64(duration) / float64(timescale)
+	}
+	if seconds == 0 && video.timescale > 0 {
+		seconds = float64(video.duration) / float64(video.timescale)
+	}
+	vid.DurationRaw = fmt.Sprintf("%.6f", seconds)
+	vid.Duration = int(seconds)
+	if video.duration > 0 && video.timescale > 0 {
+		fps := float64(video.samples) * float64(video.timescale) / float64(video.duration)
+		vid.FrameRate = math.Round(fps*1000) / 1000
+	}
+	return vid, nil
+}
+
+func parseTrack(trak []byte) (mp4Track, error) {
+	var t mp4Track
+	err := t.walk(trak)
+	return t, err
+}
+
+// walk reads the atoms of the track and its nested containers
+func (t *mp4Track) walk(data []byte) error {
+	return eachAtom(data, func(typ string, data []byte) error {
+		switch typ {
+		case "tkhd":
+			return t.parseTrackHeader(data)
+		case "mdia", "minf", "stbl":
+			return t.walk(data)
+		case "mdhd":
+			_, ts, d, err := parseMediaHeader(data)
+			if err != nil {
+				return errors.Wrap(err, "mdhd")
+			}
+			t.timescale, t.duration = ts, d
+			t.language = parseLanguage(data)
+		case "hdlr":
+			if len(data) < 12 {
+				return errors.New("truncated hdlr")
+			}
+			// minf of MOV has the data handler, the media handler of mdia comes first
+			if t.handler == "" {
+				t.handler = string(data[8:12])
+			}
+		case "stsd":
+			t.parseSampleDescription(data)
+		case "stts":
+			t.samples = parseSampleCount(data)
+		}
+		return nil
+	})
+}
+
+func (t *mp4Track) parseTrackHeader(data []byte) error {
+	// version and flags, the times, track ID, reserved and duration are 20 or 32 bytes long
+	offset := 4 + 20
+	if len(data) > 0 && data[0] == 1 {
+		offset = 4 + 32
+	}
+	// reserved, layer, alternate group, volume, reserved, matrix, width, height
+	offset += 8 + 2 + 2 + 2 + 2
+	if len(data) < offset+36+8 {
+		return errors.New("truncated tkhd")
+	}
+	matrix := data[offset : offset+36]
+	a := float64(int32(binary.BigEndian.Uint32(matrix[0:]))) / 65536
+	b := float64(int32(binary.BigEndian.Uint32(matrix[4:]))) / 65536
+	rotation := int(math.Round(math.Atan2(b, a)*180/math.Pi)) % 360
+	if rotation < 0 {
+		rotation += 360
+	}
+	t.rotation = rotation
+
+	width := int(binary.BigEndian.Uint32(data[offset+36:]) >> 16)
+	height := int(binary.BigEndian.Uint32(data[offset+40:]) >> 16)
+	if rotation == 90 || rotation == 270 {
+		width, height = height, width
+	}
+	t.width, t.height = width, height
+	return nil
+}
+
+// parseSampleDescription reads the codec and its parameters from the first sample entry
+func (t *mp4Track) parseSampleDescription(data []byte) {
+	// version and flags, entry count, the entry header
+	if len(data) < 8+16 {
+		return
+	}
+	entry := data[8:]
+	format := string(entry[4:8])
+	t.codec = format
+	if codec, ok := mp4Codecs[format]; ok {
+		t.codec = codec
+	}
+	// size, format, reserved and data reference index
+	fields := entry[16:]
+	switch {
+	case len(fields) >= 20 && t.isVisual(format):
+		// pre-defined and reserved, width, height
+		t.entryW = int(binary.BigEndian.Uint16(fields[16:]))
+		t.entryH = int(binary.BigEndian.Uint16(fields[18:]))
+	case len(fields) >= 20:
+		// version, revision, vendor, channels, sample size, compression ID, packet size, sample rate
+		t.channels = int(binary.BigEndian.Uint16(fields[8:]))
+		t.sampleRate = int(binary.BigEndian.Uint32(fields[16:]) >> 16)
+	}
+}
+
+// isVisual checks the sample entry of a video track, the handler may be read after stsd
+func (t *mp4Track) isVisual(format string) bool {
+	if t.handler != "" {
+		return t.handler == "vide"
+	}
+	switch mp4Codecs[format] {
+	case "aac", "ac3", "eac3", "opus", "mp3", "alac", "flac", "pcm_s16le", "pcm_s16be", "pcm":
+		return false
+	}
+	return true
+}
+
+// parseMediaHeader reads mvhd and mdhd which share the layout of the first fields
+func parseMediaHeader(data []byte) (created uint64, timescale uint32, duration uint64, err error) {
+	if len(data) < 4 {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	if data[0] == 1 {
+		if len(data) < 32 {
+			return 0, 0, 0, io.ErrUnexpectedEOF
+		}
+		return binary.BigEndian.Uint64(data[4:]), binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint64(data[24:]), nil
+	}
+	if len(data) < 20 {
+		return 0, 0, 0, io.ErrUnexpectedEOF
+	}
+	return uint64(binary.BigEndian.Uint32(data[4:])), binary.BigEndian.Uint32(data[12:]), uint64(binary.BigEndian.Uint32(data[16:])), nil
+}
+
+// parseLanguage reads the packed ISO-639-2 code of mdhd, empty if it is undefined
+func parseLanguage(data []byte) string {
+	offset := 20
+	if len(data) > 0 && data[0] == 1 {
+		offset = 32
+	}
+	if len(data) < offset+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(data[offset:])
+	lang := string([]byte{
+		byte(packed>>10&0x1f) + 0x60,
+		byte(packed>>5&0x1f) + 0x60,
+		byte(packed&0x1f) + 0x60,
+	})
+	if lang == "und" || packed == 0 {
+		return ""
+	}
+	return lang
+}
+
+// parseSampleCount sums the sample counts of stts
+func parseSampleCount(data []byte) uint64 {
+	if len(data) < 8 {
+		return 0
+	}
+	entries := int(binary.BigEndian.Uint32(data[4:]))
+	var count uint64
+	for i := 0; i < entries && 8+i*8+8 <= len(data); i++ {
+		count += uint64(binary.BigEndian.Uint32(data[8+i*8:]))
+	}
+	return count
+}
+
+// eachAtom calls fn for every atom of data
+func eachAtom(data []byte, fn func(typ string, data []byte) error) error {
+	for len(data) >= 8 {
+		size, headerSize := uint64(binary.BigEndian.Uint32(data)), uint64(8)
+		typ := string(data[4:8])
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return errors.Errorf("truncated atom %q", typ)
+			}
+			size, headerSize = binary.BigEndian.Uint64(data[8:]), 16
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return errors.Errorf("invalid size %d of atom %q", size, typ)
+		}
+		if err := fn(typ, data[headerSize:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
+
+// ChainProvider returns the info of the first provider which succeeds,
+// e.g. ffprobe with the native MP4 reader as the fallback
+type ChainProvider struct {
+	Providers []VIProvider
+}
+
+func NewChainProvider(providers ...VIProvider) *ChainProvider {
+	return &ChainProvider{Providers: providers}
+}
+
+func (o *ChainProvider) GetVideoInfo(path string) (*VideoInfo, error) {
+	var errs chainError
+	for _, p := range o.Providers {
+		info, err := p.GetVideoInfo(path)
+		if err == nil {
+			return info, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, errors.New("no video info providers")
+	}
+	return nil, errs
+}
+
+// chainError keeps the errors of every provider, so errors.As finds ProbeError
+type chainError []error
+
+func (e chainError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e chainError) Unwrap() []error {
+	return e
+}
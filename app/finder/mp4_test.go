@@ -0,0 +1,144 @@
+package finder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// atom builds an MP4 atom from the payload parts, the numbers are written big-endian
+func atom(typ string, parts ...any) []byte {
+	var payload bytes.Buffer
+	for _, p := range parts {
+		switch v := p.(type) {
+		case []byte:
+			payload.Write(v)
+		case string:
+			payload.WriteString(v)
+		default:
+			_ = binary.Write(&payload, binary.BigEndian, v)
+		}
+	}
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header, uint32(8+payload.Len()))
+	copy(header[4:], typ)
+	return append(header, payload.Bytes()...)
+}
+
+// tkhd returns a version 0 track header with the rotation matrix
+func tkhd(width, height uint16, a, b, c, d int32) []byte {
+	matrix := []int32{a << 16, b << 16, 0, c << 16, d << 16, 0, 0, 0, 1 << 30}
+	return atom("tkhd", uint32(0), make([]byte, 20), make([]byte, 16), matrix, uint32(width)<<16, uint32(height)<<16)
+}
+
+func mdhd(timescale, duration uint32, lang string) []byte {
+	packed := uint16(lang[0]-0x60)<<10 | uint16(lang[1]-0x60)<<5 | uint16(lang[2]-0x60)
+	return atom("mdhd", uint32(0), uint32(0), uint32(0), timescale, duration, packed, uint16(0))
+}
+
+func hdlr(handler string) []byte {
+	return atom("hdlr", uint32(0), uint32(0), handler, make([]byte, 12), "\x00")
+}
+
+func writeMP4(t *testing.T, moovFirst bool) string {
+	t.Helper()
+	created := uint32(time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC).Sub(mp4Epoch) / time.Second)
+	video := atom("trak",
+		tkhd(1920, 1080, 0, 1, -1, 0),
+		atom("mdia",
+			mdhd(30000, 300300, "und"),
+			hdlr("vide"),
+			atom("minf",
+				hdlr("alis"),
+				atom("stbl",
+					atom("stsd", uint32(0), uint32(1), atom("avc1", make([]byte, 6), uint16(1), make([]byte, 16), uint16(1920), uint16(1080), make([]byte, 50))),
+					atom("stts", uint32(0), uint32(1), uint32(300), uint32(1001)),
+				),
+			),
+		),
+	)
+	audio := atom("trak",
+		tkhd(0, 0, 1, 0, 0, 1),
+		atom("mdia",
+			mdhd(48000, 480000, "eng"),
+			hdlr("soun"),
+			atom("minf", atom("stbl",
+				atom("stsd", uint32(0), uint32(1), atom("mp4a", make([]byte, 6), uint16(1), make([]byte, 8), uint16(2), uint16(16), uint32(0), uint32(48000)<<16)),
+			)),
+		),
+	)
+	moov := atom("moov", atom("mvhd", uint32(0), created, created, uint32(1000), uint32(10010), make([]byte, 80)), video, audio)
+	mdat := atom("mdat", make([]byte, 1000))
+
+	data := atom("ftyp", "isom", uint32(512), "isomiso2avc1mp41")
+	if moovFirst {
+		data = append(append(data, moov...), mdat...)
+	} else {
+		data = append(append(data, mdat...), moov...)
+	}
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	return path
+}
+
+func TestMP4InfoProvider(t *testing.T) {
+	for _, moovFirst := range []bool{true, false} {
+		path := writeMP4(t, moovFirst)
+		vid, err := NewMP4InfoProvider().GetVideoInfo(path)
+		require.NoError(t, err)
+		assert.Equal(t, "video", vid.CodecType)
+		assert.Equal(t, "h264", vid.Codec)
+		assert.Equal(t, 90, vid.Rotation)
+		assert.Equal(t, 1080, vid.Width, "the portrait video is rotated")
+		assert.Equal(t, 1920, vid.Height)
+		assert.Equal(t, 10, vid.Duration)
+		assert.Equal(t, "10.010000", vid.DurationRaw)
+		assert.Equal(t, 29.97, vid.FrameRate)
+		assert.Equal(t, "mov,mp4,m4a,3gp,3g2,mj2", vid.Container)
+		assert.Equal(t, time.Date(2024, 5, 1, 10, 20, 30, 0, time.UTC), vid.CreatedAt)
+		info, _ := os.Stat(path)
+		assert.Equal(t, info.Size(), vid.Size)
+		assert.Equal(t, []AudioInfo{{Codec: "aac", Channels: 2, SampleRate: 48000, Language: "eng"}}, vid.Audio)
+	}
+}
+
+func TestMP4InfoProvider_Errors(t *testing.T) {
+	dir := t.TempDir()
+	notMP4 := filepath.Join(dir, "clip.mkv")
+	require.NoError(t, os.WriteFile(notMP4, []byte("\x1a\x45\xdf\xa3 matroska data"), 0o600))
+	_, err := NewMP4InfoProvider().GetVideoInfo(notMP4)
+	assert.ErrorContains(t, err, "not an MP4/MOV file")
+
+	noMoov := filepath.Join(dir, "nomoov.mp4")
+	require.NoError(t, os.WriteFile(noMoov, append(atom("ftyp", "isom", uint32(0)), atom("mdat", "x")...), 0o600))
+	_, err = NewMP4InfoProvider().GetVideoInfo(noMoov)
+	assert.ErrorContains(t, err, "moov atom not found")
+
+	audioOnly := filepath.Join(dir, "audio.m4a")
+	moov := atom("moov", atom("mvhd", make([]byte, 100)), atom("trak", atom("mdia", hdlr("soun"))))
+	require.NoError(t, os.WriteFile(audioOnly, append(atom("ftyp", "M4A ", uint32(0)), moov...), 0o600))
+	_, err = NewMP4InfoProvider().GetVideoInfo(audioOnly)
+	assert.ErrorContains(t, err, "video stream not found")
+}
+
+func TestChainProvider(t *testing.T) {
+	first := fixedVideoInfoProvider{err: errors.New("ffprobe not found")}
+	second := fixedVideoInfoProvider{info: &VideoInfo{Width: 640}}
+
+	info, err := NewChainProvider(first, second).GetVideoInfo("a.mp4")
+	require.NoError(t, err)
+	assert.Equal(t, 640, info.Width)
+
+	_, err = NewChainProvider(first, fixedVideoInfoProvider{err: errors.New("not an MP4/MOV file")}).GetVideoInfo("a.mkv")
+	assert.EqualError(t, err, "ffprobe not found; not an MP4/MOV file")
+
+	_, err = NewChainProvider().GetVideoInfo("a.mp4")
+	assert.Error(t, err)
+}
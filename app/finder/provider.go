@@ -1,44 +1,127 @@
 package finder
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
+	"log"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
+	"strings"
+	"sync"
 	"time"
 )
 
 // File involves file info
 type File struct {
-	Path    string
-	Name    string
-	ModTime time.Time
-	Info    *VideoInfo
+	Path    string     `json:"path"`
+	Name    string     `json:"name"`
+	ModTime time.Time  `json:"mod_time"`
+	Size    int64      `json:"size"` // in bytes
+	Info    *VideoInfo `json:"info"`
+
+	// Caption, Stars, Destination and PublishAt override the defaults of the post, they are set by manifests
+	Caption     string    `json:"caption,omitempty"`
+	Stars       *int      `json:"stars,omitempty"`
+	Destination string    `json:"destination,omitempty"`
+	PublishAt   time.Time `json:"publish_at,omitzero"`
+	// Remote is the origin of a file downloaded from a Source, nil for the local files
+	Remote *RemoteFile `json:"remote,omitempty"`
+	// Archive is the origin of a file extracted from an archive, nil for the other files
+	Archive *ArchiveFile `json:"archive,omitempty"`
+	// Album groups the files sent together, empty if the file is sent alone
+	Album string `json:"album,omitempty"`
+	// Sidecar has the processing directives of the file, nil if it has no sidecar
+	Sidecar *Sidecar `json:"sidecar,omitempty"`
+	// Processed are the names of the steps of the processing pipeline applied to the file
+	Processed []string `json:"processed,omitempty"`
+	// Fingerprint is set by SimilarFinder and kept in History with the sent file
+	Fingerprint Fingerprint `json:"-"`
+}
+
+// Pending tells if the file of a remote source or an archive isn't downloaded or extracted yet. A pending file
+// is taken for a video by its extension without probing: it has no video info, so the duration sorter puts it first
+// and the creation time sorter orders it by modification time, and it isn't hashed by Deduplicator
+// nor fingerprinted by SimilarFinder.
+func (f File) Pending() bool {
+	return (f.Remote != nil && f.Remote.Pending) || (f.Archive != nil && f.Archive.Pending)
 }
 
 type Provider struct {
 	VideoInfoProvider VIProvider
+	// Workers is the number of files probed at once, 1 if not positive
+	Workers int
+	// Sorters order the files of the root directories and the remotes by their names,
+	// by modification time if there is none
+	Sorters map[string]Sorter
 }
 
+// videoExts are the extensions of the videos taken without probing
+var videoExts = []string{".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi", ".wmv", ".flv", ".mpg", ".mpeg", ".ts", ".3gp"}
+
+// IsVideoName reports whether the file is a video by its extension
+func IsVideoName(name string) bool {
+	return slices.Contains(videoExts, strings.ToLower(filepath.Ext(name)))
+}
+
+// defaultWorkers is the number of files probed at once by NewProvider
+const defaultWorkers = 4
+
 func NewProvider(VideoInfoProvider VIProvider) *Provider {
 	return &Provider{
 		VideoInfoProvider: VideoInfoProvider,
+		Workers:           defaultWorkers,
+	}
+}
+
+// GetFile returns a single file with its video info
+func (o *Provider) GetFile(path string) (File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return File{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return File{}, fmt.Errorf("%s is not a regular file", path)
+	}
+	videoInfo, err := o.VideoInfoProvider.GetVideoInfo(path)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to get videoInfo for %s: %w", path, err)
 	}
+	sidecar, err := ReadSidecar(path)
+	if err != nil {
+		return File{}, err
+	}
+	return File{
+		Name:    info.Name(),
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		Path:    path,
+		Info:    videoInfo,
+		Sidecar: sidecar,
+	}, nil
 }
 
 // GetListFilesSorted returns a list of files in a directory
-// sorted by modification time
+// sorted by the sorter of the root
 func (o *Provider) GetListFilesSorted(root, dir string) ([]File, error) {
+	files, _, err := o.Scan(root, dir)
+	return files, err
+}
+
+// Scan returns a list of video files in a directory sorted by the sorter of the root
+// and the report of the skipped files
+func (o *Provider) Scan(root, dir string) ([]File, ScanReport, error) {
 	return o.listFilesSorted(os.DirFS(root), root, dir)
 }
 
 // ListFilesSorted returns a list of files in a directory
-// sorted by modification time
-func (o *Provider) listFilesSorted(fsys fs.FS, root, dir string) ([]File, error) {
+// sorted by the sorter of the root
+func (o *Provider) listFilesSorted(fsys fs.FS, root, dir string) ([]File, ScanReport, error) {
+	var report ScanReport
 	entries, err := fs.ReadDir(fsys, dir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read directory: %w", err)
+		return nil, report, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	var files []File
@@ -46,25 +129,170 @@ func (o *Provider) listFilesSorted(fsys fs.FS, root, dir string) ([]File, error)
 		if entry.IsDir() {
 			continue
 		}
-		info, err := entry.Info()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get info for %s: %w", entry.Name(), err)
-		}
 		path := filepath.Join(root, dir, entry.Name())
-		videoInfo, err := o.VideoInfoProvider.GetVideoInfo(path)
+		info, err := entry.Info()
 		if err != nil {
+			report.Add(path, fmt.Errorf("failed to get info: %w", err))
 			continue
-			// return nil, fmt.Errorf("failed to get videoInfo for %s: %w", path, err)
 		}
 		files = append(files, File{
 			Name:    entry.Name(),
 			ModTime: info.ModTime(),
+			Size:    info.Size(),
 			Path:    path,
-			Info:    videoInfo,
 		})
 	}
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].ModTime.Before(files[j].ModTime)
-	})
-	return files, nil
+
+	files = o.videos(files, &report)
+	if err := o.sorter(root).Sort(files); err != nil {
+		return nil, report, fmt.Errorf("failed to sort files of %s: %w", root, err)
+	}
+	return files, report, nil
+}
+
+// ScanManifest returns the video files listed in the manifest in its order
+// and the report of the skipped files, see LoadManifest
+func (o *Provider) ScanManifest(path string) ([]File, ScanReport, error) {
+	var report ScanReport
+	files, err := LoadManifest(path)
+	if err != nil {
+		return nil, report, err
+	}
+	return o.videos(files, &report), report, nil
+}
+
+// ScanRemote returns the video files of the remote source sorted by the sorter of its name
+// and the report of the skipped files, see Provider.fetched
+func (o *Provider) ScanRemote(r *Remote) ([]File, ScanReport, error) {
+	files, report, err := r.Fetch()
+	if err != nil {
+		return nil, report, err
+	}
+	files = o.fetched(files, &report)
+	if err := o.sorter(r.Name).Sort(files); err != nil {
+		return nil, report, fmt.Errorf("failed to sort files of %s: %w", r.Name, err)
+	}
+	return files, report, nil
+}
+
+// ScanArchives returns the video files of the archives, the files of each archive
+// are sorted by the sorter of the archives name, and the report of the skipped files, see Provider.fetched
+func (o *Provider) ScanArchives(a *Archives) ([]File, ScanReport, error) {
+	files, report, err := a.Fetch()
+	if err != nil {
+		return nil, report, err
+	}
+	files = o.fetched(files, &report)
+	// the files of an archive stay together, so they can be sent as an album
+	for start := 0; start < len(files); {
+		end := start + 1
+		for end < len(files) && files[end].Archive.Archive == files[start].Archive.Archive {
+			end++
+		}
+		if err := o.sorter(a.Name).Sort(files[start:end]); err != nil {
+			return nil, report, fmt.Errorf("failed to sort files of %s: %w", files[start].Archive.Archive, err)
+		}
+		start = end
+	}
+	return files, report, nil
+}
+
+// fetched returns the videos of the files listed by a remote source or archives in their order.
+// The downloaded and extracted files are probed, the pending ones are taken for videos by their extensions
+// until the job sending them fetches them, see File.Pending.
+func (o *Provider) fetched(files []File, report *ScanReport) []File {
+	files = withoutSidecars(files)
+	var ready []File
+	for _, file := range files {
+		if !file.Pending() {
+			ready = append(ready, file)
+		}
+	}
+	probed := make(map[string]File, len(ready))
+	for _, file := range o.videos(ready, report) {
+		probed[file.Path] = file
+	}
+
+	videos := files[:0]
+	for _, file := range files {
+		if !file.Pending() {
+			if video, ok := probed[file.Path]; ok {
+				videos = append(videos, video)
+			}
+			continue
+		}
+		origin := file.Path
+		switch {
+		case file.Remote != nil:
+			origin = file.Remote.Source + ":" + file.Remote.Path
+		case file.Archive != nil:
+			origin = file.Archive.Archive + ":" + file.Archive.Entry
+		}
+		if !IsVideoName(file.Name) {
+			report.Add(origin, errors.New("not a video by its extension"))
+			continue
+		}
+		sidecar, err := ReadSidecar(file.Path)
+		if err != nil {
+			report.Add(origin, err)
+			continue
+		}
+		file.Sidecar = sidecar
+		videos = append(videos, file)
+	}
+	return videos
+}
+
+// videos probes the files and returns the videos with their sidecars, the other files are added to the report
+func (o *Provider) videos(files []File, report *ScanReport) []File {
+	files = withoutSidecars(files)
+	errs := o.probe(files)
+	if saver, ok := o.VideoInfoProvider.(Saver); ok {
+		if err := saver.Save(); err != nil {
+			log.Printf("[WARN] can't save video info: %v", err)
+		}
+	}
+	videos := files[:0]
+	for i, file := range files {
+		if errs[i] != nil {
+			log.Printf("[DEBUG] skip %s: %v", file.Path, errs[i])
+			report.Add(file.Path, errs[i])
+			continue
+		}
+		sidecar, err := ReadSidecar(file.Path)
+		if err != nil {
+			report.Add(file.Path, err)
+			continue
+		}
+		file.Sidecar = sidecar
+		videos = append(videos, file)
+	}
+	return videos
+}
+
+// sorter returns the sorter of the root directory
+func (o *Provider) sorter(root string) Sorter {
+	if sorter, ok := o.Sorters[root]; ok && sorter != nil {
+		return sorter
+	}
+	return ModTimeSorter{}
+}
+
+// probe sets the video info of the files with at most Workers probes at once,
+// it returns the errors of the files which can't be probed
+func (o *Provider) probe(files []File) []error {
+	errs := make([]error, len(files))
+	workers := max(o.Workers, 1)
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			files[i].Info, errs[i] = o.VideoInfoProvider.GetVideoInfo(files[i].Path)
+		}(i)
+	}
+	wg.Wait()
+	return errs
 }
@@ -1,8 +1,10 @@
 package finder
 
 import (
+	"errors"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -46,9 +48,10 @@ func TestListFilesSorted(t *testing.T) {
 
 		testVIP := NewTestVideoInfoProvider()
 		p := NewProvider(testVIP)
-		files, err := p.listFilesSorted(fsys, "", ".")
+		files, report, err := p.listFilesSorted(fsys, "", ".")
 		require.NoError(t, err)
 		require.Len(t, files, 3)
+		assert.Empty(t, report.Skipped)
 
 		expectedOrder := []string{"file2.txt", "file1.txt", "file3.txt"}
 		for i, name := range expectedOrder {
@@ -60,8 +63,80 @@ func TestListFilesSorted(t *testing.T) {
 		fsys := fstest.MapFS{}
 		testVIP := NewTestVideoInfoProvider()
 		p := NewProvider(testVIP)
-		files, err := p.listFilesSorted(fsys, "", "nonexistent")
+		files, _, err := p.listFilesSorted(fsys, "", "nonexistent")
 		assert.Error(t, err)
 		assert.Nil(t, files)
 	})
 }
+
+type fixedVideoInfoProvider struct {
+	info *VideoInfo
+	err  error
+}
+
+func (o fixedVideoInfoProvider) GetVideoInfo(path string) (*VideoInfo, error) {
+	return o.info, o.err
+}
+
+func TestGetFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mp4")
+	require.NoError(t, os.WriteFile(path, []byte("content"), 0o600))
+
+	p := NewProvider(fixedVideoInfoProvider{info: &VideoInfo{Width: 640}})
+	file, err := p.GetFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "clip.mp4", file.Name)
+	assert.Equal(t, path, file.Path)
+	assert.Equal(t, int64(7), file.Size)
+	assert.Equal(t, 640, file.Info.Width)
+
+	_, err = p.GetFile(dir)
+	assert.ErrorContains(t, err, "not a regular file")
+
+	_, err = p.GetFile(filepath.Join(dir, "missing.mp4"))
+	assert.Error(t, err)
+
+	p = NewProvider(fixedVideoInfoProvider{err: errors.New("not a video")})
+	_, err = p.GetFile(path)
+	assert.ErrorContains(t, err, "not a video")
+}
+
+// failingFor fails to probe the files with the listed names
+type failingFor map[string]error
+
+func (f failingFor) GetVideoInfo(path string) (*VideoInfo, error) {
+	if err, ok := f[filepath.Base(path)]; ok {
+		return nil, err
+	}
+	return &VideoInfo{Width: 640}, nil
+}
+
+func TestScan_Report(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"good.mp4", "notes.txt", "broken.mp4"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+	probe := failingFor{
+		"notes.txt": errors.New("not a video"),
+		"broken.mp4": chainError{
+			&ProbeError{Tool: "ffprobe", Err: errors.New("exit status 1"), Stderr: "[mov,mp4] stream 0, offset 0x30: partial file\nbroken.mp4: Invalid data found when processing input"},
+			errors.New("moov atom not found"),
+		},
+	}
+
+	files, report, err := NewProvider(probe).Scan(dir, ".")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "good.mp4", files[0].Name)
+	require.Len(t, report.Skipped, 2)
+
+	byPath := map[string]Skipped{}
+	for _, s := range report.Skipped {
+		byPath[filepath.Base(s.Path)] = s
+	}
+	assert.Equal(t, "not a video", byPath["notes.txt"].Reason)
+	assert.Empty(t, byPath["notes.txt"].Stderr)
+	assert.Equal(t, "ffprobe: exit status 1: broken.mp4: Invalid data found when processing input; moov atom not found", byPath["broken.mp4"].Reason)
+	assert.Contains(t, byPath["broken.mp4"].Stderr, "partial file")
+}
@@ -0,0 +1,36 @@
+package finder
+
+import "errors"
+
+// Skipped is a file left out of a scan
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	// Stderr is the output of the probe, empty if there is none
+	Stderr string `json:"stderr,omitempty"`
+}
+
+// ScanReport lists the files left out of a scan: non-videos, corrupt and unreadable files,
+// the copies of the same video found by Deduplicator and the near-duplicates found by SimilarFinder
+type ScanReport struct {
+	Skipped    []Skipped    `json:"skipped"`
+	Duplicates []Duplicates `json:"duplicates,omitempty"`
+	Similar    []Similar    `json:"similar,omitempty"`
+}
+
+// Add records the file skipped because of err
+func (r *ScanReport) Add(path string, err error) {
+	skipped := Skipped{Path: path, Reason: err.Error()}
+	var probeErr *ProbeError
+	if errors.As(err, &probeErr) {
+		skipped.Stderr = probeErr.Stderr
+	}
+	r.Skipped = append(r.Skipped, skipped)
+}
+
+// Merge appends the skipped files, the duplicates and the near-duplicates of the other report
+func (r *ScanReport) Merge(other ScanReport) {
+	r.Skipped = append(r.Skipped, other.Skipped...)
+	r.Duplicates = append(r.Duplicates, other.Duplicates...)
+	r.Similar = append(r.Similar, other.Similar...)
+}
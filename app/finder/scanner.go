@@ -0,0 +1,57 @@
+package finder
+
+// Scanner scans the sources in their order: the directories, the manifests, the remote sources and the archives
+type Scanner struct {
+	Provider *Provider
+	// Dirs are the directories with the files to send
+	Dirs []string
+	// Manifests list the files to send in their order, see ReadManifest
+	Manifests []string
+	Remotes   []*Remote
+	Archives  []*Archives
+	// Deduplicator finds the copies of the same video, nil disables the search
+	Deduplicator *Deduplicator
+	// SimilarFinder flags the near-duplicates, nil disables the fingerprints
+	SimilarFinder *SimilarFinder
+}
+
+// Scan returns the files of all sources and the report of the skipped, copied and similar files
+func (o *Scanner) Scan() ([]File, ScanReport, error) {
+	files := []File{}
+	var report ScanReport
+	add := func(found []File, foundReport ScanReport, err error) error {
+		if err != nil {
+			return err
+		}
+		files = append(files, found...)
+		report.Merge(foundReport)
+		return nil
+	}
+	for _, dir := range o.Dirs {
+		if err := add(o.Provider.Scan(dir, ".")); err != nil {
+			return nil, report, err
+		}
+	}
+	for _, manifest := range o.Manifests {
+		if err := add(o.Provider.ScanManifest(manifest)); err != nil {
+			return nil, report, err
+		}
+	}
+	for _, remote := range o.Remotes {
+		if err := add(o.Provider.ScanRemote(remote)); err != nil {
+			return nil, report, err
+		}
+	}
+	for _, archives := range o.Archives {
+		if err := add(o.Provider.ScanArchives(archives)); err != nil {
+			return nil, report, err
+		}
+	}
+	if o.Deduplicator != nil {
+		files = o.Deduplicator.Dedup(files, &report)
+	}
+	if o.SimilarFinder != nil {
+		o.SimilarFinder.Flag(files, &report)
+	}
+	return files, report, nil
+}
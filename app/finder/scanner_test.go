@@ -0,0 +1,41 @@
+package finder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Scan(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.mp4"), []byte("video"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("notes"), 0o600))
+	manifest := writeManifest(t, "list.m3u", "b.mp4\nc.mp4\n", "b.mp4", "c.mp4")
+	s := &Scanner{
+		Provider:     NewProvider(failingFor{"notes.txt": assert.AnError}),
+		Dirs:         []string{dir},
+		Manifests:    []string{manifest},
+		Deduplicator: NewDeduplicator(HashFast, DuplicatesSkip),
+	}
+
+	files, report, err := s.Scan()
+	require.NoError(t, err)
+	// a.mp4, b.mp4 and c.mp4 have the same content
+	assert.Empty(t, files)
+	require.Len(t, report.Duplicates, 1)
+	assert.Len(t, report.Skipped, 4)
+
+	s.Deduplicator = nil
+	files, report, err = s.Scan()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.mp4", "b.mp4", "c.mp4"}, names(files), "the directories go before the manifests")
+	require.Len(t, report.Skipped, 1)
+	assert.Equal(t, filepath.Join(dir, "notes.txt"), report.Skipped[0].Path)
+
+	s.Dirs = append(s.Dirs, filepath.Join(dir, "missing"))
+	_, _, err = s.Scan()
+	assert.ErrorContains(t, err, "failed to read directory")
+}
@@ -0,0 +1,146 @@
+package finder
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// sidecarExt is appended to the name of a video to get its sidecar, e.g. clip.mp4.json
+const sidecarExt = ".json"
+
+// Sidecar is a JSON file next to a video with the directives of its processing
+type Sidecar struct {
+	// Watermark is false if the video is sent without the watermark of the destination
+	Watermark *bool `json:"watermark,omitempty"`
+	// Start and End trim the video, End is zero to keep the end
+	Start Timestamp `json:"start,omitempty"`
+	End   Timestamp `json:"end,omitempty"`
+	// Segments are the parts of the video joined in order, instead of Start and End
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a part of a video, End is zero to keep the end
+type Segment struct {
+	Start Timestamp `json:"start"`
+	End   Timestamp `json:"end,omitempty"`
+}
+
+// Timestamp is an offset in a video in seconds, in JSON it is a number of seconds or a string "[hh:]mm:ss[.ms]"
+type Timestamp float64
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		var seconds float64
+		if err = json.Unmarshal(data, &seconds); err != nil {
+			return fmt.Errorf("timestamp %s is neither a number of seconds nor [hh:]mm:ss", data)
+		}
+		*t = Timestamp(seconds)
+		return nil
+	}
+	parsed, err := ParseTimestamp(text)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// ParseTimestamp parses seconds or "[hh:]mm:ss[.ms]"
+func ParseTimestamp(text string) (Timestamp, error) {
+	parts := strings.Split(strings.TrimSpace(text), ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("timestamp %q is neither a number of seconds nor [hh:]mm:ss", text)
+	}
+	var seconds float64
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		// only the seconds have a fraction
+		if err != nil || v < 0 || i < len(parts)-1 && strings.Contains(part, ".") {
+			return 0, fmt.Errorf("timestamp %q is neither a number of seconds nor [hh:]mm:ss", text)
+		}
+		seconds = seconds*60 + v
+	}
+	return Timestamp(seconds), nil
+}
+
+// Cuts returns the parts of the video to send, nil if it is sent whole
+func (s *Sidecar) Cuts() []Segment {
+	switch {
+	case s == nil:
+		return nil
+	case len(s.Segments) > 0:
+		return s.Segments
+	case s.Start > 0 || s.End > 0:
+		return []Segment{{Start: s.Start, End: s.End}}
+	}
+	return nil
+}
+
+// validate checks the trim directives
+func (s *Sidecar) validate() error {
+	if s.Start < 0 || s.End < 0 {
+		return errors.New("negative timestamp")
+	}
+	if len(s.Segments) > 0 && (s.Start > 0 || s.End > 0) {
+		return errors.New("start and end are ignored with segments")
+	}
+	for i, segment := range s.Cuts() {
+		if segment.Start < 0 || segment.End < 0 {
+			return fmt.Errorf("segment %d: negative timestamp", i+1)
+		}
+		if segment.End > 0 && segment.End <= segment.Start {
+			return fmt.Errorf("segment %d: end %.3f is not after start %.3f", i+1, segment.End, segment.Start)
+		}
+	}
+	return nil
+}
+
+// SidecarPath returns the path of the sidecar of the video
+func SidecarPath(path string) string {
+	return path + sidecarExt
+}
+
+// ReadSidecar reads the sidecar of the video, nil if there is none
+func ReadSidecar(path string) (*Sidecar, error) {
+	data, err := os.ReadFile(SidecarPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read sidecar: %w", err)
+	}
+	var s Sidecar
+	if err = json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse sidecar %s: %w", SidecarPath(path), err)
+	}
+	if err = s.validate(); err != nil {
+		return nil, fmt.Errorf("sidecar %s: %w", SidecarPath(path), err)
+	}
+	return &s, nil
+}
+
+// NoWatermark tells if the sidecar opts the video out of the watermark
+func (s *Sidecar) NoWatermark() bool {
+	return s != nil && s.Watermark != nil && !*s.Watermark
+}
+
+// withoutSidecars returns the files without the sidecars of the other files
+func withoutSidecars(files []File) []File {
+	paths := make(map[string]bool, len(files))
+	for _, file := range files {
+		paths[file.Path] = true
+	}
+	kept := files[:0]
+	for _, file := range files {
+		if video, ok := strings.CutSuffix(file.Path, sidecarExt); ok && paths[video] {
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
@@ -0,0 +1,105 @@
+package finder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSidecar(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mp4")
+
+	sidecar, err := ReadSidecar(path)
+	require.NoError(t, err)
+	assert.Nil(t, sidecar)
+	assert.False(t, sidecar.NoWatermark())
+
+	require.NoError(t, os.WriteFile(SidecarPath(path), []byte(`{"watermark": false}`), 0o600))
+	sidecar, err = ReadSidecar(path)
+	require.NoError(t, err)
+	assert.True(t, sidecar.NoWatermark())
+
+	require.NoError(t, os.WriteFile(SidecarPath(path), []byte(`{"watermark": true}`), 0o600))
+	sidecar, err = ReadSidecar(path)
+	require.NoError(t, err)
+	assert.False(t, sidecar.NoWatermark())
+
+	require.NoError(t, os.WriteFile(SidecarPath(path), []byte(`{`), 0o600))
+	_, err = ReadSidecar(path)
+	assert.ErrorContains(t, err, "parse sidecar")
+}
+
+func TestScan_Sidecars(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.mp4":           "a",
+		"a.mp4.json":      `{"watermark": false}`,
+		"b.mp4":           "b",
+		"b.mp4.json":      `{`,
+		"orphan.mp4.json": `{}`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	found, report, err := NewProvider(failingFor{"orphan.mp4.json": errors.New("not a video")}).Scan(dir, ".")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "a.mp4", found[0].Name)
+	assert.True(t, found[0].Sidecar.NoWatermark())
+
+	require.Len(t, report.Skipped, 2, "the sidecars of the videos aren't reported")
+	byPath := map[string]Skipped{}
+	for _, s := range report.Skipped {
+		byPath[filepath.Base(s.Path)] = s
+	}
+	assert.Contains(t, byPath["b.mp4"].Reason, "parse sidecar")
+	assert.Equal(t, "not a video", byPath["orphan.mp4.json"].Reason)
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := map[string]Timestamp{"90": 90, "1:30": 90, "01:02:03.5": 3723.5, "0:05.25": 5.25}
+	for text, want := range tests {
+		got, err := ParseTimestamp(text)
+		require.NoError(t, err, text)
+		assert.InDelta(t, float64(want), float64(got), 1e-9, text)
+	}
+	for _, text := range []string{"", "abc", "1.5:30", "1:2:3:4", "-5"} {
+		_, err := ParseTimestamp(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestReadSidecar_Trim(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mp4")
+	read := func(content string) (*Sidecar, error) {
+		require.NoError(t, os.WriteFile(SidecarPath(path), []byte(content), 0o600))
+		return ReadSidecar(path)
+	}
+
+	sidecar, err := read(`{"start": "0:05", "end": 62.5}`)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{{Start: 5, End: 62.5}}, sidecar.Cuts())
+
+	sidecar, err = read(`{"segments": [{"start": 0, "end": "1:00"}, {"start": "2:00"}]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []Segment{{Start: 0, End: 60}, {Start: 120}}, sidecar.Cuts())
+
+	sidecar, err = read(`{"watermark": false}`)
+	require.NoError(t, err)
+	assert.Nil(t, sidecar.Cuts())
+
+	_, err = read(`{"start": 10, "end": 5}`)
+	assert.ErrorContains(t, err, "segment 1: end 5.000 is not after start 10.000")
+	_, err = read(`{"start": 1, "segments": [{"start": 2}]}`)
+	assert.ErrorContains(t, err, "start and end are ignored with segments")
+	_, err = read(`{"start": -1}`)
+	assert.ErrorContains(t, err, "negative timestamp")
+	_, err = read(`{"start": "soon"}`)
+	assert.ErrorContains(t, err, `timestamp "soon"`)
+}
@@ -0,0 +1,241 @@
+package finder
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Sorter orders the files of a source, the files come sorted by name
+type Sorter interface {
+	Sort(files []File) error
+}
+
+// Sort orders of the sources
+const (
+	SortName     = "name"
+	SortModTime  = "mtime"
+	SortCreated  = "created"
+	SortSize     = "size"
+	SortDuration = "duration"
+	SortRandom   = "random"
+	SortPlaylist = "playlist"
+)
+
+// SortNames lists the names accepted by NewSorter
+var SortNames = []string{SortName, SortModTime, SortCreated, SortSize, SortDuration, SortRandom, SortPlaylist}
+
+// NewSorter returns the sorter by its name, mtime if the name is empty.
+// The seed is used by random only, the playlist is the path of the playlist file.
+func NewSorter(name string, seed int64, playlist string) (Sorter, error) {
+	switch name {
+	case "", SortModTime:
+		return ModTimeSorter{}, nil
+	case SortName:
+		return NameSorter{}, nil
+	case SortCreated:
+		return CreatedSorter{}, nil
+	case SortSize:
+		return SizeSorter{}, nil
+	case SortDuration:
+		return DurationSorter{}, nil
+	case SortRandom:
+		return ShuffleSorter{Seed: seed}, nil
+	case SortPlaylist:
+		if playlist == "" {
+			return nil, fmt.Errorf("playlist file is required")
+		}
+		return PlaylistSorter{Path: playlist}, nil
+	}
+	return nil, fmt.Errorf("%q is not one of %s", name, strings.Join(SortNames, ", "))
+}
+
+// ModTimeSorter orders the files by modification time, oldest first
+type ModTimeSorter struct{}
+
+func (ModTimeSorter) Sort(files []File) error {
+	slices.SortStableFunc(files, func(a, b File) int {
+		return a.ModTime.Compare(b.ModTime)
+	})
+	return nil
+}
+
+// NameSorter orders the files by name with the numbers compared by value, so ep2 goes before ep10
+type NameSorter struct{}
+
+func (NameSorter) Sort(files []File) error {
+	slices.SortStableFunc(files, func(a, b File) int {
+		return CompareNatural(a.Name, b.Name)
+	})
+	return nil
+}
+
+// CreatedSorter orders the files by creation time of the metadata, oldest first.
+// The files without it are ordered by modification time.
+type CreatedSorter struct{}
+
+func (CreatedSorter) Sort(files []File) error {
+	created := func(f File) time.Time {
+		if f.Info != nil && !f.Info.CreatedAt.IsZero() {
+			return f.Info.CreatedAt
+		}
+		return f.ModTime
+	}
+	slices.SortStableFunc(files, func(a, b File) int {
+		return created(a).Compare(created(b))
+	})
+	return nil
+}
+
+// SizeSorter orders the files by size, smallest first
+type SizeSorter struct{}
+
+func (SizeSorter) Sort(files []File) error {
+	slices.SortStableFunc(files, func(a, b File) int {
+		return cmp.Compare(a.Size, b.Size)
+	})
+	return nil
+}
+
+// DurationSorter orders the files by duration, shortest first
+type DurationSorter struct{}
+
+func (DurationSorter) Sort(files []File) error {
+	duration := func(f File) int {
+		if f.Info == nil {
+			return 0
+		}
+		return f.Info.Duration
+	}
+	slices.SortStableFunc(files, func(a, b File) int {
+		return cmp.Compare(duration(a), duration(b))
+	})
+	return nil
+}
+
+// ShuffleSorter shuffles the files, the same seed gives the same order of the same files.
+// Zero seed gives a new order on every scan.
+type ShuffleSorter struct {
+	Seed int64
+}
+
+func (s ShuffleSorter) Sort(files []File) error {
+	seed := uint64(s.Seed)
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	r := rand.New(rand.NewPCG(seed, 0))
+	r.Shuffle(len(files), func(i, j int) {
+		files[i], files[j] = files[j], files[i]
+	})
+	return nil
+}
+
+// PlaylistSorter orders the files as listed in the playlist file, one name or path per line.
+// Empty lines and lines starting with # are ignored, so M3U playlists work too.
+// The files missing in the playlist go after the listed ones by modification time.
+type PlaylistSorter struct {
+	Path string
+}
+
+func (s PlaylistSorter) Sort(files []File) error {
+	entries, err := readPlaylist(s.Path)
+	if err != nil {
+		return err
+	}
+	// a file is found by its path, its name or its path relative to the playlist
+	dir := filepath.Dir(s.Path)
+	position := func(f File) int {
+		rel, err := filepath.Rel(dir, f.Path)
+		if err != nil {
+			rel = ""
+		}
+		for _, key := range []string{f.Path, rel, f.Name} {
+			if i, ok := entries[filepath.Clean(key)]; ok {
+				return i
+			}
+		}
+		return len(entries)
+	}
+	_ = ModTimeSorter{}.Sort(files)
+	slices.SortStableFunc(files, func(a, b File) int {
+		return cmp.Compare(position(a), position(b))
+	})
+	return nil
+}
+
+// readPlaylist returns the positions of the entries of the playlist
+func readPlaylist(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	defer f.Close()
+
+	entries := map[string]int{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key := filepath.Clean(line)
+		if _, ok := entries[key]; ok {
+			log.Printf("[DEBUG] %s is listed twice in %s", line, path)
+			continue
+		}
+		entries[key] = len(entries)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read playlist: %w", err)
+	}
+	return entries, nil
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+// CompareNatural compares the strings case-insensitively with the runs of digits compared by value
+func CompareNatural(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	i, j := 0, 0
+	for i < len(ra) && j < len(rb) {
+		if isDigit(ra[i]) && isDigit(rb[j]) {
+			ni, nj := i, j
+			for ni < len(ra) && isDigit(ra[ni]) {
+				ni++
+			}
+			for nj < len(rb) && isDigit(rb[nj]) {
+				nj++
+			}
+			da := strings.TrimLeft(string(ra[i:ni]), "0")
+			db := strings.TrimLeft(string(rb[j:nj]), "0")
+			if c := cmp.Compare(len(da), len(db)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(da, db); c != 0 {
+				return c
+			}
+			i, j = ni, nj
+			continue
+		}
+		if c := cmp.Compare(unicode.ToLower(ra[i]), unicode.ToLower(rb[j])); c != 0 {
+			return c
+		}
+		i++
+		j++
+	}
+	if c := cmp.Compare(len(ra)-i, len(rb)-j); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
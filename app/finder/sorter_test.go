@@ -0,0 +1,114 @@
+package finder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func names(files []File) []string {
+	list := make([]string, 0, len(files))
+	for _, f := range files {
+		list = append(list, f.Name)
+	}
+	return list
+}
+
+func TestCompareNatural(t *testing.T) {
+	assert.Negative(t, CompareNatural("ep2.mp4", "ep10.mp4"))
+	assert.Negative(t, CompareNatural("Ep1", "ep02"))
+	assert.Positive(t, CompareNatural("b", "A"))
+	assert.Negative(t, CompareNatural("ep", "ep1"))
+	assert.Negative(t, CompareNatural("ep01", "ep1"), "equal numbers are ordered by text")
+}
+
+func TestSorters(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	newFiles := func() []File {
+		return []File{
+			{Name: "ep1.mp4", ModTime: day(3), Size: 30, Info: &VideoInfo{Duration: 20}},
+			{Name: "ep10.mp4", ModTime: day(1), Size: 10, Info: &VideoInfo{Duration: 30, CreatedAt: day(20)}},
+			{Name: "ep2.mp4", ModTime: day(2), Size: 20, Info: &VideoInfo{Duration: 10}},
+		}
+	}
+	tests := []struct {
+		sorter Sorter
+		want   []string
+	}{
+		{ModTimeSorter{}, []string{"ep10.mp4", "ep2.mp4", "ep1.mp4"}},
+		{NameSorter{}, []string{"ep1.mp4", "ep2.mp4", "ep10.mp4"}},
+		{CreatedSorter{}, []string{"ep2.mp4", "ep1.mp4", "ep10.mp4"}},
+		{SizeSorter{}, []string{"ep10.mp4", "ep2.mp4", "ep1.mp4"}},
+		{DurationSorter{}, []string{"ep2.mp4", "ep1.mp4", "ep10.mp4"}},
+	}
+	for _, tt := range tests {
+		files := newFiles()
+		require.NoError(t, tt.sorter.Sort(files))
+		assert.Equal(t, tt.want, names(files), "%T", tt.sorter)
+	}
+
+	first, second := newFiles(), newFiles()
+	require.NoError(t, ShuffleSorter{Seed: 42}.Sort(first))
+	require.NoError(t, ShuffleSorter{Seed: 42}.Sort(second))
+	assert.Equal(t, names(first), names(second), "the same seed gives the same order")
+	assert.ElementsMatch(t, names(newFiles()), names(first))
+}
+
+func TestPlaylistSorter(t *testing.T) {
+	dir := t.TempDir()
+	playlist := filepath.Join(dir, "playlist.m3u")
+	require.NoError(t, os.WriteFile(playlist, []byte("#EXTM3U\nc.mp4\n\nsub/../a.mp4\nmissing.mp4\n"), 0o600))
+	files := []File{
+		{Name: "a.mp4", Path: filepath.Join(dir, "a.mp4"), ModTime: time.Unix(3, 0)},
+		{Name: "b.mp4", Path: filepath.Join(dir, "b.mp4"), ModTime: time.Unix(2, 0)},
+		{Name: "c.mp4", Path: filepath.Join(dir, "c.mp4"), ModTime: time.Unix(4, 0)},
+		{Name: "d.mp4", Path: filepath.Join(dir, "d.mp4"), ModTime: time.Unix(1, 0)},
+	}
+
+	require.NoError(t, PlaylistSorter{Path: playlist}.Sort(files))
+	assert.Equal(t, []string{"c.mp4", "a.mp4", "d.mp4", "b.mp4"}, names(files), "the unlisted files go last by modification time")
+
+	err := PlaylistSorter{Path: filepath.Join(dir, "missing.m3u")}.Sort(files)
+	assert.ErrorContains(t, err, "failed to read playlist")
+}
+
+func TestNewSorter(t *testing.T) {
+	sorter, err := NewSorter("", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, ModTimeSorter{}, sorter)
+	sorter, err = NewSorter(SortRandom, 7, "")
+	require.NoError(t, err)
+	assert.Equal(t, ShuffleSorter{Seed: 7}, sorter)
+
+	_, err = NewSorter(SortPlaylist, 0, "")
+	assert.ErrorContains(t, err, "playlist file is required")
+	_, err = NewSorter("alpha", 0, "")
+	assert.ErrorContains(t, err, `"alpha" is not one of name, mtime`)
+}
+
+func TestScan_Sorter(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"ep10.mp4", "ep2.mp4", "ep1.mp4"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("video"), 0o600))
+		require.NoError(t, os.Chtimes(path, time.Unix(int64(i), 0), time.Unix(int64(i), 0)))
+	}
+	p := NewProvider(NewTestVideoInfoProvider())
+
+	files, _, err := p.Scan(dir, ".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ep10.mp4", "ep2.mp4", "ep1.mp4"}, names(files), "by modification time by default")
+
+	p.Sorters = map[string]Sorter{dir: NameSorter{}}
+	files, _, err = p.Scan(dir, ".")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ep1.mp4", "ep2.mp4", "ep10.mp4"}, names(files))
+
+	p.Sorters[dir] = PlaylistSorter{Path: filepath.Join(dir, "missing.m3u")}
+	_, _, err = p.Scan(dir, ".")
+	assert.ErrorContains(t, err, "failed to sort files of "+dir)
+}
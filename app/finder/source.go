@@ -0,0 +1,210 @@
+package finder
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Object is a file of a Source
+type Object struct {
+	// Path is slash-separated and relative to the root of the source
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Source is a remote storage with the videos: an S3 bucket, an SFTP or a WebDAV server
+type Source interface {
+	// List returns the files in the root of the source, the directories are left out
+	List() ([]Object, error)
+	Open(path string) (io.ReadCloser, error)
+	Remove(path string) error
+	// Rename moves the file, the directories of newPath are created if needed
+	Rename(path, newPath string) error
+}
+
+// RemoteFile is the origin of a file of a Source
+type RemoteFile struct {
+	// Source is the name of the Remote
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	// Pending is true until the file is downloaded by Remote.Download
+	Pending bool `json:"pending,omitempty"`
+}
+
+// Actions of Remote.AfterSend
+const (
+	AfterSendKeep   = "keep"
+	AfterSendDelete = "delete"
+	AfterSendMove   = "move"
+)
+
+// Remote lists the files of a Source and downloads them into a local work directory when they are sent,
+// so they are probed and sent like the local ones
+type Remote struct {
+	Name   string
+	Source Source
+	// WorkDir keeps the downloaded files, a file is downloaded again when its size or modification time change
+	WorkDir string
+	// AfterSend is done with the sent file: keep, delete or move to MoveTo
+	AfterSend string
+	MoveTo    string
+}
+
+// Fetch lists the source, the files removed from the source are removed from the work directory.
+// The videos are pending with the listed size and modification time unless their copy is downloaded already,
+// only the sidecars are downloaded. The sidecars which can't be downloaded are added to the report.
+func (r *Remote) Fetch() ([]File, ScanReport, error) {
+	var report ScanReport
+	objects, err := r.Source.List()
+	if err != nil {
+		return nil, report, errors.Wrapf(err, "failed to list %s", r.Name)
+	}
+	if err = os.MkdirAll(r.WorkDir, 0o755); err != nil {
+		return nil, report, errors.Wrap(err, "failed to create work directory")
+	}
+
+	files := make([]File, 0, len(objects))
+	listed := make(map[string]bool, len(objects))
+	for _, obj := range objects {
+		local := r.localPath(obj.Path)
+		listed[filepath.Base(local)] = true
+		// the sidecars are small and read by the scan
+		if strings.HasSuffix(obj.Path, sidecarExt) {
+			if err := r.download(obj.Path, local, obj.Size, obj.ModTime); err != nil {
+				report.Add(r.Name+":"+obj.Path, err)
+				continue
+			}
+		}
+		files = append(files, File{
+			Name:    path.Base(obj.Path),
+			ModTime: obj.ModTime,
+			Size:    obj.Size,
+			Path:    local,
+			Remote:  &RemoteFile{Source: r.Name, Path: obj.Path, Pending: !fresh(local, obj.Size, obj.ModTime)},
+		})
+	}
+	r.prune(listed)
+	return files, report, nil
+}
+
+// Download copies the pending file of the source to its path in the work directory
+// and returns the downloaded file
+func (r *Remote) Download(file File) (File, error) {
+	if file.Remote == nil || file.Remote.Source != r.Name {
+		return file, fmt.Errorf("%s is not a file of %s", file.Path, r.Name)
+	}
+	if err := r.download(file.Remote.Path, file.Path, file.Size, file.ModTime); err != nil {
+		return file, errors.Wrapf(err, "failed to download %s:%s", r.Name, file.Remote.Path)
+	}
+	remote := *file.Remote
+	remote.Pending = false
+	file.Remote = &remote
+	return file, nil
+}
+
+func (r *Remote) download(objPath, local string, size int64, modTime time.Time) error {
+	open := func() (io.ReadCloser, error) { return r.Source.Open(objPath) }
+	return fetch(r.Name+":"+objPath, local, size, modTime, open)
+}
+
+// localPath returns the path of the downloaded file, the source is listed without the subdirectories
+func (r *Remote) localPath(objPath string) string {
+	return filepath.Join(r.WorkDir, path.Base(objPath))
+}
+
+// fetch copies the file opened by open to local unless the local file has the same size and modification time
+func fetch(name, local string, size int64, modTime time.Time, open func() (io.ReadCloser, error)) error {
+	if fresh(local, size, modTime) {
+		return nil
+	}
+	log.Printf("[DEBUG] fetch %s to %s", name, local)
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return err
+	}
+	src, err := open()
+	if err != nil {
+		return errors.Wrap(err, "failed to open")
+	}
+	defer src.Close()
+
+	// the file appears at once, so a broken download isn't taken for a complete one
+	tmp := local + ".part"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("copied %d of %d bytes", n, size)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return errors.Wrap(err, "failed to copy")
+	}
+	if err = os.Chtimes(tmp, modTime, modTime); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, local)
+}
+
+// fresh tells if the local copy has the size and the modification time
+func fresh(local string, size int64, modTime time.Time) bool {
+	info, err := os.Stat(local)
+	return err == nil && info.Size() == size && info.ModTime().Equal(modTime)
+}
+
+// prune removes the downloaded files which aren't in the source anymore
+func (r *Remote) prune(listed map[string]bool) {
+	entries, err := os.ReadDir(r.WorkDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || listed[entry.Name()] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.WorkDir, entry.Name())); err != nil {
+			log.Printf("[WARN] can't remove %s: %v", entry.Name(), err)
+		}
+	}
+}
+
+// Sent does the AfterSend action with the sent file of the source,
+// the downloaded copy is removed unless the file is kept
+func (r *Remote) Sent(file File) error {
+	if file.Remote == nil || file.Remote.Source != r.Name {
+		return fmt.Errorf("%s is not a file of %s", file.Path, r.Name)
+	}
+	switch r.AfterSend {
+	case "", AfterSendKeep:
+		return nil
+	case AfterSendDelete:
+		if err := r.Source.Remove(file.Remote.Path); err != nil {
+			return errors.Wrapf(err, "failed to delete %s:%s", r.Name, file.Remote.Path)
+		}
+	case AfterSendMove:
+		newPath := path.Join(r.MoveTo, path.Base(file.Remote.Path))
+		if err := r.Source.Rename(file.Remote.Path, newPath); err != nil {
+			return errors.Wrapf(err, "failed to move %s:%s", r.Name, file.Remote.Path)
+		}
+	default:
+		return fmt.Errorf("unknown action %q after send", r.AfterSend)
+	}
+	if err := os.Remove(file.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("[WARN] can't remove %s: %v", file.Path, err)
+	}
+	return nil
+}
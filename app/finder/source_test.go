@@ -0,0 +1,131 @@
+package finder
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memSource is a Source in memory counting the opened files
+type memSource struct {
+	files  map[string][]byte
+	times  map[string]time.Time
+	opened int
+}
+
+func newMemSource() *memSource {
+	return &memSource{files: map[string][]byte{}, times: map[string]time.Time{}}
+}
+
+func (m *memSource) put(p, data string, modTime time.Time) {
+	m.files[p] = []byte(data)
+	m.times[p] = modTime
+}
+
+func (m *memSource) List() ([]Object, error) {
+	var list []Object
+	for p, data := range m.files {
+		if path.Dir(p) == "." {
+			list = append(list, Object{Path: p, Size: int64(len(data)), ModTime: m.times[p]})
+		}
+	}
+	return list, nil
+}
+
+func (m *memSource) Open(p string) (io.ReadCloser, error) {
+	data, ok := m.files[p]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	m.opened++
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *memSource) Remove(p string) error {
+	delete(m.files, p)
+	return nil
+}
+
+func (m *memSource) Rename(p, newPath string) error {
+	m.files[newPath], m.times[newPath] = m.files[p], m.times[p]
+	return m.Remove(p)
+}
+
+func TestRemote_Fetch(t *testing.T) {
+	src := newMemSource()
+	src.put("a.mp4", "video a", time.Unix(100, 0))
+	src.put("a.mp4.json", `{"start": 2}`, time.Unix(100, 0))
+	src.put("b.mp4", "video b", time.Unix(50, 0))
+	src.put("sent/c.mp4", "video c", time.Unix(10, 0))
+	src.put("notes.txt", "notes", time.Unix(10, 0))
+	r := &Remote{Name: "s3", Source: src, WorkDir: t.TempDir()}
+
+	// the scan downloads only the sidecars, the videos are pending with the listed size and time
+	files, report, err := NewProvider(NewTestVideoInfoProvider()).ScanRemote(r)
+	require.NoError(t, err)
+	assert.Equal(t, []Skipped{{Path: "s3:notes.txt", Reason: "not a video by its extension"}}, report.Skipped)
+	assert.Equal(t, []string{"b.mp4", "a.mp4"}, names(files))
+	assert.Equal(t, &RemoteFile{Source: "s3", Path: "b.mp4", Pending: true}, files[0].Remote)
+	assert.Equal(t, int64(7), files[0].Size)
+	assert.Nil(t, files[0].Info)
+	assert.Equal(t, Timestamp(2), files[1].Sidecar.Start)
+	assert.Equal(t, 1, src.opened)
+	assert.NoFileExists(t, files[0].Path)
+
+	b, err := r.Download(files[0])
+	require.NoError(t, err)
+	assert.False(t, b.Pending())
+	assert.True(t, files[0].Pending(), "the scanned file is kept")
+	data, err := os.ReadFile(b.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "video b", string(data))
+	info, err := os.Stat(b.Path)
+	require.NoError(t, err)
+	assert.True(t, info.ModTime().Equal(time.Unix(50, 0)))
+
+	// the downloaded file isn't pending for the next scan and isn't downloaded again
+	files, _, err = NewProvider(NewTestVideoInfoProvider()).ScanRemote(r)
+	require.NoError(t, err)
+	assert.False(t, files[0].Pending())
+	_, err = r.Download(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, 2, src.opened)
+
+	// the removed files are pruned
+	require.NoError(t, src.Remove("b.mp4"))
+	files, _, err = r.Fetch()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.mp4", "a.mp4.json", "notes.txt"}, names(files))
+	assert.NoFileExists(t, filepath.Join(r.WorkDir, "b.mp4"))
+	_, err = r.Download(File{Path: "local.mp4"})
+	assert.ErrorContains(t, err, "local.mp4 is not a file of s3")
+}
+
+func TestRemote_Sent(t *testing.T) {
+	src := newMemSource()
+	src.put("a.mp4", "video a", time.Unix(100, 0))
+	src.put("b.mp4", "video b", time.Unix(100, 0))
+	r := &Remote{Name: "sftp", Source: src, WorkDir: t.TempDir(), AfterSend: AfterSendMove, MoveTo: "sent"}
+	files, _, err := r.Fetch()
+	require.NoError(t, err)
+
+	require.NoError(t, r.Sent(files[0]))
+	assert.Contains(t, src.files, "sent/"+files[0].Name)
+	assert.NotContains(t, src.files, files[0].Name)
+	_, err = os.Stat(files[0].Path)
+	assert.ErrorIs(t, err, os.ErrNotExist, "the downloaded copy is removed")
+
+	r.AfterSend = AfterSendDelete
+	require.NoError(t, r.Sent(files[1]))
+	assert.NotContains(t, src.files, files[1].Name)
+
+	err = r.Sent(File{Path: "local.mp4"})
+	assert.ErrorContains(t, err, "local.mp4 is not a file of sftp")
+}
@@ -0,0 +1,104 @@
+// Package storage implements finder.Source for the remote storages: S3-compatible, SFTP and WebDAV
+package storage
+
+import (
+	"context"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// S3Options configure S3 source
+type S3Options struct {
+	// Endpoint is host[:port] of the storage, e.g. s3.amazonaws.com or minio:9000
+	Endpoint  string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	Region    string
+	// Insecure uses plain HTTP
+	Insecure bool
+}
+
+// S3 lists the objects of a bucket under the prefix
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 creates the source of an S3-compatible storage, it doesn't connect until the first request
+func NewS3(opts S3Options) (*S3, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: !opts.Insecure,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create S3 client")
+	}
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: opts.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3) List() ([]finder.Object, error) {
+	var objects []finder.Object
+	for info := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: s.prefix}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		// the common prefixes are the directories
+		if strings.HasSuffix(info.Key, "/") {
+			continue
+		}
+		objects = append(objects, finder.Object{
+			Path:    strings.TrimPrefix(info.Key, s.prefix),
+			Size:    info.Size,
+			ModTime: info.LastModified,
+		})
+	}
+	return objects, nil
+}
+
+func (s *S3) Open(p string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, s.key(p), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// the object is requested lazily, Stat reports a missing one
+	if _, err = obj.Stat(); err != nil {
+		_ = obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3) Remove(p string) error {
+	return s.client.RemoveObject(context.Background(), s.bucket, s.key(p), minio.RemoveObjectOptions{})
+}
+
+// Rename copies the object and removes the source, S3 has no directories to create
+func (s *S3) Rename(p, newPath string) error {
+	_, err := s.client.CopyObject(context.Background(),
+		minio.CopyDestOptions{Bucket: s.bucket, Object: s.key(newPath)},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: s.key(p)},
+	)
+	if err != nil {
+		return err
+	}
+	return s.Remove(p)
+}
+
+func (s *S3) key(p string) string {
+	return s.prefix + path.Clean(strings.TrimPrefix(p, "/"))
+}
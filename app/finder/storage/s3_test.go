@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is a bucket in memory serving the requests of List, Open, Remove and Rename
+type fakeS3 struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]string
+	modTime time.Time
+}
+
+type listResult struct {
+	XMLName        xml.Name `xml:"ListBucketResult"`
+	Name           string
+	Prefix         string
+	KeyCount       int
+	MaxKeys        int
+	IsTruncated    bool
+	Contents       []listObject
+	CommonPrefixes []struct{ Prefix string }
+}
+
+type listObject struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("delimiter"))
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Last-Modified", f.modTime.UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method == http.MethodGet {
+			_, _ = io.WriteString(w, data)
+		}
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		src, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		src = strings.TrimPrefix(strings.TrimPrefix(src, "/"), f.bucket+"/")
+		f.objects[key] = f.objects[src]
+		w.Header().Set("Content-Type", "application/xml")
+		_, _ = fmt.Fprintf(w, "<CopyObjectResult><LastModified>%s</LastModified><ETag>\"etag\"</ETag></CopyObjectResult>",
+			f.modTime.UTC().Format(time.RFC3339))
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "not implemented", http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, delimiter string) {
+	res := listResult{Name: f.bucket, Prefix: prefix, MaxKeys: 1000}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			dir := key[:len(prefix)+i+1]
+			if !seen[dir] {
+				seen[dir] = true
+				res.CommonPrefixes = append(res.CommonPrefixes, struct{ Prefix string }{dir})
+			}
+			continue
+		}
+		res.Contents = append(res.Contents, listObject{Key: key, LastModified: f.modTime, ETag: `"etag"`, Size: int64(len(f.objects[key]))})
+	}
+	res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+func TestS3(t *testing.T) {
+	modTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	fake := &fakeS3{bucket: "videos", modTime: modTime, objects: map[string]string{
+		"incoming/a.mp4":     "video a",
+		"incoming/sub/b.mp4": "video b",
+		"incoming/notes.txt": "notes",
+		"other/c.mp4":        "video c",
+		"incoming-old/d.mp4": "video d",
+	}}
+	ts := httptest.NewServer(fake)
+	t.Cleanup(ts.Close)
+
+	s3, err := NewS3(S3Options{
+		Endpoint: strings.TrimPrefix(ts.URL, "http://"), Bucket: "videos", Prefix: "/incoming/",
+		AccessKey: "key", SecretKey: "secret", Region: "us-east-1", Insecure: true,
+	})
+	require.NoError(t, err)
+
+	objects, err := s3.List()
+	require.NoError(t, err)
+	require.Len(t, objects, 2)
+	assert.Equal(t, "a.mp4", objects[0].Path)
+	assert.Equal(t, int64(7), objects[0].Size)
+	assert.True(t, objects[0].ModTime.Equal(modTime))
+	assert.Equal(t, "notes.txt", objects[1].Path)
+
+	rc, err := s3.Open("a.mp4")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "video a", string(data))
+	_, err = s3.Open("missing.mp4")
+	assert.Error(t, err)
+
+	require.NoError(t, s3.Rename("a.mp4", "sent/a.mp4"))
+	assert.Equal(t, "video a", fake.objects["incoming/sent/a.mp4"])
+	assert.NotContains(t, fake.objects, "incoming/a.mp4")
+
+	require.NoError(t, s3.Remove("notes.txt"))
+	assert.NotContains(t, fake.objects, "incoming/notes.txt")
+}
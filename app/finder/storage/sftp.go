@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"io"
+	"log"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// SFTPOptions configure SFTP source
+type SFTPOptions struct {
+	// Addr is host:port of the server
+	Addr string
+	User string
+	// Password or KeyFile with a private key authenticate the user
+	Password string
+	KeyFile  string
+	// KnownHosts is the file with the host keys, InsecureHostKey skips the check if it is empty
+	KnownHosts      string
+	InsecureHostKey bool
+	// Dir with the videos on the server
+	Dir     string
+	Timeout time.Duration
+}
+
+// SFTP lists the files of a directory on an SFTP server, it reconnects after a connection failure
+type SFTP struct {
+	dial func() (*sftp.Client, error)
+	dir  string
+
+	mu     sync.Mutex
+	client *sftp.Client
+}
+
+// NewSFTP creates the source of the directory, dial connects to the server on the first request
+// and after the connection is lost
+func NewSFTP(dial func() (*sftp.Client, error), dir string) *SFTP {
+	if dir == "" {
+		dir = "."
+	}
+	return &SFTP{dial: dial, dir: dir}
+}
+
+// DialSFTP returns the function connecting to the server over SSH
+func DialSFTP(opts SFTPOptions) (func() (*sftp.Client, error), error) {
+	config := &ssh.ClientConfig{User: opts.User, Timeout: opts.Timeout}
+	if opts.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(opts.Password))
+	}
+	if opts.KeyFile != "" {
+		key, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read key")
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse key")
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	switch {
+	case opts.KnownHosts != "":
+		callback, err := knownhosts.New(opts.KnownHosts)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read known hosts")
+		}
+		config.HostKeyCallback = callback
+	case opts.InsecureHostKey:
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey() //nolint:gosec // explicitly configured
+	default:
+		return nil, errors.New("known hosts file is required to check the host key")
+	}
+
+	return func() (*sftp.Client, error) {
+		conn, err := ssh.Dial("tcp", opts.Addr, config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to connect to %s", opts.Addr)
+		}
+		client, err := sftp.NewClient(conn)
+		if err != nil {
+			_ = conn.Close()
+			return nil, errors.Wrap(err, "failed to start sftp")
+		}
+		return client, nil
+	}, nil
+}
+
+// do runs fn with the client, the client is dropped after a connection error
+func (s *SFTP) do(fn func(client *sftp.Client) error) error {
+	s.mu.Lock()
+	if s.client == nil {
+		client, err := s.dial()
+		if err != nil {
+			s.mu.Unlock()
+			return err
+		}
+		s.client = client
+	}
+	client := s.client
+	s.mu.Unlock()
+
+	err := fn(client)
+	var status *sftp.StatusError
+	if err != nil && !errors.As(err, &status) && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission) {
+		log.Printf("[DEBUG] sftp connection is dropped: %v", err)
+		s.mu.Lock()
+		if s.client == client {
+			s.client = nil
+		}
+		s.mu.Unlock()
+		_ = client.Close()
+	}
+	return err
+}
+
+func (s *SFTP) List() ([]finder.Object, error) {
+	var objects []finder.Object
+	err := s.do(func(client *sftp.Client) error {
+		infos, err := client.ReadDir(s.dir)
+		if err != nil {
+			return errors.Wrap(err, "failed to read directory")
+		}
+		for _, info := range infos {
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			objects = append(objects, finder.Object{Path: info.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func (s *SFTP) Open(p string) (io.ReadCloser, error) {
+	var file *sftp.File
+	err := s.do(func(client *sftp.Client) (err error) {
+		file, err = client.Open(s.path(p))
+		return err
+	})
+	return file, err
+}
+
+func (s *SFTP) Remove(p string) error {
+	return s.do(func(client *sftp.Client) error {
+		return client.Remove(s.path(p))
+	})
+}
+
+func (s *SFTP) Rename(p, newPath string) error {
+	return s.do(func(client *sftp.Client) error {
+		if err := client.MkdirAll(path.Dir(s.path(newPath))); err != nil {
+			return errors.Wrap(err, "failed to create directory")
+		}
+		return client.Rename(s.path(p), s.path(newPath))
+	})
+}
+
+// Close closes the connection
+func (s *SFTP) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+func (s *SFTP) path(p string) string {
+	return path.Join(s.dir, p)
+}
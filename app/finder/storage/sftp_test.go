@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pipeConn joins the ends of two pipes into a connection
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// startSFTP serves the local directory with an in-process server and returns the dial function of its clients
+func startSFTP(t *testing.T, root string) (dial func() (*sftp.Client, error), dials *int) {
+	t.Helper()
+	dials = new(int)
+	return func() (*sftp.Client, error) {
+		*dials++
+		serverRead, clientWrite := io.Pipe()
+		clientRead, serverWrite := io.Pipe()
+		server, err := sftp.NewServer(pipeConn{serverRead, serverWrite}, sftp.WithServerWorkingDirectory(root))
+		require.NoError(t, err)
+		go func() {
+			_ = server.Serve()
+			_ = server.Close()
+		}()
+		return sftp.NewClientPipe(clientRead, clientWrite)
+	}, dials
+}
+
+func TestSFTP(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "videos", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "videos", "a.mp4"), []byte("video a"), 0o600))
+	modTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "videos", "a.mp4"), modTime, modTime))
+
+	dial, dials := startSFTP(t, root)
+	s := NewSFTP(dial, "videos")
+	t.Cleanup(func() { _ = s.Close() })
+
+	objects, err := s.List()
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "a.mp4", objects[0].Path)
+	assert.Equal(t, int64(7), objects[0].Size)
+	assert.True(t, objects[0].ModTime.Equal(modTime))
+
+	rc, err := s.Open("a.mp4")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "video a", string(data))
+
+	_, err = s.Open("missing.mp4")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 1, *dials, "the connection is kept after a missing file")
+
+	require.NoError(t, s.Rename("a.mp4", "sent/2025/a.mp4"))
+	assert.FileExists(t, filepath.Join(root, "videos", "sent", "2025", "a.mp4"))
+	require.NoError(t, s.Remove("sent/2025/a.mp4"))
+	assert.NoFileExists(t, filepath.Join(root, "videos", "sent", "2025", "a.mp4"))
+
+	// the client connects again after the connection is lost
+	require.NoError(t, s.client.Close())
+	_, err = s.List()
+	assert.Error(t, err)
+	_, err = s.List()
+	require.NoError(t, err)
+	assert.Equal(t, 2, *dials)
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/studio-b12/gowebdav"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// WebDAVOptions configure WebDAV source
+type WebDAVOptions struct {
+	// URL of the directory with the videos, e.g. https://nas.example.com/dav/videos
+	URL      string
+	User     string
+	Password string
+	Timeout  time.Duration
+}
+
+// WebDAV lists the files of a WebDAV directory
+type WebDAV struct {
+	client *gowebdav.Client
+}
+
+// NewWebDAV creates the source of a WebDAV server, it doesn't connect until the first request
+func NewWebDAV(opts WebDAVOptions) *WebDAV {
+	client := gowebdav.NewClient(opts.URL, opts.User, opts.Password)
+	if opts.Timeout > 0 {
+		client.SetTimeout(opts.Timeout)
+	}
+	return &WebDAV{client: client}
+}
+
+func (d *WebDAV) List() ([]finder.Object, error) {
+	infos, err := d.client.ReadDir("/")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read directory")
+	}
+	objects := make([]finder.Object, 0, len(infos))
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		objects = append(objects, finder.Object{Path: info.Name(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return objects, nil
+}
+
+func (d *WebDAV) Open(p string) (io.ReadCloser, error) {
+	return d.client.ReadStream(p)
+}
+
+func (d *WebDAV) Remove(p string) error {
+	return d.client.Remove(p)
+}
+
+func (d *WebDAV) Rename(p, newPath string) error {
+	if dir := path.Dir(newPath); dir != "." && dir != "/" {
+		if err := d.client.MkdirAll(dir, os.ModePerm); err != nil {
+			return errors.Wrapf(err, "failed to create %s", dir)
+		}
+	}
+	return d.client.Rename(p, newPath, false)
+}
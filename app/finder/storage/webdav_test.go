@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+func TestWebDAV(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "videos", "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "videos", "a.mp4"), []byte("video a"), 0o600))
+	modTime := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "videos", "a.mp4"), modTime, modTime))
+
+	ts := httptest.NewServer(&webdav.Handler{FileSystem: webdav.Dir(root), LockSystem: webdav.NewMemLS()})
+	t.Cleanup(ts.Close)
+	d := NewWebDAV(WebDAVOptions{URL: ts.URL + "/videos", Timeout: time.Second})
+
+	objects, err := d.List()
+	require.NoError(t, err)
+	require.Len(t, objects, 1)
+	assert.Equal(t, "a.mp4", objects[0].Path)
+	assert.Equal(t, int64(7), objects[0].Size)
+	assert.True(t, objects[0].ModTime.Equal(modTime))
+
+	rc, err := d.Open("a.mp4")
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	assert.Equal(t, "video a", string(data))
+
+	require.NoError(t, d.Rename("a.mp4", "sent/2025/a.mp4"))
+	assert.FileExists(t, filepath.Join(root, "videos", "sent", "2025", "a.mp4"))
+	require.NoError(t, d.Remove("sent/2025/a.mp4"))
+	assert.NoFileExists(t, filepath.Join(root, "videos", "sent", "2025", "a.mp4"))
+}
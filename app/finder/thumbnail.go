@@ -0,0 +1,48 @@
+package finder
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Thumbnailer interface {
+	// Thumbnail returns a JPEG preview of the video
+	Thumbnail(path string, width int) ([]byte, error)
+}
+
+// FFmpegThumbnailer grabs a frame of the video with ffmpeg
+type FFmpegThumbnailer struct {
+	// Offset of the frame in seconds
+	Offset int
+}
+
+func NewFFmpegThumbnailer() *FFmpegThumbnailer {
+	return &FFmpegThumbnailer{Offset: 1}
+}
+
+func (o *FFmpegThumbnailer) Thumbnail(path string, width int) ([]byte, error) {
+	out, err := o.grab(path, width, o.Offset)
+	if err == nil && len(out) == 0 && o.Offset > 0 {
+		// the video is shorter than the offset
+		out, err = o.grab(path, width, 0)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no frame found in %s", path)
+	}
+	return out, nil
+}
+
+func (o *FFmpegThumbnailer) grab(path string, width, offset int) ([]byte, error) {
+	return RunFFmpeg(
+		"-v", "error",
+		"-ss", strconv.Itoa(offset),
+		"-i", path,
+		"-frames:v", "1",
+		"-vf", fmt.Sprintf("scale=%d:-2", width),
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"-")
+}
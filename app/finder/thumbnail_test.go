@@ -0,0 +1,43 @@
+package finder
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// createFakeFFmpeg installs a temporary "ffmpeg" script at the front of PATH
+func createFakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "ffmpeg"), []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestFFmpegThumbnailer_Thumbnail(t *testing.T) {
+	createFakeFFmpeg(t, `printf 'jpeg'`)
+
+	img, err := NewFFmpegThumbnailer().Thumbnail("dummy.mp4", 160)
+	require.NoError(t, err)
+	require.Equal(t, []byte("jpeg"), img)
+}
+
+func TestFFmpegThumbnailer_ShortVideo(t *testing.T) {
+	// outputs a frame only when seeking to the start
+	createFakeFFmpeg(t, `[ "$4" = "0" ] && printf 'first'; exit 0`)
+
+	img, err := NewFFmpegThumbnailer().Thumbnail("dummy.mp4", 160)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), img)
+}
+
+func TestFFmpegThumbnailer_Error(t *testing.T) {
+	createFakeFFmpeg(t, `echo "dummy.mp4: Invalid data" >&2; exit 1`)
+
+	img, err := NewFFmpegThumbnailer().Thumbnail("dummy.mp4", 160)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Invalid data")
+	require.Nil(t, img)
+}
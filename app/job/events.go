@@ -0,0 +1,86 @@
+package job
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType describes the possible types of a job event
+type EventType string
+
+const (
+	EventEnqueued EventType = "enqueued"
+	// EventScheduled is published when a job waits for its time out of the queue
+	EventScheduled EventType = "scheduled"
+	EventStarted   EventType = "started"
+	EventProgress  EventType = "progress"
+	EventDone      EventType = "done"
+	EventFailed    EventType = "failed"
+	EventCanceled  EventType = "canceled"
+	// EventRemoved is published when a finished job is removed from the list
+	EventRemoved EventType = "removed"
+	// EventCleared is published when the whole queue is reset
+	EventCleared EventType = "cleared"
+)
+
+// Event describes a change of a job state
+type Event struct {
+	Type   EventType `json:"type"`
+	JobID  string    `json:"job_id,omitempty"`
+	Status JobStatus `json:"status,omitempty"`
+	// Progress of the job in percent, set for EventProgress
+	Progress int       `json:"progress,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// subscriberBuffer is the number of events kept for a slow subscriber
+const subscriberBuffer = 64
+
+// Broadcaster delivers job events to all subscribers
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// Subscribe returns a channel of events and a function to cancel the subscription
+func (b *Broadcaster) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
+
+// Publish sends event to all subscribers.
+// Events are dropped for subscribers whose buffer is full, so a stuck client never blocks workers.
+func (b *Broadcaster) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// drop event
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// progressJob reports a few progress steps before finishing
+type progressJob struct {
+	BaseJob
+	steps []int
+}
+
+func (j progressJob) Execute() error {
+	return nil
+}
+
+func (j progressJob) ExecuteWithProgress(progress func(percent int)) error {
+	for _, step := range j.steps {
+		progress(step)
+	}
+	return nil
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("event was not received")
+	}
+	return Event{}
+}
+
+func TestBroadcaster_PublishToAllSubscribers(t *testing.T) {
+	b := NewBroadcaster()
+	ch1, cancel1 := b.Subscribe()
+	defer cancel1()
+	ch2, cancel2 := b.Subscribe()
+	defer cancel2()
+
+	b.Publish(Event{Type: EventDone, JobID: "job-1"})
+
+	for _, ch := range []<-chan Event{ch1, ch2} {
+		e := nextEvent(t, ch)
+		assert.Equal(t, EventDone, e.Type)
+		assert.Equal(t, "job-1", e.JobID)
+		assert.False(t, e.Time.IsZero())
+	}
+}
+
+func TestBroadcaster_Cancel(t *testing.T) {
+	b := NewBroadcaster()
+	ch, cancel := b.Subscribe()
+	cancel()
+	cancel() // second call must not panic
+
+	b.Publish(Event{Type: EventDone})
+	_, ok := <-ch
+	assert.False(t, ok, "channel must be closed after cancel")
+}
+
+func TestBroadcaster_SlowSubscriberDoesNotBlock(t *testing.T) {
+	b := NewBroadcaster()
+	_, cancel := b.Subscribe()
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < subscriberBuffer*2; i++ {
+			b.Publish(Event{Type: EventProgress})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish is blocked by a slow subscriber")
+	}
+}
+
+func TestWorker_PublishesEvents(t *testing.T) {
+	jq := NewJobQueue()
+	events, cancel := jq.Subscribe()
+	defer cancel()
+
+	okJob := &MockJob{}
+	okJob.ID = "ok"
+	okJob.On("Execute").Return(nil)
+	failJob := &MockJob{}
+	failJob.ID = "fail"
+	failJob.On("Execute").Return(errors.New("boom"))
+
+	jq.AddJob(okJob)
+	jq.AddJob(failJob)
+	close(jq.queue)
+	Worker(1, jq)
+
+	expected := []Event{
+		{Type: EventEnqueued, JobID: "ok", Status: StatusQueued},
+		{Type: EventEnqueued, JobID: "fail", Status: StatusQueued},
+		{Type: EventStarted, JobID: "ok", Status: StatusProcessing},
+		{Type: EventDone, JobID: "ok", Status: StatusDone},
+		{Type: EventStarted, JobID: "fail", Status: StatusProcessing},
+		{Type: EventFailed, JobID: "fail", Status: StatusFailed, Error: "boom"},
+	}
+	for _, want := range expected {
+		got := nextEvent(t, events)
+		got.Time = time.Time{}
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestWorker_PublishesProgress(t *testing.T) {
+	jq := NewJobQueue()
+	events, cancel := jq.Subscribe()
+	defer cancel()
+
+	jq.AddJob(progressJob{BaseJob: BaseJob{ID: "p"}, steps: []int{50, 100}})
+	close(jq.queue)
+	Worker(1, jq)
+
+	var progress []int
+	for range 5 {
+		e := nextEvent(t, events)
+		if e.Type == EventProgress {
+			progress = append(progress, e.Progress)
+		}
+	}
+	require.Equal(t, []int{50, 100}, progress)
+	assert.Equal(t, StatusDone, jq.GetJobsStatuses()["p"])
+}
+
+func TestJobQueue_ClearPublishesEvent(t *testing.T) {
+	jq := NewJobQueue()
+	events, cancel := jq.Subscribe()
+	defer cancel()
+
+	jq.Clear()
+	assert.Equal(t, EventCleared, nextEvent(t, events).Type)
+}
@@ -1,18 +1,29 @@
 package job
 
 import (
+	"errors"
 	"log"
 	"sync"
+	"time"
 )
 
 // JobStatus describes the possible statuses of a job
 type JobStatus string
 
 const (
-	StatusQueued     JobStatus = "queued"
+	StatusQueued JobStatus = "queued"
+	// StatusScheduled is of a job waiting for its time out of the queue
+	StatusScheduled  JobStatus = "scheduled"
 	StatusProcessing JobStatus = "processing"
 	StatusDone       JobStatus = "done"
 	StatusFailed     JobStatus = "failed"
+	StatusCanceled   JobStatus = "canceled"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobConflict is returned when the action is not allowed in the current job status
+	ErrJobConflict = errors.New("job status does not allow this action")
 )
 
 // Job interface for jobs
@@ -27,6 +38,22 @@ type Job interface {
 	GetStatus() JobStatus
 }
 
+// ProgressJob is implemented by jobs which are able to report their progress
+type ProgressJob interface {
+	Job
+
+	// ExecuteWithProgress runs job and calls progress with the percent of done work
+	ExecuteWithProgress(progress func(percent int)) error
+}
+
+// ScheduledJob is implemented by jobs which are queued at a time
+type ScheduledJob interface {
+	Job
+
+	// ScheduledAt returns the time to queue the job at, the job is queued at once if the time is passed
+	ScheduledAt() time.Time
+}
+
 // BaseJob includes common fields
 type BaseJob struct {
 	ID     string
@@ -47,28 +74,219 @@ func (j BaseJob) GetStatus() JobStatus {
 type JobQueuer interface {
 	AddJob(job Job)
 	GetJobsStatuses() map[string]JobStatus
+	GetJobs() []JobInfo
+	GetJob(jobID string) (JobInfo, error)
+	Cancel(jobID string) error
+	Retry(jobID string) error
 	Clear()
+	Subscribe() (<-chan Event, func())
+}
+
+// JobInfo describes a job in the queue and its state
+type JobInfo struct {
+	Job    Job
+	Status JobStatus
+	// Error of the last failed execution
+	Error string
 }
 
 // JobQueue stores a queue of jobs and their statuses
 type JobQueue struct {
-	mu    sync.Mutex
-	jobs  map[string]JobStatus
-	queue chan Job
+	mu     sync.Mutex
+	jobs   map[string]JobStatus
+	queue  chan entry
+	events *Broadcaster
+
+	// records keeps the added jobs in the order of adding
+	records map[string]*record
+	order   []string
+	// generation numbers the enqueues, so the stale entries of the channel are dropped
+	generation uint64
+}
+
+type record struct {
+	job Job
+	err string
+	// generation of the latest enqueue of the job
+	generation uint64
+	// timer queues the scheduled job
+	timer *time.Timer
+}
+
+// entry is a job in the channel with the generation of its enqueue
+type entry struct {
+	job        Job
+	generation uint64
 }
 
 func NewJobQueue() *JobQueue {
 	return &JobQueue{
-		jobs:  make(map[string]JobStatus),
-		queue: make(chan Job, 100), // buffer size is 100
+		jobs:    make(map[string]JobStatus),
+		queue:   make(chan entry, 100), // buffer size is 100
+		events:  NewBroadcaster(),
+		records: make(map[string]*record),
 	}
 }
 
 func (jq *JobQueue) AddJob(job Job) {
 	jq.mu.Lock()
-	jq.jobs[job.GetID()] = StatusQueued
+	if _, ok := jq.records[job.GetID()]; !ok {
+		jq.order = append(jq.order, job.GetID())
+	}
+	jq.records[job.GetID()] = &record{job: job}
+	jq.submit(job.GetID())
+}
+
+// submit schedules the job if its time isn't passed or queues it, it must be called with jq.mu held and unlocks it
+func (jq *JobQueue) submit(jobID string) {
+	rec := jq.records[jobID]
+	sj, ok := rec.job.(ScheduledJob)
+	if !ok || !time.Now().Before(sj.ScheduledAt()) {
+		e := jq.enqueue(jobID)
+		jq.mu.Unlock()
+		jq.push(e)
+		return
+	}
+	jq.generation++
+	generation := jq.generation
+	rec.generation = generation
+	jq.jobs[jobID] = StatusScheduled
+	rec.timer = time.AfterFunc(time.Until(sj.ScheduledAt()), func() { jq.release(jobID, generation) })
 	jq.mu.Unlock()
-	jq.queue <- job
+	log.Printf("[INFO] job %s is scheduled at %s", jobID, sj.ScheduledAt().Format(time.DateTime))
+	jq.events.Publish(Event{Type: EventScheduled, JobID: jobID, Status: StatusScheduled})
+}
+
+// release queues the scheduled job unless it was canceled, cleared or scheduled again
+func (jq *JobQueue) release(jobID string, generation uint64) {
+	jq.mu.Lock()
+	rec, ok := jq.records[jobID]
+	if !ok || rec.generation != generation || jq.jobs[jobID] != StatusScheduled {
+		jq.mu.Unlock()
+		return
+	}
+	rec.timer = nil
+	e := jq.enqueue(jobID)
+	jq.mu.Unlock()
+	jq.push(e)
+}
+
+// enqueue marks the job as queued with a new generation, it must be called with jq.mu held
+func (jq *JobQueue) enqueue(jobID string) entry {
+	jq.generation++
+	rec := jq.records[jobID]
+	rec.generation = jq.generation
+	jq.jobs[jobID] = StatusQueued
+	return entry{job: rec.job, generation: rec.generation}
+}
+
+// push publishes the enqueue and sends the entry to the workers, it must be called without jq.mu
+func (jq *JobQueue) push(e entry) {
+	jq.events.Publish(Event{Type: EventEnqueued, JobID: e.job.GetID(), Status: StatusQueued})
+	jq.queue <- e
+}
+
+// GetJobs returns all known jobs in the order of adding
+func (jq *JobQueue) GetJobs() []JobInfo {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	list := make([]JobInfo, 0, len(jq.order))
+	for _, id := range jq.order {
+		list = append(list, jq.info(id))
+	}
+	return list
+}
+
+// GetJob returns the job by ID
+func (jq *JobQueue) GetJob(jobID string) (JobInfo, error) {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	if _, ok := jq.records[jobID]; !ok {
+		return JobInfo{}, ErrJobNotFound
+	}
+	return jq.info(jobID), nil
+}
+
+// info must be called with jq.mu held
+func (jq *JobQueue) info(jobID string) JobInfo {
+	rec := jq.records[jobID]
+	return JobInfo{Job: rec.job, Status: jq.jobs[jobID], Error: rec.err}
+}
+
+// Cancel cancels a queued or scheduled job, or removes a finished one from the list.
+// A job which is being processed can't be canceled.
+func (jq *JobQueue) Cancel(jobID string) error {
+	jq.mu.Lock()
+	if _, ok := jq.records[jobID]; !ok {
+		jq.mu.Unlock()
+		return ErrJobNotFound
+	}
+	status := jq.jobs[jobID]
+	switch status {
+	case StatusQueued, StatusScheduled:
+		// the worker skips canceled jobs when they come out of the channel
+		jq.stop(jobID)
+		jq.jobs[jobID] = StatusCanceled
+		jq.mu.Unlock()
+		jq.events.Publish(Event{Type: EventCanceled, JobID: jobID, Status: StatusCanceled})
+		return nil
+	case StatusProcessing:
+		jq.mu.Unlock()
+		return ErrJobConflict
+	default:
+		jq.remove(jobID)
+		jq.mu.Unlock()
+		jq.events.Publish(Event{Type: EventRemoved, JobID: jobID, Status: status})
+		return nil
+	}
+}
+
+// stop stops the timer of the scheduled job, it must be called with jq.mu held
+func (jq *JobQueue) stop(jobID string) {
+	if rec := jq.records[jobID]; rec.timer != nil {
+		rec.timer.Stop()
+		rec.timer = nil
+	}
+}
+
+// remove must be called with jq.mu held
+func (jq *JobQueue) remove(jobID string) {
+	delete(jq.jobs, jobID)
+	delete(jq.records, jobID)
+	for i, id := range jq.order {
+		if id == jobID {
+			jq.order = append(jq.order[:i], jq.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// Retry adds a failed or canceled job to the queue again
+func (jq *JobQueue) Retry(jobID string) error {
+	jq.mu.Lock()
+	rec, ok := jq.records[jobID]
+	if !ok {
+		jq.mu.Unlock()
+		return ErrJobNotFound
+	}
+	if status := jq.jobs[jobID]; status != StatusFailed && status != StatusCanceled {
+		jq.mu.Unlock()
+		return ErrJobConflict
+	}
+	rec.err = ""
+	// a canceled entry still in the channel has an older generation, so it is dropped
+	jq.submit(jobID)
+	return nil
+}
+
+// Subscribe returns a channel of job events and a function to cancel the subscription
+func (jq *JobQueue) Subscribe() (<-chan Event, func()) {
+	return jq.events.Subscribe()
+}
+
+// ReportProgress publishes the progress of a job
+func (jq *JobQueue) ReportProgress(jobID string, percent int) {
+	jq.events.Publish(Event{Type: EventProgress, JobID: jobID, Status: StatusProcessing, Progress: percent})
 }
 
 // UpdateStatus updates job status
@@ -93,8 +311,14 @@ func (jq *JobQueue) GetJobsStatuses() map[string]JobStatus {
 func (jq *JobQueue) Clear() {
 	// Lock to clear the map and drain the queue
 	jq.mu.Lock()
+	for id := range jq.records {
+		jq.stop(id)
+	}
 	jq.jobs = make(map[string]JobStatus)
+	jq.records = make(map[string]*record)
+	jq.order = nil
 	jq.mu.Unlock()
+	jq.events.Publish(Event{Type: EventCleared})
 
 	// Drain the channel
 	for {
@@ -109,19 +333,59 @@ func (jq *JobQueue) Clear() {
 
 // Worker processes tasks from the queue
 func Worker(id int, jq *JobQueue) {
-	for job := range jq.queue {
-		jobID := job.GetID()
+	for e := range jq.queue {
+		job, jobID := e.job, e.job.GetID()
+		if !jq.start(e) {
+			log.Printf("Worker %d: job %s is canceled", id, jobID)
+			continue
+		}
 
 		log.Printf("Worker %d: job %s is processing", id, jobID)
-		jq.UpdateStatus(jobID, StatusProcessing)
+		jq.events.Publish(Event{Type: EventStarted, JobID: jobID, Status: StatusProcessing})
 
-		err := job.Execute()
+		err := execute(jq, job)
 		if err != nil {
 			log.Printf("Worker %d: failed job %s: %v", id, jobID, err)
-			jq.UpdateStatus(jobID, StatusFailed)
+			jq.fail(jobID, err)
+			jq.events.Publish(Event{Type: EventFailed, JobID: jobID, Status: StatusFailed, Error: err.Error()})
 		} else {
 			jq.UpdateStatus(jobID, StatusDone)
+			jq.events.Publish(Event{Type: EventDone, JobID: jobID, Status: StatusDone})
 			log.Printf("Worker %d: successful job %s", id, jobID)
 		}
 	}
 }
+
+// start marks the job of the entry as processing unless it was canceled, cleared or enqueued again
+func (jq *JobQueue) start(e entry) bool {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	jobID := e.job.GetID()
+	rec, ok := jq.records[jobID]
+	if !ok || rec.generation != e.generation || jq.jobs[jobID] != StatusQueued {
+		return false
+	}
+	jq.jobs[jobID] = StatusProcessing
+	rec.err = ""
+	return true
+}
+
+// fail marks the job as failed and keeps the error
+func (jq *JobQueue) fail(jobID string, err error) {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	jq.jobs[jobID] = StatusFailed
+	if rec, ok := jq.records[jobID]; ok {
+		rec.err = err.Error()
+	}
+}
+
+// execute runs job, wiring its progress to the queue events if supported
+func execute(jq *JobQueue, job Job) error {
+	if pj, ok := job.(ProgressJob); ok {
+		return pj.ExecuteWithProgress(func(percent int) {
+			jq.ReportProgress(job.GetID(), percent)
+		})
+	}
+	return job.Execute()
+}
@@ -3,12 +3,20 @@ package job
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/process"
+	"github.com/meesooqa/files2tg/app/send"
 )
 
 // MockJob implements the Job interface using testify/mock
@@ -149,7 +157,7 @@ func TestClearDrainsPendingJobs(t *testing.T) {
 		// поскольку канал дренирован, блокировки быть не должно
 		job := &MockJob{}
 		job.ID = "X"
-		jq.queue <- job
+		jq.queue <- entry{job: job}
 		done <- struct{}{}
 	}()
 
@@ -198,3 +206,267 @@ func TestClearDuringProcessing(t *testing.T) {
 		t.Errorf("после Clear + обработка задачи остались в map: %v", jq.GetJobsStatuses())
 	}
 }
+
+func TestJobQueue_GetJobs(t *testing.T) {
+	jq := NewJobQueue()
+	for _, id := range []string{"b", "a", "c"} {
+		j := &MockJob{}
+		j.ID = id
+		jq.AddJob(j)
+	}
+
+	jobs := jq.GetJobs()
+	assert.Len(t, jobs, 3)
+	for i, id := range []string{"b", "a", "c"} {
+		assert.Equal(t, id, jobs[i].Job.GetID())
+		assert.Equal(t, StatusQueued, jobs[i].Status)
+	}
+
+	_, err := jq.GetJob("unknown")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestJobQueue_CancelQueuedJobIsSkipped(t *testing.T) {
+	jq := NewJobQueue()
+	j := &MockJob{}
+	j.ID = "canceled"
+	jq.AddJob(j)
+
+	assert.NoError(t, jq.Cancel("canceled"))
+	close(jq.queue)
+	Worker(1, jq)
+
+	info, err := jq.GetJob("canceled")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusCanceled, info.Status)
+	j.AssertNotCalled(t, "Execute")
+}
+
+func TestJobQueue_RetryCanceledJobRunsOnce(t *testing.T) {
+	jq := NewJobQueue()
+	j := &MockJob{}
+	j.ID = "again"
+	j.On("Execute").Return(nil)
+	jq.AddJob(j)
+
+	assert.NoError(t, jq.Cancel("again"))
+	assert.NoError(t, jq.Retry("again"))
+	// the job is queued again, so the second retry conflicts
+	assert.ErrorIs(t, jq.Retry("again"), ErrJobConflict)
+	close(jq.queue)
+	Worker(1, jq)
+
+	info, err := jq.GetJob("again")
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDone, info.Status)
+	j.AssertNumberOfCalls(t, "Execute", 1)
+}
+
+func TestJobQueue_CancelFinishedJobRemovesIt(t *testing.T) {
+	jq := NewJobQueue()
+	j := &MockJob{}
+	j.ID = "done"
+	jq.AddJob(j)
+	jq.UpdateStatus("done", StatusDone)
+
+	assert.NoError(t, jq.Cancel("done"))
+	_, err := jq.GetJob("done")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+	assert.Empty(t, jq.GetJobs())
+	assert.Empty(t, jq.GetJobsStatuses())
+}
+
+func TestJobQueue_CancelProcessingJob(t *testing.T) {
+	jq := NewJobQueue()
+	j := &MockJob{}
+	j.ID = "busy"
+	jq.AddJob(j)
+	jq.UpdateStatus("busy", StatusProcessing)
+
+	assert.ErrorIs(t, jq.Cancel("busy"), ErrJobConflict)
+	assert.ErrorIs(t, jq.Cancel("unknown"), ErrJobNotFound)
+}
+
+func TestJobQueue_Retry(t *testing.T) {
+	jq := NewJobQueue()
+	j := &MockJob{}
+	j.ID = "retry"
+	j.On("Execute").Return(errors.New("boom")).Once()
+	j.On("Execute").Return(nil).Once()
+
+	status := func() JobStatus {
+		info, err := jq.GetJob("retry")
+		assert.NoError(t, err)
+		return info.Status
+	}
+
+	jq.AddJob(j)
+	// a queued job can't be retried
+	assert.ErrorIs(t, jq.Retry("retry"), ErrJobConflict)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		Worker(1, jq)
+	}()
+
+	assert.Eventually(t, func() bool { return status() == StatusFailed }, time.Second, 5*time.Millisecond)
+	info, _ := jq.GetJob("retry")
+	assert.Equal(t, "boom", info.Error)
+
+	assert.NoError(t, jq.Retry("retry"))
+	assert.Len(t, jq.GetJobs(), 1)
+	assert.Eventually(t, func() bool { return status() == StatusDone }, time.Second, 5*time.Millisecond)
+	info, _ = jq.GetJob("retry")
+	assert.Empty(t, info.Error)
+
+	close(jq.queue)
+	wg.Wait()
+	j.AssertExpectations(t)
+}
+
+// sendFunc implements send.Client with a function
+type sendFunc func(post send.Post) error
+
+func (f sendFunc) Send(post send.Post) error { return f(post) }
+
+func TestSendVideoJob_PublishAt(t *testing.T) {
+	var sentAt time.Time
+	client := sendFunc(func(send.Post) error {
+		sentAt = time.Now()
+		return nil
+	})
+	publishAt := time.Now().Add(50 * time.Millisecond)
+	jq := NewJobQueue()
+	go Worker(1, jq)
+	t.Cleanup(func() { close(jq.queue) })
+
+	jq.AddJob(SendVideoJob{BaseJob: BaseJob{ID: "a"}, File: finder.File{Name: "a.mp4"}, PublishAt: publishAt, TelegramClient: client})
+	info, err := jq.GetJob("a")
+	require.NoError(t, err)
+	assert.Equal(t, StatusScheduled, info.Status, "the job waits out of the queue")
+
+	assert.Eventually(t, func() bool { return jq.GetJobsStatuses()["a"] == StatusDone }, time.Second, 5*time.Millisecond)
+	assert.False(t, sentAt.Before(publishAt), "the job is queued at the publish time")
+}
+
+func TestJobQueue_CancelScheduledJob(t *testing.T) {
+	var sent atomic.Int32
+	client := sendFunc(func(send.Post) error {
+		sent.Add(1)
+		return nil
+	})
+	jq := NewJobQueue()
+	go Worker(1, jq)
+	t.Cleanup(func() { close(jq.queue) })
+
+	jq.AddJob(SendVideoJob{BaseJob: BaseJob{ID: "a"}, PublishAt: time.Now().Add(30 * time.Millisecond), TelegramClient: client})
+	require.NoError(t, jq.Cancel("a"))
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, StatusCanceled, jq.GetJobsStatuses()["a"])
+	assert.Zero(t, sent.Load(), "the timer of the canceled job is stopped")
+
+	// the time is passed, so the retried job is queued at once
+	require.NoError(t, jq.Retry("a"))
+	assert.Eventually(t, func() bool { return jq.GetJobsStatuses()["a"] == StatusDone }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, int32(1), sent.Load())
+}
+
+func TestSendVideoJob_OnSent(t *testing.T) {
+	var done []string
+	j := SendVideoJob{
+		BaseJob:        BaseJob{ID: "a"},
+		File:           finder.File{Name: "a.mp4"},
+		TelegramClient: sendFunc(func(send.Post) error { return nil }),
+		OnSent: func(file finder.File) error {
+			done = append(done, file.Name)
+			return errors.New("can't move")
+		},
+	}
+	assert.NoError(t, j.Execute(), "the failure after sending doesn't fail the job")
+	assert.Equal(t, []string{"a.mp4"}, done)
+
+	j.TelegramClient = sendFunc(func(send.Post) error { return errors.New("flood") })
+	assert.Error(t, j.Execute())
+	assert.Len(t, done, 1, "not called if the file isn't sent")
+
+	var post send.Post
+	j.Album = []finder.File{{Name: "b.mp4"}}
+	j.TelegramClient = sendFunc(func(p send.Post) error { post = p; return nil })
+	assert.NoError(t, j.Execute())
+	assert.Equal(t, j.Album, post.Album)
+	assert.Equal(t, []string{"a.mp4", "a.mp4", "b.mp4"}, done, "called for every file of the album")
+}
+
+func TestSendVideoJob_Fetch(t *testing.T) {
+	var post send.Post
+	var done []finder.File
+	j := SendVideoJob{
+		BaseJob: BaseJob{ID: "a"},
+		File:    finder.File{Name: "a.mp4", Path: "pending/a.mp4"},
+		Album:   []finder.File{{Name: "b.mp4", Path: "pending/b.mp4"}},
+		Fetch: func(file finder.File) (finder.File, error) {
+			file.Path = "fetched/" + file.Name
+			return file, nil
+		},
+		TelegramClient: sendFunc(func(p send.Post) error { post = p; return nil }),
+		OnSent:         func(file finder.File) error { done = append(done, file); return nil },
+	}
+	require.NoError(t, j.Execute())
+	assert.Equal(t, "fetched/a.mp4", post.File.Path)
+	assert.Equal(t, "fetched/b.mp4", post.Album[0].Path)
+	require.Len(t, done, 2)
+	assert.Equal(t, "fetched/a.mp4", done[0].Path)
+	assert.Equal(t, "pending/b.mp4", j.Album[0].Path, "the album of the job is kept")
+
+	j.Fetch = func(file finder.File) (finder.File, error) { return file, errors.New("no connection") }
+	assert.EqualError(t, j.Execute(), "failed to fetch: no connection")
+	assert.Len(t, done, 2)
+}
+
+// copyStep is a process.Processor copying the file
+type copyStep struct{}
+
+func (copyStep) Name() string { return "copy" }
+
+func (copyStep) Key(file finder.File, destination string) (string, bool) { return destination, true }
+
+func (copyStep) Process(file finder.File, destination, out string) error {
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, data, 0o600)
+}
+
+func TestSendVideoJob_Pipeline(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mp4"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600))
+	}
+	workDir := t.TempDir()
+	var post send.Post
+	var sent []string
+	j := SendVideoJob{
+		BaseJob:        BaseJob{ID: "a"},
+		File:           finder.File{Path: filepath.Join(dir, "a.mp4"), Name: "a.mp4"},
+		Album:          []finder.File{{Path: filepath.Join(dir, "b.mp4"), Name: "b.mp4"}},
+		Destination:    "main",
+		Pipeline:       process.NewPipeline(workDir, nil, copyStep{}),
+		TelegramClient: sendFunc(func(p send.Post) error { post = p; return nil }),
+		OnSent:         func(file finder.File) error { sent = append(sent, file.Path); return nil },
+	}
+
+	var progress []int
+	require.NoError(t, j.ExecuteWithProgress(func(percent int) { progress = append(progress, percent) }))
+	assert.Equal(t, []int{33, 66, 100}, progress)
+	assert.Equal(t, filepath.Join(workDir, "copy"), filepath.Dir(post.File.Path))
+	require.Len(t, post.Album, 1)
+	assert.Equal(t, filepath.Join(workDir, "copy"), filepath.Dir(post.Album[0].Path))
+	assert.Equal(t, []string{"copy"}, post.Album[0].Processed)
+	assert.Equal(t, []string{j.File.Path, j.Album[0].Path}, sent, "OnSent gets the originals")
+
+	j.File.Path = filepath.Join(dir, "missing.mp4")
+	assert.ErrorContains(t, j.Execute(), "failed to process")
+}
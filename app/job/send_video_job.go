@@ -2,24 +2,90 @@ package job
 
 import (
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/process"
 	"github.com/meesooqa/files2tg/app/send"
 )
 
 // SendVideoJob send finder.File to Telegram
 type SendVideoJob struct {
 	BaseJob
-	File           finder.File
-	Stars          int
+	File  finder.File
+	Stars int
+	// Caption overrides the formatted caption if not empty
+	Caption string
+	// Destination overrides the configured channel if not empty
+	Destination string
+	// PublishAt delays the sending, the job is queued at the time
+	PublishAt time.Time
+	// Album are the files sent with File as an album
+	Album []finder.File
+	// Fetch returns the local copy of a file, e.g. downloads the file of a remote source when the job runs,
+	// the files are processed as they are if nil
+	Fetch func(file finder.File) (finder.File, error)
+	// Pipeline processes the files before they are sent, they are sent as they are if nil
+	Pipeline *process.Pipeline
+	// OnSent is called after the file is sent, e.g. to move it in a remote source.
+	// Its error doesn't fail the job, so the file isn't sent twice by a retry.
+	OnSent         func(file finder.File) error
 	TelegramClient send.Client
 }
 
+// ScheduledAt implements ScheduledJob
+func (o SendVideoJob) ScheduledAt() time.Time {
+	return o.PublishAt
+}
+
 // Execute implements SendVideoJob
 func (o SendVideoJob) Execute() error {
-	fmt.Printf("Start processing file: %s\n", o.File.Name)
-	if err := o.TelegramClient.Send(o.File, o.Stars); err != nil {
+	return o.ExecuteWithProgress(func(int) {})
+}
+
+// ExecuteWithProgress implements ProgressJob, every step of the pipeline for every file is a part of the work
+// and the sending is the last one
+func (o SendVideoJob) ExecuteWithProgress(progress func(percent int)) error {
+	log.Printf("[INFO] start processing file: %s", o.File.Name)
+	post := send.Post{
+		Stars:       o.Stars,
+		Caption:     o.Caption,
+		Destination: o.Destination,
+	}
+	files := append([]finder.File{o.File}, o.Album...)
+	parts := len(files)*o.Pipeline.Len() + 1
+	for i, file := range files {
+		if o.Fetch != nil {
+			fetched, err := o.Fetch(file)
+			if err != nil {
+				return fmt.Errorf("failed to fetch: %v", err)
+			}
+			// OnSent gets the fetched file, e.g. to remove the downloaded copy
+			files[i], file = fetched, fetched
+		}
+		processed, err := o.Pipeline.Process(file, o.Destination, func(step int) {
+			progress((i*o.Pipeline.Len() + step) * 100 / parts)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to process: %v", err)
+		}
+		if i == 0 {
+			post.File = processed
+		} else {
+			post.Album = append(post.Album, processed)
+		}
+	}
+	if err := o.TelegramClient.Send(post); err != nil {
 		return fmt.Errorf("failed to send to Telegram: %v", err)
 	}
+	progress(100)
+	if o.OnSent != nil {
+		for _, file := range files {
+			if err := o.OnSent(file); err != nil {
+				log.Printf("[WARN] %s is sent, but %v", file.Name, err)
+			}
+		}
+	}
 	return nil
 }
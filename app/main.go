@@ -1,35 +1,15 @@
 package main
 
 import (
-	"context"
-	"fmt"
+	"os"
 
 	"github.com/joho/godotenv"
 
-	"github.com/meesooqa/files2tg/app/job"
-	"github.com/meesooqa/files2tg/app/send"
-	"github.com/meesooqa/files2tg/app/web"
+	"github.com/meesooqa/files2tg/app/cmd"
 )
 
 func main() {
 	godotenv.Load()
 
-	tgFactory := &send.EnvClientFactory{}
-	tgClient, err := tgFactory.NewClient()
-	if err != nil {
-		fmt.Printf("new tgClient: %v\n", err)
-		return
-	}
-
-	jq := job.NewJobQueue()
-	// Start workers
-	numWorkers := 1
-	for i := 1; i <= numWorkers; i++ {
-		go job.Worker(i, jq)
-	}
-	server := web.Server{
-		JobQueue:       jq,
-		TelegramClient: tgClient,
-	}
-	server.Run(context.Background(), 8080)
+	os.Exit(cmd.Run(os.Args[1:], os.Stdout, os.Stderr))
 }
@@ -0,0 +1,175 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// Processor is a step of Pipeline transforming a video before it is sent
+type Processor interface {
+	// Name of the step, its outputs are kept in the directory of the name
+	Name() string
+	// Key returns the settings of the step for the file sent to the destination, the output is made again
+	// if they change. The file is kept as it is if ok is false.
+	Key(file finder.File, destination string) (key string, ok bool)
+	// Process writes the processed file to out
+	Process(file finder.File, destination, out string) error
+}
+
+// pruneInterval is the least time between the removals of the stale outputs
+const pruneInterval = time.Hour
+
+// Pipeline runs the processors in order, the output of a step is the input of the next one.
+// The outputs are kept in WorkDir by the hash of the input and the key of the step.
+type Pipeline struct {
+	Steps   []Processor
+	WorkDir string
+	// Prober reads the video info of the processed file, the info of the original is kept if nil
+	Prober finder.VIProvider
+	// MaxAge removes the outputs unused for longer, 0 keeps them
+	MaxAge time.Duration
+
+	mu     sync.Mutex
+	pruned time.Time
+}
+
+// NewPipeline creates Pipeline
+func NewPipeline(workDir string, prober finder.VIProvider, steps ...Processor) *Pipeline {
+	return &Pipeline{Steps: steps, WorkDir: workDir, Prober: prober}
+}
+
+// Process returns the file processed for the destination, progress is called after every step.
+// Path, Size, ModTime and Info of the result are of the last output, the rest is of the file.
+// A nil pipeline returns the file.
+func (p *Pipeline) Process(file finder.File, destination string, progress func(step int)) (finder.File, error) {
+	if p == nil {
+		return file, nil
+	}
+	p.prune()
+	processed := file
+	changed := false
+	for i, step := range p.Steps {
+		if key, ok := step.Key(processed, destination); ok {
+			out, err := p.run(step, key, processed, destination)
+			if err != nil {
+				return file, errors.Wrapf(err, "%s of %s", step.Name(), file.Name)
+			}
+			info, err := os.Stat(out)
+			if err != nil {
+				return file, err
+			}
+			processed.Path, processed.Size, processed.ModTime = out, info.Size(), info.ModTime()
+			processed.Processed = append(slices.Clone(processed.Processed), step.Name())
+			changed = true
+		}
+		if progress != nil {
+			progress(i + 1)
+		}
+	}
+	if changed && p.Prober != nil {
+		info, err := p.Prober.GetVideoInfo(processed.Path)
+		if err != nil {
+			return file, errors.Wrapf(err, "video info of processed %s", file.Name)
+		}
+		processed.Info = info
+	}
+	return processed, nil
+}
+
+// run returns the output of the step, it is reused if the input and the key are the same
+func (p *Pipeline) run(step Processor, key string, file finder.File, destination string) (string, error) {
+	hash, err := finder.HashFile(file.Path, finder.HashFast)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256([]byte(hash + "\n" + key))
+	dir := filepath.Join(p.WorkDir, step.Name())
+	ext := filepath.Ext(file.Path)
+	out := filepath.Join(dir, hex.EncodeToString(h[:16])+ext)
+	if _, err = os.Stat(out); err == nil {
+		// the output is used, so it isn't pruned
+		now := time.Now()
+		_ = os.Chtimes(out, now, now)
+		log.Printf("[DEBUG] %s of %s is cached in %s", step.Name(), file.Name, out)
+		return out, nil
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create work directory: %w", err)
+	}
+	// the temporary file is unique, so the jobs making the same output don't write over each other;
+	// the extension is kept, ffmpeg picks the format by it
+	f, err := os.CreateTemp(dir, strings.TrimSuffix(filepath.Base(out), ext)+".*.part"+ext)
+	if err != nil {
+		return "", fmt.Errorf("create temporary output: %w", err)
+	}
+	tmp := f.Name()
+	f.Close()
+	log.Printf("[INFO] %s of %s", step.Name(), file.Name)
+	if err = step.Process(file, destination, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return out, os.Rename(tmp, out)
+}
+
+// Len returns the number of the steps
+func (p *Pipeline) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.Steps)
+}
+
+// prune removes the outputs unused for MaxAge, at most once per pruneInterval
+func (p *Pipeline) prune() {
+	if p.MaxAge <= 0 {
+		return
+	}
+	p.mu.Lock()
+	if time.Since(p.pruned) < pruneInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.pruned = time.Now()
+	p.mu.Unlock()
+
+	if err := Prune(p.WorkDir, p.MaxAge); err != nil {
+		log.Printf("[WARN] can't remove stale outputs: %v", err)
+	}
+}
+
+// Prune removes the files of the work directory modified longer than maxAge ago
+func Prune(workDir string, maxAge time.Duration) error {
+	deadline := time.Now().Add(-maxAge)
+	err := filepath.WalkDir(workDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(deadline) {
+			log.Printf("[DEBUG] remove stale %s", path)
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
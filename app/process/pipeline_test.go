@@ -0,0 +1,173 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// suffixStep appends its suffix to the content of the file, the files of skip are kept
+type suffixStep struct {
+	name   string
+	suffix string
+	skip   string
+	calls  int
+	err    error
+}
+
+func (s *suffixStep) Name() string {
+	return s.name
+}
+
+func (s *suffixStep) Key(file finder.File, destination string) (string, bool) {
+	return s.suffix, file.Name != s.skip
+}
+
+func (s *suffixStep) Process(file finder.File, destination, out string) error {
+	s.calls++
+	if s.err != nil {
+		return s.err
+	}
+	data, err := os.ReadFile(file.Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, append(data, s.suffix...), 0o600)
+}
+
+// sizeProber returns the size of the file as the duration
+type sizeProber struct{}
+
+func (sizeProber) GetVideoInfo(path string) (*finder.VideoInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return &finder.VideoInfo{Duration: int(info.Size())}, nil
+}
+
+func TestPipeline_Process(t *testing.T) {
+	trim := &suffixStep{name: "trim", suffix: "-trimmed"}
+	mark := &suffixStep{name: "watermark", suffix: "-marked", skip: "b.mp4"}
+	workDir := t.TempDir()
+	p := NewPipeline(workDir, sizeProber{}, trim, mark)
+	file := finder.File{Path: writeFile(t, "a.mp4", "video"), Name: "a.mp4", Info: &finder.VideoInfo{Duration: 60}}
+
+	var steps []int
+	processed, err := p.Process(file, "main", func(step int) { steps = append(steps, step) })
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, steps)
+	data, err := os.ReadFile(processed.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "video-trimmed-marked", string(data))
+	assert.Equal(t, filepath.Join(workDir, "watermark"), filepath.Dir(processed.Path))
+	assert.Equal(t, ".mp4", filepath.Ext(processed.Path))
+	assert.Equal(t, "a.mp4", processed.Name)
+	assert.Equal(t, int64(20), processed.Size)
+	assert.Equal(t, 20, processed.Info.Duration, "the info is read again")
+	assert.Equal(t, []string{"trim", "watermark"}, processed.Processed)
+	assert.Nil(t, file.Processed)
+
+	again, err := p.Process(file, "main", nil)
+	require.NoError(t, err)
+	assert.Equal(t, processed.Path, again.Path)
+	assert.Equal(t, 1, trim.calls, "the outputs are reused")
+	assert.Equal(t, 1, mark.calls)
+
+	require.NoError(t, os.WriteFile(file.Path, []byte("changed"), 0o600))
+	_, err = p.Process(file, "main", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, trim.calls, "a changed file is processed again")
+
+	kept := finder.File{Path: writeFile(t, "b.mp4", "video"), Name: "b.mp4", Info: &finder.VideoInfo{Duration: 60}}
+	processed, err = p.Process(kept, "main", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"trim"}, processed.Processed)
+}
+
+func TestPipeline_ProcessError(t *testing.T) {
+	p := NewPipeline(t.TempDir(), nil, &suffixStep{name: "watermark", err: errors.New("boom")})
+	file := finder.File{Path: writeFile(t, "a.mp4", "video"), Name: "a.mp4"}
+	processed, err := p.Process(file, "", nil)
+	assert.EqualError(t, err, "watermark of a.mp4: boom")
+	assert.Equal(t, file, processed)
+	entries, err := os.ReadDir(filepath.Join(p.WorkDir, "watermark"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "the partial output is removed")
+}
+
+// slowStep writes the file to out after a pause, so the concurrent runs overlap
+type slowStep struct {
+	mu   sync.Mutex
+	outs []string
+}
+
+func (s *slowStep) Name() string {
+	return "slow"
+}
+
+func (s *slowStep) Key(file finder.File, destination string) (string, bool) {
+	return "slow", true
+}
+
+func (s *slowStep) Process(file finder.File, destination, out string) error {
+	s.mu.Lock()
+	s.outs = append(s.outs, out)
+	s.mu.Unlock()
+	if err := os.WriteFile(out, []byte("half"), 0o600); err != nil {
+		return err
+	}
+	time.Sleep(20 * time.Millisecond)
+	return os.WriteFile(out, []byte("processed"), 0o600)
+}
+
+func TestPipeline_ProcessConcurrently(t *testing.T) {
+	step := &slowStep{}
+	p := NewPipeline(t.TempDir(), nil, step)
+	file := finder.File{Path: writeFile(t, "a.mp4", "video"), Name: "a.mp4"}
+
+	var wg sync.WaitGroup
+	results := make([]finder.File, 2)
+	errs := make([]error, 2)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = p.Process(file, "", nil)
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, step.outs, 2)
+	assert.NotEqual(t, step.outs[0], step.outs[1], "every run writes its own temporary file")
+	for i := range results {
+		require.NoError(t, errs[i])
+		data, err := os.ReadFile(results[i].Path)
+		require.NoError(t, err)
+		assert.Equal(t, "processed", string(data))
+	}
+}
+
+func TestPrune(t *testing.T) {
+	workDir := t.TempDir()
+	stale := filepath.Join(workDir, "watermark", "stale.mp4")
+	fresh := filepath.Join(workDir, "watermark", "fresh.mp4")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0o755))
+	require.NoError(t, os.WriteFile(stale, nil, 0o600))
+	require.NoError(t, os.WriteFile(fresh, nil, 0o600))
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(stale, old, old))
+
+	require.NoError(t, Prune(workDir, 24*time.Hour))
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh)
+	assert.NoError(t, Prune(filepath.Join(workDir, "missing"), time.Hour))
+}
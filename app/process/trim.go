@@ -0,0 +1,132 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// keyframeTolerance is the most distance in seconds of a cut from a key frame to copy the streams
+const keyframeTolerance = 0.05
+
+// TrimStep cuts the videos by the start, the end and the segments of their sidecars with ffmpeg.
+// The streams are copied when every cut starts and ends at a key frame, the video is re-encoded otherwise:
+// a copied cut ends at a key frame, so an end between them would be moved.
+type TrimStep struct{}
+
+func (o *TrimStep) Name() string {
+	return "trim"
+}
+
+func (o *TrimStep) Key(file finder.File, destination string) (string, bool) {
+	cuts := file.Sidecar.Cuts()
+	if len(cuts) == 0 {
+		return "", false
+	}
+	data, err := json.Marshal(cuts)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (o *TrimStep) Process(file finder.File, destination, out string) error {
+	cuts := file.Sidecar.Cuts()
+	if len(cuts) == 0 {
+		return errors.Errorf("no cuts of %s", file.Name)
+	}
+	keyframes, err := keyframes(file.Path)
+	if err != nil {
+		return err
+	}
+	copyStreams := true
+	for _, cut := range cuts {
+		copyStreams = copyStreams && atKeyframe(float64(cut.Start), keyframes) &&
+			(cut.End == 0 || atKeyframe(float64(cut.End), keyframes))
+	}
+	if len(cuts) == 1 {
+		return cut(file.Path, cuts[0], copyStreams, out)
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(out), "segments-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	var list strings.Builder
+	for i, segment := range cuts {
+		part := filepath.Join(dir, fmt.Sprintf("part%03d%s", i, filepath.Ext(out)))
+		if err = cut(file.Path, segment, copyStreams, part); err != nil {
+			return errors.Wrapf(err, "segment %d", i+1)
+		}
+		fmt.Fprintf(&list, "file '%s'\n", filepath.Base(part))
+	}
+	listFile := filepath.Join(dir, "list.txt")
+	if err = os.WriteFile(listFile, []byte(list.String()), 0o600); err != nil {
+		return err
+	}
+	// the parts have the same codecs, so they are joined without re-encoding
+	return ffmpeg("-y", "-v", "error", "-f", "concat", "-safe", "0", "-i", listFile, "-c", "copy", "-movflags", "+faststart", out)
+}
+
+// cut writes the segment of the video to out
+func cut(path string, segment finder.Segment, copyStreams bool, out string) error {
+	args := []string{"-y", "-v", "error", "-ss", formatSeconds(float64(segment.Start)), "-i", path}
+	if segment.End > 0 {
+		args = append(args, "-t", formatSeconds(float64(segment.End-segment.Start)))
+	}
+	if copyStreams {
+		// only the video and the audio, the data and the subtitle streams don't fit every container
+		args = append(args, "-map", "0:v", "-map", "0:a?", "-c", "copy", "-avoid_negative_ts", "make_zero")
+	} else {
+		args = append(args, "-c:v", "libx264", "-c:a", "aac")
+	}
+	args = append(args, "-movflags", "+faststart", out)
+	return ffmpeg(args...)
+}
+
+// keyframes returns the times of the key frames of the video in seconds
+func keyframes(path string) ([]float64, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-skip_frame", "nokey",
+		"-show_entries", "frame=pts_time", "-of", "csv=p=0", path)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe: %w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	var times []float64
+	for _, line := range strings.Fields(string(out)) {
+		if t, err := strconv.ParseFloat(strings.Trim(line, ","), 64); err == nil {
+			times = append(times, t)
+		}
+	}
+	return times, nil
+}
+
+// atKeyframe tells if the offset is at one of the key frames, the start of a video is always one
+func atKeyframe(offset float64, keyframes []float64) bool {
+	if offset <= keyframeTolerance {
+		return true
+	}
+	for _, t := range keyframes {
+		if math.Abs(t-offset) <= keyframeTolerance {
+			return true
+		}
+	}
+	return false
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
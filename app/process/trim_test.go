@@ -0,0 +1,104 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// fakeTrimTools fakes ffprobe with the key frames every 2 seconds and ffmpeg writing its arguments to the output,
+// it returns the file with the ffmpeg calls
+func fakeTrimTools(t *testing.T) string {
+	t.Helper()
+	calls := filepath.Join(t.TempDir(), "calls")
+	createFakeTool(t, "ffprobe", `printf '0.000000\n2.000000\n4.000000\n6.000000\n'`)
+	createFakeFFmpeg(t, `echo "$@" >> `+calls+`; eval out=\${$#}; echo "$@" > "$out"`)
+	return calls
+}
+
+func readCalls(t *testing.T, calls string) []string {
+	t.Helper()
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestTrimStep_Key(t *testing.T) {
+	step := &TrimStep{}
+	_, ok := step.Key(finder.File{}, "")
+	assert.False(t, ok, "no sidecar")
+	_, ok = step.Key(finder.File{Sidecar: &finder.Sidecar{}}, "")
+	assert.False(t, ok, "nothing to cut")
+	trimmed, ok := step.Key(finder.File{Sidecar: &finder.Sidecar{Start: 2}}, "")
+	assert.True(t, ok)
+	joined, ok := step.Key(finder.File{Sidecar: &finder.Sidecar{Segments: []finder.Segment{{Start: 2, End: 4}, {Start: 6}}}}, "")
+	assert.True(t, ok)
+	assert.NotEqual(t, trimmed, joined)
+}
+
+func TestTrimStep_Copy(t *testing.T) {
+	calls := fakeTrimTools(t)
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	file := finder.File{Path: "in.mp4", Name: "in.mp4", Sidecar: &finder.Sidecar{Start: 2, End: 6}}
+
+	require.NoError(t, (&TrimStep{}).Process(file, "", out))
+	lines := readCalls(t, calls)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "-y -v error -ss 2.000 -i in.mp4 -t 4.000 -map 0:v -map 0:a? -c copy -avoid_negative_ts make_zero -movflags +faststart "+out, lines[0])
+	assert.FileExists(t, out)
+}
+
+func TestTrimStep_EndBetweenKeyframes(t *testing.T) {
+	calls := fakeTrimTools(t)
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	file := finder.File{Path: "in.mp4", Name: "in.mp4", Sidecar: &finder.Sidecar{Start: 2, End: 5.5}}
+
+	require.NoError(t, (&TrimStep{}).Process(file, "", out))
+	lines := readCalls(t, calls)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "-y -v error -ss 2.000 -i in.mp4 -t 3.500 -c:v libx264 -c:a aac -movflags +faststart "+out, lines[0],
+		"a copy would end at the key frame after the end, so it is re-encoded")
+}
+
+func TestTrimStep_Reencode(t *testing.T) {
+	calls := fakeTrimTools(t)
+	out := filepath.Join(t.TempDir(), "out.mp4")
+	file := finder.File{Path: "in.mp4", Name: "in.mp4", Sidecar: &finder.Sidecar{Start: 3}}
+
+	require.NoError(t, (&TrimStep{}).Process(file, "", out))
+	lines := readCalls(t, calls)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "-y -v error -ss 3.000 -i in.mp4 -c:v libx264 -c:a aac -movflags +faststart "+out, lines[0],
+		"the start between the key frames is re-encoded to the end")
+}
+
+func TestTrimStep_Segments(t *testing.T) {
+	calls := fakeTrimTools(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.mp4")
+	file := finder.File{Path: "in.mp4", Name: "in.mp4", Sidecar: &finder.Sidecar{Segments: []finder.Segment{{Start: 0, End: 2}, {Start: 5, End: 6}}}}
+
+	require.NoError(t, (&TrimStep{}).Process(file, "", out))
+	lines := readCalls(t, calls)
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "-ss 0.000 -i in.mp4 -t 2.000 -c:v libx264", "a segment isn't at a key frame, so all are re-encoded")
+	assert.Contains(t, lines[1], "-ss 5.000 -i in.mp4 -t 1.000 -c:v libx264")
+	assert.Contains(t, lines[2], "-f concat -safe 0 -i ")
+	assert.True(t, strings.HasSuffix(lines[2], "-c copy -movflags +faststart "+out))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the segments are removed")
+}
+
+func TestTrimStep_Error(t *testing.T) {
+	createFakeTool(t, "ffprobe", `echo "in.mp4: No such file or directory" >&2; exit 1`)
+	file := finder.File{Path: "in.mp4", Name: "in.mp4", Sidecar: &finder.Sidecar{Start: 2}}
+	err := (&TrimStep{}).Process(file, "", filepath.Join(t.TempDir(), "out.mp4"))
+	assert.ErrorContains(t, err, "No such file or directory")
+}
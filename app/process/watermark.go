@@ -0,0 +1,174 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// Positions of a watermark
+const (
+	TopLeft     = "top_left"
+	TopRight    = "top_right"
+	BottomLeft  = "bottom_left"
+	BottomRight = "bottom_right"
+)
+
+// watermarkMargin is the distance of a watermark from the edges in pixels
+const watermarkMargin = 16
+
+// Watermark is a PNG image or a text overlaid on the videos of a destination
+type Watermark struct {
+	// Image is the path of a PNG, Text is drawn if it is empty
+	Image string `json:"image,omitempty"`
+	Text  string `json:"text,omitempty"`
+	// Position is a corner: top_left, top_right, bottom_left or bottom_right, BottomRight if empty
+	Position string `json:"position,omitempty"`
+	// Opacity from 0 to 1, 1 if zero
+	Opacity float64 `json:"opacity,omitempty"`
+	// FontSize of the text in pixels, 24 if zero
+	FontSize int `json:"font_size,omitempty"`
+	// Font is the path of the font file of the text, the default font of ffmpeg if empty
+	Font string `json:"font,omitempty"`
+}
+
+// Validate checks the watermark
+func (w Watermark) Validate() error {
+	if (w.Image == "") == (w.Text == "") {
+		return errors.New("one of image and text is required")
+	}
+	switch w.Position {
+	case "", TopLeft, TopRight, BottomLeft, BottomRight:
+	default:
+		return errors.Errorf("unknown position %q, expected one of top_left, top_right, bottom_left, bottom_right", w.Position)
+	}
+	if w.Opacity < 0 || w.Opacity > 1 {
+		return errors.New("opacity must be between 0 and 1")
+	}
+	if w.FontSize < 0 {
+		return errors.New("font size must not be negative")
+	}
+	return nil
+}
+
+// WatermarkStep overlays the watermarks of the destinations with ffmpeg,
+// the files with a sidecar opting out are kept as they are
+type WatermarkStep struct {
+	// Default is the watermark of the default destination, nil if it has none
+	Default *Watermark
+	// Destinations are the watermarks by the names of the destinations
+	Destinations map[string]*Watermark
+}
+
+func (o *WatermarkStep) Name() string {
+	return "watermark"
+}
+
+func (o *WatermarkStep) Key(file finder.File, destination string) (string, bool) {
+	wm := o.watermark(destination)
+	if wm == nil || file.Sidecar.NoWatermark() {
+		return "", false
+	}
+	data, err := json.Marshal(wm)
+	if err != nil {
+		return "", false
+	}
+	key := string(data)
+	if wm.Image != "" {
+		// the output is made again if the image is replaced at the same path
+		hash, err := finder.HashFile(wm.Image, finder.HashSHA256)
+		if err != nil {
+			log.Printf("[WARN] can't hash watermark %s: %v", wm.Image, err)
+		}
+		key += "\n" + hash
+	}
+	return key, true
+}
+
+func (o *WatermarkStep) Process(file finder.File, destination, out string) error {
+	wm := o.watermark(destination)
+	if wm == nil {
+		return errors.Errorf("no watermark for destination %q", destination)
+	}
+	args := []string{"-y", "-v", "error", "-i", file.Path}
+	opacity := strconv.FormatFloat(wm.opacity(), 'f', 2, 64)
+	x, y := wm.offsets()
+	if wm.Image != "" {
+		args = append(args, "-i", wm.Image, "-filter_complex",
+			fmt.Sprintf("[1:v]format=rgba,colorchannelmixer=aa=%s[wm];[0:v][wm]overlay=%s:%s", opacity, x, y))
+	} else {
+		// the text is read from a file, so it isn't parsed by the filter
+		textFile := out + ".txt"
+		if err := os.WriteFile(textFile, []byte(wm.Text), 0o600); err != nil {
+			return err
+		}
+		defer os.Remove(textFile)
+		filter := fmt.Sprintf("drawtext=textfile=%s:expansion=none:fontsize=%d:fontcolor=white@%s:shadowcolor=black@%s:shadowx=2:shadowy=2:x=%s:y=%s",
+			escapeFilterValue(textFile), wm.fontSize(), opacity, opacity, x, y)
+		if wm.Font != "" {
+			filter += ":fontfile=" + escapeFilterValue(wm.Font)
+		}
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, "-c:v", "libx264", "-c:a", "copy", "-movflags", "+faststart", out)
+	return ffmpeg(args...)
+}
+
+// watermark returns the watermark of the destination name, nil if there is none
+func (o *WatermarkStep) watermark(destination string) *Watermark {
+	if destination == "" {
+		return o.Default
+	}
+	return o.Destinations[destination]
+}
+
+func (w Watermark) opacity() float64 {
+	if w.Opacity == 0 {
+		return 1
+	}
+	return w.Opacity
+}
+
+func (w Watermark) fontSize() int {
+	if w.FontSize == 0 {
+		return 24
+	}
+	return w.FontSize
+}
+
+// offsets returns the ffmpeg expressions of the position of the watermark for overlay or drawtext
+func (w Watermark) offsets() (string, string) {
+	x, y := strconv.Itoa(watermarkMargin), strconv.Itoa(watermarkMargin)
+	right, bottom := fmt.Sprintf("main_w-overlay_w-%d", watermarkMargin), fmt.Sprintf("main_h-overlay_h-%d", watermarkMargin)
+	if w.Image == "" {
+		right, bottom = fmt.Sprintf("w-tw-%d", watermarkMargin), fmt.Sprintf("h-th-%d", watermarkMargin)
+	}
+	switch w.Position {
+	case TopLeft:
+	case TopRight:
+		x = right
+	case BottomLeft:
+		y = bottom
+	default:
+		x, y = right, bottom
+	}
+	return x, y
+}
+
+// escapeFilterValue escapes the value of a filter option, first for the option and then for the filtergraph
+func escapeFilterValue(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(value)
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(value)
+}
+
+func ffmpeg(args ...string) error {
+	_, err := finder.RunFFmpeg(args...)
+	return err
+}
@@ -0,0 +1,111 @@
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+func createFakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	createFakeTool(t, "ffmpeg", script)
+}
+
+func createFakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestWatermarkStep(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	// records the arguments and writes the output file passed as the last argument
+	createFakeFFmpeg(t, `echo "$@" >> `+calls+`; eval out=\${$#}; printf 'marked' > "$out"`)
+	step := &WatermarkStep{
+		Default:      &Watermark{Image: "logo.png", Opacity: 0.5},
+		Destinations: map[string]*Watermark{"main": {Text: "@main", Position: TopLeft}},
+	}
+	file := finder.File{Path: writeFile(t, "a.mp4", "video"), Name: "a.mp4"}
+	out := filepath.Join(t.TempDir(), "out.mp4")
+
+	_, ok := step.Key(file, "plain")
+	assert.False(t, ok, "no watermark for the destination")
+	off := false
+	_, ok = step.Key(finder.File{Sidecar: &finder.Sidecar{Watermark: &off}}, "main")
+	assert.False(t, ok, "the sidecar opts out")
+	imageKey, ok := step.Key(file, "")
+	assert.True(t, ok)
+	textKey, ok := step.Key(file, "main")
+	assert.True(t, ok)
+	assert.NotEqual(t, imageKey, textKey)
+
+	require.NoError(t, step.Process(file, "", out))
+	require.NoError(t, step.Process(file, "main", out))
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	assert.Equal(t, "marked", string(data))
+	assert.NoFileExists(t, out+".txt", "the text file is removed")
+
+	data, err = os.ReadFile(calls)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "-i logo.png -filter_complex [1:v]format=rgba,colorchannelmixer=aa=0.50[wm];[0:v][wm]overlay=main_w-overlay_w-16:main_h-overlay_h-16")
+	assert.Contains(t, lines[1], ":expansion=none:fontsize=24:fontcolor=white@1.00:")
+	assert.Contains(t, lines[1], ":x=16:y=16")
+}
+
+func TestWatermarkStep_KeyOfImage(t *testing.T) {
+	image := writeFile(t, "logo.png", "logo")
+	step := &WatermarkStep{Default: &Watermark{Image: image}}
+	before, ok := step.Key(finder.File{}, "")
+	require.True(t, ok)
+
+	require.NoError(t, os.WriteFile(image, []byte("new logo"), 0o600))
+	after, ok := step.Key(finder.File{}, "")
+	require.True(t, ok)
+	assert.NotEqual(t, before, after, "the image is replaced at the same path")
+}
+
+func TestWatermarkStep_EscapesPaths(t *testing.T) {
+	calls := filepath.Join(t.TempDir(), "calls")
+	// printf keeps the backslashes, echo of some shells doesn't
+	createFakeFFmpeg(t, `printf '%s\n' "$*" >> `+calls+`; eval out=\${$#}; printf 'marked' > "$out"`)
+	step := &WatermarkStep{Default: &Watermark{Text: "@main", Font: `C:\fonts\it's,bold.ttf`}}
+	file := finder.File{Path: writeFile(t, "a.mp4", "video"), Name: "a.mp4"}
+	out := filepath.Join(t.TempDir(), "a:b.mp4")
+
+	require.NoError(t, step.Process(file, "", out))
+	data, err := os.ReadFile(calls)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "textfile="+strings.ReplaceAll(out, ":", `\\:`)+".txt:expansion=none")
+	assert.Contains(t, string(data), `:fontfile=C\\:\\\\fonts\\\\it\\\'s\,bold.ttf`)
+}
+
+func TestEscapeFilterValue(t *testing.T) {
+	assert.Equal(t, "plain/path.txt", escapeFilterValue("plain/path.txt"))
+	assert.Equal(t, `a\\:b`, escapeFilterValue("a:b"))
+	assert.Equal(t, `it\\\'s\,x\;y\[z\]`, escapeFilterValue("it's,x;y[z]"))
+	assert.Equal(t, `c\\\\d`, escapeFilterValue(`c\d`))
+}
+
+func TestWatermark_Validate(t *testing.T) {
+	assert.NoError(t, Watermark{Text: "@main"}.Validate())
+	assert.EqualError(t, Watermark{}.Validate(), "one of image and text is required")
+	assert.EqualError(t, Watermark{Image: "a.png", Opacity: 1.5}.Validate(), "opacity must be between 0 and 1")
+	assert.ErrorContains(t, Watermark{Image: "a.png", Position: "center"}.Validate(), `unknown position "center"`)
+}
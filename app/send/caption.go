@@ -0,0 +1,347 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+const (
+	// MaxCaptionLength is the limit of a media caption in visible characters
+	MaxCaptionLength = 1024
+	// MaxTextLength is the limit of a text message in visible characters
+	MaxTextLength = 4096
+)
+
+// ellipsis ends a truncated caption
+const ellipsis = "…"
+
+// CaptionOverflow is what to do with a caption exceeding the limit
+type CaptionOverflow string
+
+const (
+	// OverflowTruncate drops the end of the caption
+	OverflowTruncate CaptionOverflow = "truncate"
+	// OverflowReply sends the end of the caption as a text message replying to the video
+	OverflowReply CaptionOverflow = "reply"
+)
+
+// ParseCaptionOverflow checks the name of the overflow policy, empty name is OverflowTruncate
+func ParseCaptionOverflow(name string) (CaptionOverflow, error) {
+	switch o := CaptionOverflow(name); o {
+	case "":
+		return OverflowTruncate, nil
+	case OverflowTruncate, OverflowReply:
+		return o, nil
+	}
+	return "", fmt.Errorf("unknown overflow %q, expected truncate or reply", name)
+}
+
+// ParseParseMode checks the name of the parse mode, empty name is tb.ModeHTML
+func ParseParseMode(name string) (tb.ParseMode, error) {
+	switch strings.ToLower(name) {
+	case "", "html":
+		return tb.ModeHTML, nil
+	case "markdownv2":
+		return tb.ModeMarkdownV2, nil
+	}
+	return "", fmt.Errorf("unsupported parse mode %q, expected HTML or MarkdownV2", name)
+}
+
+var (
+	htmlTagRe    = regexp.MustCompile(`^<(/?)([a-zA-Z][a-zA-Z0-9-]*)([^<>]*)>`)
+	htmlEntityRe = regexp.MustCompile(`^&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z]+);`)
+	htmlAttrRe   = regexp.MustCompile(`([a-zA-Z-]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+))?`)
+	// htmlTags are the tags supported by Telegram with their attributes
+	htmlTags = map[string][]string{
+		"b": nil, "strong": nil, "i": nil, "em": nil, "u": nil, "ins": nil,
+		"s": nil, "strike": nil, "del": nil, "tg-spoiler": nil, "pre": nil,
+		"span": {"class"}, "a": {"href"}, "tg-emoji": {"emoji-id"},
+		"code": {"class"}, "blockquote": {"expandable"},
+	}
+	// htmlEntities are the named entities supported by Telegram
+	htmlEntities = map[string]string{"lt": "<", "gt": ">", "amp": "&", "quot": `"`}
+	// markdownV2Reserved must be escaped in MarkdownV2
+	markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+)
+
+// captionUnit is a tag or a visible character of a caption
+type captionUnit struct {
+	start, end int
+	// length is the number of UTF-16 code units Telegram counts, 0 for a tag
+	length int
+	space  bool
+	// open and closing mark the tags, close is the text closing the opened tag
+	open, closing bool
+	close         string
+}
+
+// parseCaption splits the caption into the tags and the visible characters.
+// It doesn't stop at the first formatting error and returns it along with the units.
+func parseCaption(text string, mode tb.ParseMode) ([]captionUnit, error) {
+	if mode == tb.ModeMarkdownV2 {
+		return parseMarkdownV2(text)
+	}
+	return parseHTML(text)
+}
+
+func parseHTML(text string) ([]captionUnit, error) {
+	var units []captionUnit
+	var errs []error
+	var stack []int
+	for i := 0; i < len(text); {
+		if m := htmlTagRe.FindStringSubmatch(text[i:]); m != nil {
+			name := strings.ToLower(m[2])
+			u := captionUnit{start: i, end: i + len(m[0])}
+			allowed, ok := htmlTags[name]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("unsupported tag <%s> at byte offset %d", name, i))
+			case m[1] == "":
+				for _, attr := range htmlAttrRe.FindAllStringSubmatch(m[3], -1) {
+					if !slices.Contains(allowed, strings.ToLower(attr[1])) {
+						errs = append(errs, fmt.Errorf("unsupported attribute %q of <%s>", attr[1], name))
+					}
+				}
+				u.open, u.close = true, "</"+name+">"
+				stack = append(stack, len(units))
+			default:
+				u.closing = true
+				if len(stack) == 0 || units[stack[len(stack)-1]].close != "</"+name+">" {
+					errs = append(errs, fmt.Errorf("unexpected end tag </%s> at byte offset %d", name, i))
+				} else {
+					stack = stack[:len(stack)-1]
+				}
+			}
+			units = append(units, u)
+			i = u.end
+			continue
+		}
+		if m := htmlEntityRe.FindStringSubmatch(text[i:]); m != nil {
+			char, ok := htmlEntities[m[1]]
+			if strings.HasPrefix(m[1], "#") {
+				char, ok = "?", true
+			}
+			if !ok {
+				errs = append(errs, fmt.Errorf("unsupported entity %s", m[0]))
+			}
+			units = append(units, captionUnit{start: i, end: i + len(m[0]), length: utf16Len(char)})
+			i += len(m[0])
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == '<' || r == '>' || r == '&' {
+			errs = append(errs, fmt.Errorf("%q at byte offset %d must be escaped", r, i))
+		}
+		units = append(units, captionUnit{start: i, end: i + size, length: utf16Len(string(r)), space: unicode.IsSpace(r)})
+		i += size
+	}
+	for _, open := range stack {
+		errs = append(errs, fmt.Errorf("no end tag %s for %s", units[open].close, text[units[open].start:units[open].end]))
+	}
+	return units, errors.Join(errs...)
+}
+
+func parseMarkdownV2(text string) ([]captionUnit, error) {
+	var units []captionUnit
+	var errs []error
+	var stack []int
+	// toggle opens the entity of the marker or closes the opened one
+	toggle := func(i int, marker string) int {
+		u := captionUnit{start: i, end: i + len(marker)}
+		if n := len(stack); n > 0 && units[stack[n-1]].close == marker {
+			u.closing = true
+			stack = stack[:n-1]
+		} else {
+			u.open, u.close = true, marker
+			stack = append(stack, len(units))
+		}
+		units = append(units, u)
+		return u.end
+	}
+	code := "" // the marker of the code entity the text is in
+
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			r, size := utf8.DecodeRuneInString(text[i+1:])
+			units = append(units, captionUnit{start: i, end: i + 1 + size, length: utf16Len(string(r))})
+			i += 1 + size
+		case code != "":
+			if strings.HasPrefix(text[i:], code) {
+				i, code = toggle(i, code), ""
+				continue
+			}
+			r, size := utf8.DecodeRuneInString(text[i:])
+			units = append(units, captionUnit{start: i, end: i + size, length: utf16Len(string(r)), space: unicode.IsSpace(r)})
+			i += size
+		case strings.HasPrefix(text[i:], "```"):
+			// the language is a part of the opening marker
+			end := i + 3
+			if nl := strings.IndexByte(text[end:], '\n'); nl >= 0 && !strings.ContainsAny(text[end:end+nl], " `") {
+				end += nl + 1
+			}
+			units = append(units, captionUnit{start: i, end: end, open: true, close: "```"})
+			stack = append(stack, len(units)-1)
+			i, code = end, "```"
+		case c == '`':
+			i, code = toggle(i, "`"), "`"
+		case strings.HasPrefix(text[i:], "||"), strings.HasPrefix(text[i:], "__"):
+			i = toggle(i, text[i:i+2])
+		case c == '*' || c == '_' || c == '~':
+			i = toggle(i, text[i:i+1])
+		case c == '[' || strings.HasPrefix(text[i:], "!["):
+			u := captionUnit{start: i, end: i + 1, open: true}
+			if c == '!' {
+				u.end++
+			}
+			stack = append(stack, len(units))
+			units = append(units, u)
+			i = u.end
+		case strings.HasPrefix(text[i:], "](") && len(stack) > 0 && units[stack[len(stack)-1]].close == "":
+			end := i + 2
+			for end < len(text) && text[end] != ')' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				errs = append(errs, fmt.Errorf("no end of the URL at byte offset %d", i))
+				end = len(text) - 1
+			}
+			units[stack[len(stack)-1]].close = text[i : end+1]
+			stack = stack[:len(stack)-1]
+			units = append(units, captionUnit{start: i, end: end + 1, closing: true})
+			i = end + 1
+		case c == '>' && (i == 0 || text[i-1] == '\n'):
+			// a quote line
+			units = append(units, captionUnit{start: i, end: i + 1})
+			i++
+		default:
+			r, size := utf8.DecodeRuneInString(text[i:])
+			if strings.ContainsRune(markdownV2Reserved, r) {
+				errs = append(errs, fmt.Errorf("character %q at byte offset %d is reserved and must be escaped with '\\'", r, i))
+			}
+			units = append(units, captionUnit{start: i, end: i + size, length: utf16Len(string(r)), space: unicode.IsSpace(r)})
+			i += size
+		}
+	}
+	for _, open := range stack {
+		u := units[open]
+		if u.close == "" {
+			errs = append(errs, fmt.Errorf("no end of the link at byte offset %d", u.start))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("no end %s of the entity at byte offset %d", u.close, u.start))
+	}
+	return units, errors.Join(errs...)
+}
+
+// ValidateCaption checks the formatting of the caption in the parse mode as Telegram does
+func ValidateCaption(text string, mode tb.ParseMode) error {
+	if _, err := parseCaption(text, mode); err != nil {
+		return &Error{Kind: ErrBadCaption, Err: err}
+	}
+	return nil
+}
+
+// CaptionLength returns the number of visible characters of the caption as counted by Telegram
+func CaptionLength(text string, mode tb.ParseMode) int {
+	units, _ := parseCaption(text, mode)
+	length := 0
+	for _, u := range units {
+		length += u.length
+	}
+	return length
+}
+
+// SplitCaption truncates the caption to the limit on a word boundary and returns the rest as overflow.
+// The entities open at the cut are closed in the caption and opened again in the overflow.
+func SplitCaption(text string, limit int, mode tb.ParseMode) (caption, overflow string) {
+	if CaptionLength(text, mode) <= limit {
+		return text, ""
+	}
+
+	budget := limit - utf16Len(ellipsis)
+	type cut struct {
+		pos, length int
+		open        []captionUnit
+	}
+	var last, word cut
+	var open []captionUnit
+	length := 0
+	units, _ := parseCaption(text, mode)
+	for _, u := range units {
+		switch {
+		case u.open:
+			open = append(open, u)
+			continue
+		case u.closing:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+			continue
+		}
+		if u.space {
+			word = cut{pos: u.start, length: length, open: append([]captionUnit(nil), open...)}
+		}
+		if length+u.length > budget {
+			break
+		}
+		length += u.length
+		last = cut{pos: u.end, length: length, open: append([]captionUnit(nil), open...)}
+	}
+	// a long word is cut in the middle rather than losing the most of the caption
+	c := last
+	if word.length > 0 && word.length >= budget/2 {
+		c = word
+	}
+
+	var head, tail strings.Builder
+	head.WriteString(strings.TrimRightFunc(text[:c.pos], unicode.IsSpace))
+	head.WriteString(ellipsis)
+	for i := len(c.open) - 1; i >= 0; i-- {
+		head.WriteString(c.open[i].close)
+	}
+	for _, u := range c.open {
+		tail.WriteString(text[u.start:u.end])
+	}
+	tail.WriteString(strings.TrimLeftFunc(text[c.pos:], unicode.IsSpace))
+	return head.String(), tail.String()
+}
+
+// fitCaption returns the caption fitting the limit and the overflow to send in a reply,
+// the overflow is dropped unless the policy is OverflowReply
+func fitCaption(text string, limit int, policy CaptionOverflow, mode tb.ParseMode) (caption, overflow string) {
+	caption, overflow = SplitCaption(text, limit, mode)
+	if overflow != "" && policy != OverflowReply {
+		log.Printf("[INFO] caption is truncated to %d characters", limit)
+		return caption, ""
+	}
+	return caption, overflow
+}
+
+// splitText cuts the text into the messages fitting the limit
+func splitText(text string, limit int, mode tb.ParseMode) []string {
+	var messages []string
+	for text != "" {
+		var message string
+		message, text = SplitCaption(text, limit, mode)
+		messages = append(messages, message)
+	}
+	return messages
+}
+
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,90 @@
+package send
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	tb "gopkg.in/telebot.v4"
+)
+
+func TestCaptionLength(t *testing.T) {
+	assert.Equal(t, 5, CaptionLength("hello", tb.ModeHTML))
+	assert.Equal(t, 5, CaptionLength(`<b>he</b><a href="https://t.me">llo</a>`, tb.ModeHTML))
+	assert.Equal(t, 3, CaptionLength("&lt;&gt;&#33;", tb.ModeHTML))
+	assert.Equal(t, 2, CaptionLength("😀", tb.ModeHTML), "Telegram counts UTF-16 code units")
+	assert.Equal(t, 4, CaptionLength("мир!", tb.ModeHTML))
+	assert.Equal(t, 5, CaptionLength(`*he*[ll\!](https://t.me)`, tb.ModeMarkdownV2))
+}
+
+func TestSplitCaption(t *testing.T) {
+	tests := []struct {
+		name, text        string
+		limit             int
+		mode              tb.ParseMode
+		caption, overflow string
+	}{
+		{"fits", "<b>short</b>", 10, tb.ModeHTML, "<b>short</b>", ""},
+		{"word boundary", "one two three four", 10, tb.ModeHTML, "one two…", "three four"},
+		{"closes and reopens tags", "<b>one <i>two three</i></b> four", 10, tb.ModeHTML, "<b>one <i>two…</i></b>", "<b><i>three</i></b> four"},
+		{"keeps link attributes", `see <a href="https://t.me/x">the long link</a>`, 10, tb.ModeHTML, `see <a href="https://t.me/x">the…</a>`, `<a href="https://t.me/x">long link</a>`},
+		{"entities are one character", "a&amp;b c&amp;d e&amp;f", 8, tb.ModeHTML, "a&amp;b c&amp;d…", "e&amp;f"},
+		{"long word", "abcdefghijklmnop", 6, tb.ModeHTML, "abcde…", "fghijklmnop"},
+		{"markdown escapes are one character", `a\.b c\.d e\.f`, 8, tb.ModeMarkdownV2, `a\.b c\.d…`, `e\.f`},
+		{"markdown closes and reopens entities", "*one _two three_* four", 10, tb.ModeMarkdownV2, "*one _two…_*", "*_three_* four"},
+		{"markdown keeps link url", "see [the long link](https://t.me/x)", 10, tb.ModeMarkdownV2, "see [the…](https://t.me/x)", "[long link](https://t.me/x)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caption, overflow := SplitCaption(tt.text, tt.limit, tt.mode)
+			assert.Equal(t, tt.caption, caption)
+			assert.Equal(t, tt.overflow, overflow)
+			assert.LessOrEqual(t, CaptionLength(caption, tt.mode), tt.limit)
+		})
+	}
+}
+
+func TestSplitText(t *testing.T) {
+	text := strings.Repeat("word ", 30)
+	messages := splitText(text, 50, tb.ModeHTML)
+	assert.Len(t, messages, 3)
+	for _, m := range messages {
+		assert.LessOrEqual(t, CaptionLength(m, tb.ModeHTML), 50)
+	}
+	joined := strings.ReplaceAll(strings.Join(messages, " "), ellipsis, "")
+	assert.Equal(t, strings.Fields(text), strings.Fields(joined), "nothing is lost but the ellipsis")
+}
+
+func TestValidateCaption(t *testing.T) {
+	tests := []struct {
+		name, text string
+		mode       tb.ParseMode
+		err        string
+	}{
+		{"html", `<b>bold</b> <a href="https://t.me">link</a> <span class="tg-spoiler">x</span> &lt;&amp;&quot;`, tb.ModeHTML, ""},
+		{"html pre code", `<pre><code class="language-go">x := 1</code></pre>`, tb.ModeHTML, ""},
+		{"html unsupported tag", "<div>x</div>", tb.ModeHTML, "unsupported tag <div>"},
+		{"html unsupported attribute", `<b style="x">x</b>`, tb.ModeHTML, `unsupported attribute "style" of <b>`},
+		{"html unclosed tag", "<b>x", tb.ModeHTML, "no end tag </b>"},
+		{"html misnested tags", "<b><i>x</b></i>", tb.ModeHTML, "unexpected end tag </b>"},
+		{"html raw ampersand", "fish & chips", tb.ModeHTML, "'&' at byte offset 5 must be escaped"},
+		{"html unknown entity", "&nbsp;", tb.ModeHTML, "unsupported entity &nbsp;"},
+		{"markdown", "*bold* _italic_ __under__ ~strike~ ||spoiler|| `code` [link](https://t.me/x\\)) 1\\.5", tb.ModeMarkdownV2, ""},
+		{"markdown pre", "```go\nx := 1.5\n```", tb.ModeMarkdownV2, ""},
+		{"markdown quote", ">quoted\n>lines", tb.ModeMarkdownV2, ""},
+		{"markdown reserved", "v1.5", tb.ModeMarkdownV2, "character '.' at byte offset 2 is reserved"},
+		{"markdown unclosed", "*bold", tb.ModeMarkdownV2, "no end * of the entity"},
+		{"markdown unclosed link", "[text", tb.ModeMarkdownV2, "no end of the link"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCaption(tt.text, tt.mode)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrBadCaption)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package send
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// defaultPreviewsLimit is the number of previews kept by DryRunClient
+const defaultPreviewsLimit = 100
+
+// Preview is what TelegramClient would send for a Post
+type Preview struct {
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+	// Album are the paths of the files sent with Path as an album
+	Album []string `json:"album,omitempty"`
+	// Destination is the requested destination, Chat is the resolved chat ID
+	Destination string `json:"destination,omitempty"`
+	Chat        string `json:"chat"`
+	// Caption is formatted in ParseMode
+	Caption string `json:"caption"`
+	// Overflow is the end of a long caption sent in a reply
+	Overflow  string `json:"overflow,omitempty"`
+	ParseMode string `json:"parse_mode"`
+	Stars     int    `json:"stars"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Duration  int    `json:"duration"`
+	Streaming bool   `json:"streaming"`
+	// Size of the file in bytes
+	Size int64 `json:"size"`
+	// Fallback is the policy applied because the file exceeds the upload limit, empty if it fits
+	Fallback Fallback `json:"fallback,omitempty"`
+	// Processed are the steps of the pipeline applied to the file
+	Processed []string `json:"processed,omitempty"`
+	// Thumbnail is a JPEG preview of the video, empty if it can't be made
+	Thumbnail []byte `json:"thumbnail,omitempty"`
+}
+
+// Previewer returns the recorded previews
+type Previewer interface {
+	Previews() []Preview
+}
+
+// DryRunClient is a Client recording what would be sent without contacting Telegram
+type DryRunClient struct {
+	Opts      *Options
+	Formatter TelegramFormatter
+	// Formatters are the formatters of the destinations, Formatter is used for the rest
+	Formatters map[string]TelegramFormatter
+	// Thumbnailer makes Preview.Thumbnail, thumbnails are skipped if nil
+	Thumbnailer finder.Thumbnailer
+	// ThumbnailWidth is the width of Preview.Thumbnail
+	ThumbnailWidth int
+	// Limit is the number of the latest previews to keep
+	Limit int
+
+	mu       sync.Mutex
+	previews []Preview
+}
+
+// NewDryRunClient creates DryRunClient with ffmpeg thumbnails
+func NewDryRunClient(opts *Options) (*DryRunClient, error) {
+	tf, formatters, err := newFormatters(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DryRunClient{
+		Opts:           opts,
+		Formatter:      tf,
+		Formatters:     formatters,
+		Thumbnailer:    finder.NewFFmpegThumbnailer(),
+		ThumbnailWidth: 320,
+		Limit:          defaultPreviewsLimit,
+	}, nil
+}
+
+// Send records the preview of the post
+func (c *DryRunClient) Send(post Post) error {
+	preview, err := c.Preview(post)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previews = append(c.previews, preview)
+	if c.Limit > 0 && len(c.previews) > c.Limit {
+		c.previews = c.previews[len(c.previews)-c.Limit:]
+	}
+	log.Printf("[INFO] dry run: %s to %s for %d stars: %s", preview.Path, preview.Chat, preview.Stars, preview.Caption)
+	return nil
+}
+
+// Preview returns what would be sent for the post
+func (c *DryRunClient) Preview(post Post) (Preview, error) {
+	chat, err := c.Opts.chat(post.Destination)
+	if err != nil {
+		return Preview{}, err
+	}
+	if chat == "" {
+		return Preview{}, errors.Wrapf(ErrNotConfigured, "no chat for destination %q", post.Destination)
+	}
+
+	caption, mode := postCaption(post, c.Formatter, c.Formatters)
+	if err := ValidateCaption(caption, mode); err != nil {
+		return Preview{}, err
+	}
+	caption, overflow := fitCaption(caption, MaxCaptionLength, c.Opts.CaptionOverflow, mode)
+	video := newVideo(post.File, caption)
+	preview := Preview{
+		Time:        time.Now(),
+		Path:        post.File.Path,
+		Destination: post.Destination,
+		Chat:        recipient{chatID: chat}.Recipient(),
+		Caption:     video.Caption,
+		Overflow:    overflow,
+		ParseMode:   string(mode),
+		Stars:       post.Stars,
+		Width:       video.Width,
+		Height:      video.Height,
+		Duration:    video.Duration,
+		Streaming:   video.Streaming,
+		Size:        fileSize(post.File),
+		Processed:   post.File.Processed,
+	}
+	for _, file := range post.Album {
+		preview.Album = append(preview.Album, file.Path)
+	}
+	if limit := c.Opts.uploadLimit(); limit > 0 && preview.Size > limit {
+		preview.Fallback = c.Opts.Fallback
+		if preview.Fallback == "" {
+			preview.Fallback = FallbackText
+		}
+	}
+	if c.Thumbnailer != nil {
+		thumbnail, err := c.Thumbnailer.Thumbnail(post.File.Path, c.ThumbnailWidth)
+		if err != nil {
+			log.Printf("[WARN] dry run: can't make thumbnail of %s: %v", post.File.Path, err)
+		}
+		preview.Thumbnail = thumbnail
+	}
+	return preview, nil
+}
+
+// CheckDestination validates the destination of a post
+func (c *DryRunClient) CheckDestination(destination string) error {
+	return c.Opts.CheckDestination(destination)
+}
+
+// CheckCaption validates the custom caption of a post to the destination
+func (c *DryRunClient) CheckCaption(destination, caption string) error {
+	return ValidateCaption(postCaption(Post{Destination: destination, Caption: caption}, c.Formatter, c.Formatters))
+}
+
+// Previews returns the recorded previews, the latest one is the last
+func (c *DryRunClient) Previews() []Preview {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Preview(nil), c.previews...)
+}
@@ -0,0 +1,91 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// fakeThumbnailer returns the path and width as the image
+type fakeThumbnailer struct {
+	err error
+}
+
+func (f fakeThumbnailer) Thumbnail(path string, width int) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []byte(fmt.Sprintf("%s@%d", path, width)), nil
+}
+
+func TestDryRunClient_Send(t *testing.T) {
+	client, err := NewDryRunClient(&Options{
+		Channel:      "main_channel",
+		Destinations: []Destination{{Name: "other", Chat: "-100123"}},
+		Caption:      "<b>{{.Title}}</b>",
+	})
+	require.NoError(t, err)
+	client.Thumbnailer = fakeThumbnailer{}
+
+	file := finder.File{
+		Name: "vid.mp4",
+		Path: "/tmp/vid.mp4",
+		Info: &finder.VideoInfo{Width: 640, Height: 480, Duration: 7},
+	}
+	require.NoError(t, client.Send(Post{File: file, Stars: 10}))
+	require.NoError(t, client.Send(Post{File: file, Caption: "custom", Destination: "other"}))
+
+	previews := client.Previews()
+	require.Len(t, previews, 2)
+	assert.Equal(t, "@main_channel", previews[0].Chat)
+	assert.Equal(t, "<b>vid</b>", previews[0].Caption)
+	assert.Equal(t, "HTML", previews[0].ParseMode)
+	assert.Equal(t, 10, previews[0].Stars)
+	assert.Equal(t, 640, previews[0].Width)
+	assert.Equal(t, 480, previews[0].Height)
+	assert.Equal(t, 7, previews[0].Duration)
+	assert.True(t, previews[0].Streaming)
+	assert.Equal(t, "/tmp/vid.mp4@320", string(previews[0].Thumbnail))
+
+	assert.Equal(t, "-100123", previews[1].Chat)
+	assert.Equal(t, "other", previews[1].Destination)
+	assert.Equal(t, "custom", previews[1].Caption)
+	assert.Equal(t, 0, previews[1].Stars)
+}
+
+func TestDryRunClient_Limit(t *testing.T) {
+	client := &DryRunClient{Opts: &Options{Channel: "@x"}, Limit: 2}
+	for _, name := range []string{"a.mp4", "b.mp4", "c.mp4"} {
+		require.NoError(t, client.Send(Post{File: finder.File{Name: name, Path: name}}))
+	}
+	previews := client.Previews()
+	require.Len(t, previews, 2)
+	assert.Equal(t, "b.mp4", previews[0].Path)
+	assert.Equal(t, "c.mp4", previews[1].Path)
+}
+
+func TestDryRunClient_Errors(t *testing.T) {
+	client := &DryRunClient{Opts: &Options{}, Thumbnailer: fakeThumbnailer{err: errors.New("no ffmpeg")}}
+	require.ErrorIs(t, client.Send(Post{File: finder.File{Name: "a.mp4"}}), ErrNotConfigured)
+
+	// a missing thumbnail doesn't fail the preview
+	client.Opts.Channel = "@x"
+	require.NoError(t, client.Send(Post{File: finder.File{Name: "a.mp4"}}))
+	require.Len(t, client.Previews(), 1)
+	assert.Empty(t, client.Previews()[0].Thumbnail)
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := NewClient(&Options{DryRun: true, Token: "tok"})
+	require.NoError(t, err)
+	assert.IsType(t, &DryRunClient{}, client)
+
+	client, err = NewClient(&Options{})
+	require.NoError(t, err)
+	assert.IsType(t, TelegramClient{}, client)
+}
@@ -0,0 +1,95 @@
+package send
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	tb "gopkg.in/telebot.v4"
+)
+
+// Kinds of the errors returned by Send, check them with errors.Is
+var (
+	ErrTooLarge     = errors.New("file is too large")
+	ErrFlood        = errors.New("too many requests")
+	ErrChatNotFound = errors.New("chat not found")
+	ErrForbidden    = errors.New("not allowed to post to the chat")
+	ErrBadCaption   = errors.New("invalid caption")
+	// ErrNoMessages is returned when Telegram accepts an album but returns none of its messages
+	ErrNoMessages = errors.New("telegram returned no messages")
+)
+
+// Error is a Telegram error of a known kind
+type Error struct {
+	// Kind is one of ErrTooLarge, ErrFlood, ErrChatNotFound, ErrForbidden and ErrBadCaption
+	Kind error
+	// RetryAfter is the delay required by ErrFlood
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// telegramErrorRe matches the errors made by telebot from the responses it doesn't know,
+// they have the description and the status code of the response
+var telegramErrorRe = regexp.MustCompile(`^telegram: (.*) \((\d{3})\)$`)
+
+// mapError returns Error for the known Telegram errors and the error itself otherwise
+func mapError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var sendErr *Error
+	if errors.As(err, &sendErr) {
+		return err
+	}
+
+	var flood tb.FloodError
+	if errors.As(err, &flood) {
+		return &Error{Kind: ErrFlood, RetryAfter: time.Duration(flood.RetryAfter) * time.Second, Err: err}
+	}
+
+	code, description, ok := apiError(err)
+	if !ok {
+		return err
+	}
+	description = strings.ToLower(description)
+
+	switch {
+	case code == 413 || description == "request entity too large" || strings.Contains(description, "file is too big"):
+		return &Error{Kind: ErrTooLarge, Err: err}
+	case code == 429:
+		return &Error{Kind: ErrFlood, Err: err}
+	case strings.Contains(description, "chat not found"):
+		return &Error{Kind: ErrChatNotFound, Err: err}
+	case code == 403 || strings.Contains(description, "not enough rights") || strings.Contains(description, "have no rights"):
+		return &Error{Kind: ErrForbidden, Err: err}
+	case strings.Contains(description, "can't parse entities") || strings.Contains(description, "caption is too long"):
+		return &Error{Kind: ErrBadCaption, Err: err}
+	}
+	return err
+}
+
+// apiError returns the status code and the description of the error response of the Telegram API,
+// ok is false for the other errors, e.g. of the network
+func apiError(err error) (code int, description string, ok bool) {
+	var tbErr *tb.Error
+	if errors.As(err, &tbErr) {
+		return tbErr.Code, tbErr.Description, true
+	}
+	for ; err != nil; err = errors.Unwrap(err) {
+		if m := telegramErrorRe.FindStringSubmatch(err.Error()); m != nil {
+			code, _ = strconv.Atoi(m[2])
+			return code, m[1], true
+		}
+	}
+	return 0, "", false
+}
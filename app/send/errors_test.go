@@ -0,0 +1,71 @@
+package send
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+
+	"github.com/meesooqa/files2tg/app/send/telegramtest"
+)
+
+// telegramError returns the error of telebot for the response of the Telegram API
+func telegramError(t *testing.T, failure telegramtest.Failure) error {
+	t.Helper()
+	server := telegramtest.NewServer()
+	t.Cleanup(server.Close)
+	server.FailNext("sendMessage", failure)
+	bot, err := tb.NewBot(tb.Settings{URL: server.URL, Token: telegramtest.Token, Offline: true})
+	require.NoError(t, err)
+	_, err = bot.Raw("sendMessage", map[string]string{"chat_id": "@main", "text": "text"})
+	require.Error(t, err)
+	return err
+}
+
+func TestMapError(t *testing.T) {
+	tests := []struct {
+		failure telegramtest.Failure
+		kind    error
+	}{
+		{telegramtest.Failure{Code: 400, Description: "Request Entity Too Large"}, ErrTooLarge},
+		{telegramtest.EntityTooLarge(), ErrTooLarge},
+		{telegramtest.Failure{Code: 400, Description: "Bad Request: file is too big"}, ErrTooLarge},
+		{telegramtest.ChatNotFound(), ErrChatNotFound},
+		{telegramtest.Failure{Code: 403, Description: "Forbidden: bot was kicked from the channel chat"}, ErrForbidden},
+		{telegramtest.Failure{Code: 403, Description: "Forbidden: bot is not a member of the channel chat"}, ErrForbidden},
+		{telegramtest.Failure{Code: 400, Description: "Bad Request: not enough rights to send videos to the chat"}, ErrForbidden},
+		{telegramtest.Failure{Code: 400, Description: "Bad Request: have no rights to send a message"}, ErrForbidden},
+		{telegramtest.Failure{Code: 400, Description: `Bad Request: can't parse entities: Unsupported start tag "foo" at byte offset 0`}, ErrBadCaption},
+		{telegramtest.Failure{Code: 400, Description: "Bad Request: message caption is too long"}, ErrBadCaption},
+		{telegramtest.Failure{Code: 429, Description: "Too Many Requests"}, ErrFlood},
+	}
+	for _, tt := range tests {
+		tbErr := telegramError(t, tt.failure)
+		err := mapError(tbErr)
+		assert.ErrorIs(t, err, tt.kind, tt.failure.Description)
+		assert.ErrorIs(t, err, tbErr, "the original error is kept")
+	}
+
+	unknown := telegramError(t, telegramtest.Failure{Code: 400, Description: "Bad Request: wrong file identifier"})
+	assert.Equal(t, unknown, mapError(unknown))
+	plain := errors.New("connection refused")
+	assert.Equal(t, plain, mapError(plain))
+	// only the responses of the API are matched, not the text of the other errors
+	local := fmt.Errorf("open chat not found.mp4: %w", os.ErrNotExist)
+	assert.Equal(t, local, mapError(local))
+	assert.NoError(t, mapError(nil))
+}
+
+func TestMapError_Flood(t *testing.T) {
+	flood := tb.FloodError{RetryAfter: 7}
+	err := mapError(fmt.Errorf("wrapped: %w", flood))
+	var sendErr *Error
+	require.True(t, errors.As(err, &sendErr))
+	assert.Equal(t, ErrFlood, sendErr.Kind)
+	assert.Equal(t, 7*time.Second, sendErr.RetryAfter)
+}
@@ -1,16 +1,162 @@
 package send
 
 import (
+	"bytes"
+	"fmt"
+	"log"
 	"path/filepath"
 	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	tb "gopkg.in/telebot.v4"
 
 	"github.com/meesooqa/files2tg/app/finder"
 )
 
-type TelegramFormatter struct{}
+type TelegramFormatter struct {
+	// Template of the caption, the file name without extension is used if nil
+	Template *template.Template
+	// ParseMode of the caption, tb.ModeHTML if empty
+	ParseMode tb.ParseMode
+}
+
+// CaptionData is passed to the caption template
+type CaptionData struct {
+	finder.File
+	// Title is the file name without extension
+	Title string
+}
+
+var (
+	htmlEscaper       = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+	markdownV2Escaper = newMarkdownV2Escaper()
+)
 
-// Format generates HTML message from provided finder.File
+func newMarkdownV2Escaper() *strings.Replacer {
+	var pairs []string
+	for _, c := range markdownV2Reserved {
+		pairs = append(pairs, string(c), `\`+string(c))
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// EscapeCaption escapes the text to be shown as is in a caption of the parse mode
+func EscapeCaption(text string, mode tb.ParseMode) string {
+	if mode == tb.ModeMarkdownV2 {
+		return markdownV2Escaper.Replace(text)
+	}
+	return htmlEscaper.Replace(text)
+}
+
+// NewTelegramFormatter creates formatter with the caption template written in the parse mode,
+// empty text keeps the default caption. The output of every action is escaped unless piped to raw.
+func NewTelegramFormatter(text string, mode tb.ParseMode) (TelegramFormatter, error) {
+	if mode == "" {
+		mode = tb.ModeHTML
+	}
+	if text == "" {
+		return TelegramFormatter{ParseMode: mode}, nil
+	}
+	funcs := template.FuncMap{
+		"escape": func(v any) string { return EscapeCaption(fmt.Sprint(v), mode) },
+		"raw":    func(v any) string { return fmt.Sprint(v) },
+	}
+	tmpl, err := template.New("caption").Option("missingkey=error").Funcs(funcs).Parse(text)
+	if err != nil {
+		return TelegramFormatter{}, err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			escapeActions(t.Tree, t.Tree.Root)
+		}
+	}
+	return TelegramFormatter{Template: tmpl, ParseMode: mode}, nil
+}
+
+// escapeActions pipes the output of the actions to escape
+func escapeActions(tree *parse.Tree, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			escapeActions(tree, child)
+		}
+	case *parse.ActionNode:
+		pipe := n.Pipe
+		if len(pipe.Decl) > 0 || len(pipe.Cmds) == 0 {
+			return
+		}
+		last := pipe.Cmds[len(pipe.Cmds)-1]
+		if id, ok := last.Args[0].(*parse.IdentifierNode); ok && (id.Ident == "raw" || id.Ident == "escape") {
+			return
+		}
+		pipe.Cmds = append(pipe.Cmds, &parse.CommandNode{
+			NodeType: parse.NodeCommand,
+			Pos:      n.Pos,
+			Args:     []parse.Node{parse.NewIdentifier("escape").SetTree(tree).SetPos(n.Pos)},
+		})
+	case *parse.IfNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.RangeNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	case *parse.WithNode:
+		escapeActions(tree, n.List)
+		escapeActions(tree, n.ElseList)
+	}
+}
+
+// Format generates the caption of the file in the parse mode of the formatter
 func (o *TelegramFormatter) Format(file finder.File) string {
 	ext := filepath.Ext(file.Name)
-	return strings.TrimSuffix(file.Name, ext)
+	title := strings.TrimSuffix(file.Name, ext)
+	if o.Template == nil {
+		return EscapeCaption(title, o.mode())
+	}
+
+	caption, err := o.execute(CaptionData{File: file, Title: title})
+	if err != nil {
+		log.Printf("[WARN] can't format caption of %s: %v", file.Name, err)
+		return EscapeCaption(title, o.mode())
+	}
+	return caption
+}
+
+// Check formats a sample file and validates the caption
+func (o *TelegramFormatter) Check() error {
+	if o.Template == nil {
+		return nil
+	}
+	sample := finder.File{
+		Name:    "sample.mp4",
+		Path:    "sample.mp4",
+		Size:    1 << 20,
+		ModTime: time.Now(),
+		Info:    &finder.VideoInfo{Width: 1280, Height: 720, Duration: 60},
+	}
+	caption, err := o.execute(CaptionData{File: sample, Title: "sample"})
+	if err != nil {
+		return err
+	}
+	return ValidateCaption(caption, o.mode())
+}
+
+func (o *TelegramFormatter) execute(data CaptionData) (string, error) {
+	var buf bytes.Buffer
+	if err := o.Template.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+func (o *TelegramFormatter) mode() tb.ParseMode {
+	if o.ParseMode == "" {
+		return tb.ModeHTML
+	}
+	return o.ParseMode
 }
@@ -0,0 +1,93 @@
+package send
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+func TestTelegramFormatter_Format(t *testing.T) {
+	file := finder.File{Name: "my video.mp4", Size: 42, Info: &finder.VideoInfo{Duration: 7}}
+
+	tf, err := NewTelegramFormatter("", tb.ModeHTML)
+	require.NoError(t, err)
+	require.Equal(t, "my video", tf.Format(file))
+
+	tf, err = NewTelegramFormatter("<b>{{.Title}}</b> {{.Info.Duration}}s\n", tb.ModeHTML)
+	require.NoError(t, err)
+	require.Equal(t, "<b>my video</b> 7s", tf.Format(file))
+
+	_, err = NewTelegramFormatter("{{.Title", tb.ModeHTML)
+	require.Error(t, err)
+}
+
+func TestTelegramFormatter_Escape(t *testing.T) {
+	file := finder.File{Name: "Tom & Jerry <1.5>.mp4"}
+
+	tf, err := NewTelegramFormatter("", tb.ModeHTML)
+	require.NoError(t, err)
+	require.Equal(t, "Tom &amp; Jerry &lt;1.5&gt;", tf.Format(file))
+
+	tf, err = NewTelegramFormatter(`<a href="https://t.me/{{.Name}}">{{.Title}}</a> {{if .Name}}<i>{{.Name}}</i>{{end}}`, tb.ModeHTML)
+	require.NoError(t, err)
+	caption := tf.Format(file)
+	require.Equal(t, `<a href="https://t.me/Tom &amp; Jerry &lt;1.5&gt;.mp4">Tom &amp; Jerry &lt;1.5&gt;</a> <i>Tom &amp; Jerry &lt;1.5&gt;.mp4</i>`, caption)
+	require.NoError(t, ValidateCaption(caption, tb.ModeHTML))
+
+	tf, err = NewTelegramFormatter(`{{"<b>" | raw}}{{.Title}}{{"</b>" | raw}}`, tb.ModeHTML)
+	require.NoError(t, err)
+	require.Equal(t, "<b>Tom &amp; Jerry &lt;1.5&gt;</b>", tf.Format(file))
+
+	tf, err = NewTelegramFormatter("*{{.Title}}*", tb.ModeMarkdownV2)
+	require.NoError(t, err)
+	caption = tf.Format(file)
+	require.Equal(t, `*Tom & Jerry <1\.5\>*`, caption)
+	require.NoError(t, ValidateCaption(caption, tb.ModeMarkdownV2))
+}
+
+func TestTelegramFormatter_Check(t *testing.T) {
+	tf, err := NewTelegramFormatter("<b>{{.Title}}</b> {{.Info.Duration}}s", tb.ModeHTML)
+	require.NoError(t, err)
+	require.NoError(t, tf.Check())
+
+	tf, err = NewTelegramFormatter("<div>{{.Title}}</div>", tb.ModeHTML)
+	require.NoError(t, err)
+	require.ErrorIs(t, tf.Check(), ErrBadCaption)
+
+	tf, err = NewTelegramFormatter("{{.Title}} v1.0", tb.ModeMarkdownV2)
+	require.NoError(t, err)
+	require.ErrorIs(t, tf.Check(), ErrBadCaption)
+
+	tf, err = NewTelegramFormatter("{{.Missing}}", tb.ModeHTML)
+	require.NoError(t, err)
+	require.Error(t, tf.Check())
+}
+
+func TestOptions_Chat(t *testing.T) {
+	opts := &Options{
+		Channel:      "@main",
+		Destinations: []Destination{{Name: "main", Chat: "@main"}, {Name: "backup", Chat: "-100123"}},
+	}
+	tests := []struct {
+		destination, chat string
+	}{
+		{"", "@main"},
+		{"backup", "-100123"},
+		{"@raw", "@raw"},
+		{"-1001234567890", "-1001234567890"},
+	}
+	for _, tt := range tests {
+		chat, err := opts.chat(tt.destination)
+		require.NoError(t, err, tt.destination)
+		require.Equal(t, tt.chat, chat, tt.destination)
+	}
+
+	for _, destination := range []string{"backpu", "@", "12ab"} {
+		_, err := opts.chat(destination)
+		require.ErrorIs(t, err, ErrUnknownDestination, destination)
+		require.ErrorIs(t, opts.CheckDestination(destination), ErrUnknownDestination, destination)
+	}
+}
@@ -1,9 +1,13 @@
 package send
 
 import (
+	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,30 +19,209 @@ import (
 )
 
 type Options struct {
+	// Channel is the default destination
 	Channel string
 	Server  string
 	Token   string
 	Timeout time.Duration
+	// Destinations are the named chats a Post can be sent to
+	Destinations []Destination
+	// Caption is the template of the caption, see CaptionData
+	Caption string
+	// ParseMode of the captions, tb.ModeHTML if empty
+	ParseMode tb.ParseMode
+	// DryRun records the posts with DryRunClient instead of sending them
+	DryRun bool
+	// MaxUploadSize is the upload limit in bytes, 0 is the limit of the server, negative disables the check
+	MaxUploadSize int64
+	// Fallback is what to do with a file exceeding the upload limit, FallbackText if empty
+	Fallback Fallback
+	// LinkURL is the base URL of the files for FallbackLink
+	LinkURL string
+	// CaptionOverflow is what to do with a caption longer than MaxCaptionLength, OverflowTruncate if empty
+	CaptionOverflow CaptionOverflow
+}
+
+const (
+	// PublicUploadLimit is the upload limit of api.telegram.org
+	PublicUploadLimit int64 = 50 << 20
+	// LocalUploadLimit is the upload limit of a local Bot API server
+	LocalUploadLimit int64 = 2000 << 20
+)
+
+// Fallback is what Send does with a file exceeding the upload limit
+type Fallback string
+
+const (
+	// FallbackFail returns ErrTooLarge
+	FallbackFail Fallback = "fail"
+	// FallbackText sends the caption only
+	FallbackText Fallback = "text"
+	// FallbackCompress re-encodes the video to fit the limit
+	FallbackCompress Fallback = "compress"
+	// FallbackSplit sends the video in parts as an album
+	FallbackSplit Fallback = "split"
+	// FallbackLink sends the caption with a link to the file at LinkURL
+	FallbackLink Fallback = "link"
+)
+
+// ParseFallback checks the name of the fallback policy, empty name is FallbackText
+func ParseFallback(name string) (Fallback, error) {
+	switch f := Fallback(name); f {
+	case "":
+		return FallbackText, nil
+	case FallbackFail, FallbackText, FallbackCompress, FallbackSplit, FallbackLink:
+		return f, nil
+	}
+	return "", errors.Errorf("unknown fallback %q, expected one of fail, text, compress, split, link", name)
+}
+
+// uploadLimit returns the upload limit in bytes, 0 if there is no limit
+func (o *Options) uploadLimit() int64 {
+	if o.MaxUploadSize < 0 {
+		return 0
+	}
+	if o.MaxUploadSize > 0 {
+		return o.MaxUploadSize
+	}
+	if u, err := url.Parse(o.Server); o.Server == "" || err == nil && u.Hostname() == "api.telegram.org" {
+		return PublicUploadLimit
+	}
+	return LocalUploadLimit
+}
+
+// Destination is a named chat
+type Destination struct {
+	Name string
+	Chat string
+	// ParseMode and Caption override Options.ParseMode and Options.Caption if not empty
+	ParseMode tb.ParseMode
+	Caption   string
+}
+
+// newFormatters creates the default formatter and the formatters of the destinations
+// having their own caption template or parse mode
+func newFormatters(opts *Options) (TelegramFormatter, map[string]TelegramFormatter, error) {
+	def, err := NewTelegramFormatter(opts.Caption, opts.ParseMode)
+	if err != nil {
+		return TelegramFormatter{}, nil, errors.Wrap(err, "caption template")
+	}
+	var formatters map[string]TelegramFormatter
+	for _, d := range opts.Destinations {
+		if d.Caption == "" && d.ParseMode == "" {
+			continue
+		}
+		text, mode := opts.Caption, opts.ParseMode
+		if d.Caption != "" {
+			text = d.Caption
+		}
+		if d.ParseMode != "" {
+			mode = d.ParseMode
+		}
+		tf, err := NewTelegramFormatter(text, mode)
+		if err != nil {
+			return TelegramFormatter{}, nil, errors.Wrapf(err, "caption template of destination %q", d.Name)
+		}
+		if formatters == nil {
+			formatters = map[string]TelegramFormatter{}
+		}
+		formatters[d.Name] = tf
+	}
+	return def, formatters, nil
+}
+
+// postCaption returns the caption of the post and its parse mode,
+// the formatter of the destination is used if there is one
+func postCaption(post Post, def TelegramFormatter, formatters map[string]TelegramFormatter) (string, tb.ParseMode) {
+	tf, ok := formatters[post.Destination]
+	if !ok {
+		tf = def
+	}
+	if post.Caption != "" {
+		return post.Caption, tf.mode()
+	}
+	return tf.Format(post.File), tf.mode()
+}
+
+// chat returns the chat ID of the destination name,
+// a destination that isn't a name is used as a chat ID if it is one, see IsChatID
+func (o *Options) chat(destination string) (string, error) {
+	if destination == "" {
+		return o.Channel, nil
+	}
+	for _, d := range o.Destinations {
+		if d.Name == destination {
+			return d.Chat, nil
+		}
+	}
+	if !IsChatID(destination) {
+		return "", errors.Wrapf(ErrUnknownDestination, "%q", destination)
+	}
+	return destination, nil
+}
+
+// CheckDestination returns ErrUnknownDestination if the destination is neither a name of Destinations nor a chat ID
+func (o *Options) CheckDestination(destination string) error {
+	_, err := o.chat(destination)
+	return err
+}
+
+// IsChatID returns true for a numeric chat ID or a @username
+func IsChatID(s string) bool {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return true
+	}
+	return len(s) > 1 && strings.HasPrefix(s, "@")
+}
+
+// Post describes a video to be sent to Telegram
+type Post struct {
+	File  finder.File
+	Stars int
+	// Caption overrides the formatted caption if not empty
+	Caption string
+	// Destination overrides the configured channel if not empty,
+	// it is a name of Options.Destinations, a numeric chat ID or a @username
+	Destination string
+	// Album are the files sent with File as an album, the caption and the stars are of the whole album
+	Album []finder.File
 }
 
 type Client interface {
-	Send(file finder.File, stars int) error
+	Send(post Post) error
+}
+
+// CaptionChecker validates a custom caption before the post is queued
+type CaptionChecker interface {
+	CheckCaption(destination, caption string) error
 }
 
-type ClientFactory interface {
-	NewClient() (Client, error)
+// DestinationChecker validates the destination before the post is queued
+type DestinationChecker interface {
+	CheckDestination(destination string) error
 }
 
-type EnvClientFactory struct{}
+// ErrNotConfigured is returned by TelegramClient.Send without a bot token or a destination chat
+var ErrNotConfigured = errors.New("telegram client is not configured")
+
+// ErrUnknownDestination is returned for a destination that is neither a configured name nor a chat ID
+var ErrUnknownDestination = errors.New("unknown destination")
 
-func (f *EnvClientFactory) NewClient() (Client, error) {
-	return NewTelegramClientFromEnv()
+// NewClient creates DryRunClient if Options.DryRun is set and TelegramClient otherwise
+func NewClient(opts *Options) (Client, error) {
+	if opts.DryRun {
+		log.Printf("[INFO] dry run, nothing is sent to telegram")
+		return NewDryRunClient(opts)
+	}
+	return NewTelegramClient(opts)
 }
 
 // TelegramSender is the interface for sending messages to telegram
 type TelegramSender interface {
 	Send(tb.Video, *tb.Bot, tb.Recipient, *tb.SendOptions) (*tb.Message, error)
 	SendPaid(tb.Video, *tb.Bot, tb.Recipient, *tb.SendOptions, int) (*tb.Message, error)
+	SendAlbum(tb.Album, *tb.Bot, tb.Recipient, *tb.SendOptions) ([]tb.Message, error)
+	SendPaidAlbum(tb.PaidAlbum, *tb.Bot, tb.Recipient, *tb.SendOptions, int) (*tb.Message, error)
 }
 
 type TelegramClient struct {
@@ -47,27 +230,24 @@ type TelegramClient struct {
 	Timeout        time.Duration
 	TelegramSender TelegramSender
 	Formatter      TelegramFormatter
+	// Formatters are the formatters of the destinations, Formatter is used for the rest
+	Formatters map[string]TelegramFormatter
+	// Transcoder compresses and splits the files exceeding the upload limit
+	Transcoder Transcoder
 }
 
-func optionsFromEnv() *Options {
-	telegramTimeout, _ := strconv.Atoi(os.Getenv("TELEGRAM_TIMEOUT"))
-	return &Options{
-		Channel: os.Getenv("TELEGRAM_CHAN"),
-		Server:  os.Getenv("TELEGRAM_SERVER"),
-		Token:   os.Getenv("TELEGRAM_TOKEN"),
-		Timeout: time.Duration(telegramTimeout) * time.Minute,
+// NewTelegramClient init telegram client
+func NewTelegramClient(opts *Options) (Client, error) {
+	tf, formatters, err := newFormatters(opts)
+	if err != nil {
+		return nil, err
 	}
-}
-
-// NewTelegramClientFromEnv init telegram client from ENV
-func NewTelegramClientFromEnv() (client Client, err error) {
-	opts := optionsFromEnv()
-	client, err = newTelegramClient(
-		opts,
-		&TelegramSenderImpl{},
-		TelegramFormatter{},
-	)
-	return
+	client, err := newTelegramClient(opts, &TelegramSenderImpl{}, tf)
+	if tc, ok := client.(TelegramClient); ok && err == nil {
+		tc.Formatters = formatters
+		client = tc
+	}
+	return client, err
 }
 
 // newTelegramClient init telegram client
@@ -99,63 +279,289 @@ func newTelegramClient(opts *Options, tgs TelegramSender, tf TelegramFormatter)
 		Timeout:        timeout,
 		TelegramSender: tgs,
 		Formatter:      tf,
+		Transcoder:     NewFFmpegTranscoder(),
 	}
 	return result, err
 }
 
-func (o TelegramClient) Send(file finder.File, stars int) (err error) {
-	channelID := o.Opts.Channel
-	if o.Bot == nil || channelID == "" {
-		return nil
+func (o TelegramClient) Send(post Post) (err error) {
+	if o.Bot == nil {
+		return errors.Wrap(ErrNotConfigured, "no bot token")
 	}
-
-	message, err := o.sendVideo(channelID, file, stars)
-	if err != nil && strings.Contains(err.Error(), "Request Entity Too Large") {
-		message, err = o.sendText(channelID, file)
+	channelID, err := o.Opts.chat(post.Destination)
+	if err != nil {
+		return err
+	}
+	if channelID == "" {
+		return errors.Wrapf(ErrNotConfigured, "no chat for destination %q", post.Destination)
 	}
 
+	message, err := o.send(channelID, post)
 	if err != nil {
-		return errors.Wrapf(err, "can't send to telegram for %+v", file.Name)
+		return errors.Wrapf(err, "can't send to telegram for %+v", post.File.Name)
 	}
 
-	log.Printf("[DEBUG] telegram message sent: \n%s", message.Text)
-	//log.Printf("[DEBUG] telegram message sent: \n%s", message.Text, message.Caption)
+	if message != nil {
+		log.Printf("[DEBUG] telegram message sent: \n%s", message.Text)
+	}
 	return nil
 }
 
-func (o TelegramClient) sendText(channelID string, file finder.File) (*tb.Message, error) {
+// send sends the video or applies the fallback policy if it exceeds the upload limit
+func (o TelegramClient) send(channelID string, post Post) (*tb.Message, error) {
+	if err := ValidateCaption(o.caption(post)); err != nil {
+		return nil, err
+	}
+	if len(post.Album) > 0 {
+		return o.sendAlbum(channelID, post)
+	}
+	limit := o.Opts.uploadLimit()
+	if size := fileSize(post.File); limit > 0 && size > limit {
+		log.Printf("[INFO] %s is %d bytes, more than the limit of %d bytes", post.File.Name, size, limit)
+		return o.fallback(channelID, post, &Error{Kind: ErrTooLarge, Err: errors.Errorf("%d bytes, the limit is %d", size, limit)})
+	}
+
+	message, err := o.sendVideo(channelID, post)
+	err = mapError(err)
+	if errors.Is(err, ErrTooLarge) {
+		log.Printf("[INFO] %s is rejected by the server: %v", post.File.Name, err)
+		return o.fallback(channelID, post, err)
+	}
+	return message, err
+}
+
+// fallback sends the post exceeding the upload limit according to Options.Fallback
+func (o TelegramClient) fallback(channelID string, post Post, tooLarge error) (*tb.Message, error) {
+	limit := o.Opts.uploadLimit()
+	duration := 0
+	if post.File.Info != nil {
+		duration = post.File.Info.Duration
+	}
+
+	switch o.Opts.Fallback {
+	case FallbackFail:
+		return nil, tooLarge
+	case FallbackLink:
+		if o.Opts.LinkURL == "" {
+			return nil, errors.Wrap(tooLarge, "no link URL")
+		}
+		caption, mode := o.caption(post)
+		message, err := o.sendFormatted(channelID, caption+"\n\n"+linkText(o.Opts.LinkURL, post.File, mode), mode)
+		return message, mapError(err)
+	case FallbackCompress:
+		if limit == 0 {
+			return nil, tooLarge
+		}
+		path, err := o.Transcoder.Compress(post.File.Path, limit, duration)
+		if err != nil {
+			return nil, errors.Wrap(tooLarge, err.Error())
+		}
+		defer os.Remove(path)
+		compressed := post
+		compressed.File.Path, compressed.File.Size = path, fileSize(finder.File{Path: path})
+		if compressed.File.Size > limit {
+			return nil, errors.Wrapf(tooLarge, "compressed to %d bytes", compressed.File.Size)
+		}
+		message, err := o.sendVideo(channelID, compressed)
+		return message, mapError(err)
+	case FallbackSplit:
+		if limit == 0 {
+			return nil, tooLarge
+		}
+		parts, err := o.Transcoder.Split(post.File.Path, limit, fileSize(post.File), duration)
+		if err != nil {
+			return nil, errors.Wrap(tooLarge, err.Error())
+		}
+		defer removeParts(parts)
+		message, err := o.sendParts(channelID, post, parts)
+		return message, mapError(err)
+	}
+	message, err := o.sendText(channelID, post)
+	return message, mapError(err)
+}
+
+// sendParts sends the parts of the video as an album with the caption of the post
+func (o TelegramClient) sendParts(channelID string, post Post, parts []string) (*tb.Message, error) {
+	if len(parts) > finder.MaxAlbumSize {
+		return nil, errors.Errorf("%d parts don't fit into an album", len(parts))
+	}
+	ext := filepath.Ext(post.File.Name)
+	videos := make([]*tb.Video, 0, len(parts))
+	for i, part := range parts {
+		file := post.File
+		file.Path = part
+		file.Name = fmt.Sprintf("%s.part%d%s", strings.TrimSuffix(file.Name, ext), i+1, ext)
+		video := newVideo(file, "")
+		// the duration of a part is unknown
+		video.Duration = 0
+		videos = append(videos, &video)
+	}
+	return o.sendMedia(channelID, post, videos)
+}
+
+// sendAlbum sends the file and the album of the post together,
+// the files exceeding the upload limit aren't split or compressed in an album
+func (o TelegramClient) sendAlbum(channelID string, post Post) (*tb.Message, error) {
+	files := append([]finder.File{post.File}, post.Album...)
+	if len(files) > finder.MaxAlbumSize {
+		return nil, errors.Errorf("%d files don't fit into an album", len(files))
+	}
+	limit := o.Opts.uploadLimit()
+	videos := make([]*tb.Video, 0, len(files))
+	for _, file := range files {
+		if size := fileSize(file); limit > 0 && size > limit {
+			return nil, &Error{Kind: ErrTooLarge, Err: errors.Errorf("%s is %d bytes, the limit is %d", file.Name, size, limit)}
+		}
+		video := newVideo(file, "")
+		videos = append(videos, &video)
+	}
+	message, err := o.sendMedia(channelID, post, videos)
+	return message, mapError(err)
+}
+
+// sendMedia sends the videos as an album with the caption of the post on the first one
+func (o TelegramClient) sendMedia(channelID string, post Post, videos []*tb.Video) (*tb.Message, error) {
+	caption, mode := o.caption(post)
+	caption, overflow := fitCaption(caption, MaxCaptionLength, o.Opts.CaptionOverflow, mode)
+	videos[0].Caption = caption
+
+	opts := &tb.SendOptions{ParseMode: mode}
+	rcp := recipient{chatID: channelID}
+	if post.Stars > 0 {
+		album := make(tb.PaidAlbum, 0, len(videos))
+		for _, v := range videos {
+			album = append(album, v)
+		}
+		message, err := o.TelegramSender.SendPaidAlbum(album, o.Bot, rcp, opts, post.Stars)
+		if err == nil {
+			o.reply(channelID, message, overflow, mode)
+		}
+		return message, err
+	}
+	album := make(tb.Album, 0, len(videos))
+	for _, v := range videos {
+		album = append(album, v)
+	}
+	messages, err := o.TelegramSender.SendAlbum(album, o.Bot, rcp, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, ErrNoMessages
+	}
+	o.reply(channelID, &messages[0], overflow, mode)
+	return &messages[0], nil
+}
+
+// linkText returns the link to the file at the base URL in the parse mode
+func linkText(baseURL string, file finder.File, mode tb.ParseMode) string {
+	link := strings.TrimSuffix(baseURL, "/") + "/" + url.PathEscape(file.Name)
+	if mode == tb.ModeMarkdownV2 {
+		// only ")" and "\\" must be escaped inside the URL
+		link = strings.NewReplacer(`\`, `\\`, ")", `\)`).Replace(link)
+		return fmt.Sprintf("[%s](%s)", EscapeCaption(file.Name, mode), link)
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link), html.EscapeString(file.Name))
+}
+
+// fileSize returns the size of the file, it is read from the disk if unknown
+func fileSize(file finder.File) int64 {
+	if file.Size > 0 {
+		return file.Size
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+func (o TelegramClient) sendText(channelID string, post Post) (*tb.Message, error) {
+	caption, mode := o.caption(post)
+	return o.sendFormatted(channelID, caption, mode)
+}
+
+func (o TelegramClient) sendFormatted(channelID, text string, mode tb.ParseMode) (*tb.Message, error) {
+	text, overflow := fitCaption(text, MaxTextLength, o.Opts.CaptionOverflow, mode)
 	message, err := o.Bot.Send(
 		recipient{chatID: channelID},
-		o.Formatter.Format(file),
-		tb.ModeHTML,
+		text,
+		mode,
 		tb.NoPreview,
 	)
-
+	if err == nil {
+		o.reply(channelID, message, overflow, mode)
+	}
 	return message, err
 }
 
-func (o TelegramClient) sendVideo(channelID string, file finder.File, stars int) (*tb.Message, error) {
+func (o TelegramClient) sendVideo(channelID string, post Post) (*tb.Message, error) {
 	// TODO defer os.Remove(file.Path)
+	stars := post.Stars
+	caption, mode := o.caption(post)
+	caption, overflow := fitCaption(caption, MaxCaptionLength, o.Opts.CaptionOverflow, mode)
+	attachment := newVideo(post.File, caption)
+
+	var message *tb.Message
+	var err error
+	if stars > 0 {
+		message, err = o.TelegramSender.SendPaid(attachment, o.Bot, recipient{chatID: channelID}, &tb.SendOptions{ParseMode: mode}, stars)
+	} else {
+		message, err = o.TelegramSender.Send(attachment, o.Bot, recipient{chatID: channelID}, &tb.SendOptions{ParseMode: mode})
+	}
+	if err == nil {
+		o.reply(channelID, message, overflow, mode)
+	}
+	return message, err
+}
 
-	attachment := tb.Video{
-		File:     tb.FromDisk(file.Path),
-		Width:    file.Info.Width,
-		Height:   file.Info.Height,
-		Duration: file.Info.Duration,
+// reply sends the overflow of the caption as text messages replying to the message.
+// The video is already sent, so a failure is logged only.
+func (o TelegramClient) reply(channelID string, message *tb.Message, overflow string, mode tb.ParseMode) {
+	for _, text := range splitText(overflow, MaxTextLength, mode) {
+		_, err := o.Bot.Send(recipient{chatID: channelID}, text, &tb.SendOptions{
+			ParseMode:             mode,
+			ReplyTo:               message,
+			DisableWebPagePreview: true,
+		})
+		if err != nil {
+			log.Printf("[WARN] can't send the rest of the caption: %v", err)
+			return
+		}
+	}
+}
 
+// newVideo returns the attachment sent for the file
+func newVideo(file finder.File, caption string) tb.Video {
+	video := tb.Video{
+		File:      tb.FromDisk(file.Path),
+		FileName:  file.Name,
 		Streaming: true,
-		Caption:   o.getMessageHTML(file),
+		Caption:   caption,
 	}
-	if stars > 0 {
-		return o.TelegramSender.SendPaid(attachment, o.Bot, recipient{chatID: channelID}, &tb.SendOptions{ParseMode: tb.ModeHTML}, stars)
-	} else {
-		return o.TelegramSender.Send(attachment, o.Bot, recipient{chatID: channelID}, &tb.SendOptions{ParseMode: tb.ModeHTML})
+	if file.Info != nil {
+		video.Width = file.Info.Width
+		video.Height = file.Info.Height
+		video.Duration = file.Info.Duration
+		// only MP4 can be played while downloading
+		video.Streaming = file.Info.Container == "" || strings.Contains(file.Info.Container, "mp4")
 	}
+	return video
+}
+
+// caption returns the caption of the post and its parse mode
+func (o TelegramClient) caption(post Post) (string, tb.ParseMode) {
+	return postCaption(post, o.Formatter, o.Formatters)
 }
 
-// getMessageHTML generates HTML message from provided media.Info
-func (o TelegramClient) getMessageHTML(file finder.File) string {
-	return o.Formatter.Format(file)
+// CheckDestination validates the destination of a post
+func (o TelegramClient) CheckDestination(destination string) error {
+	return o.Opts.CheckDestination(destination)
+}
+
+// CheckCaption validates the custom caption of a post to the destination
+func (o TelegramClient) CheckCaption(destination, caption string) error {
+	return ValidateCaption(o.caption(Post{Destination: destination, Caption: caption}))
 }
 
 type recipient struct {
@@ -182,3 +588,13 @@ func (tg *TelegramSenderImpl) Send(attachment tb.Video, bot *tb.Bot, rcp tb.Reci
 func (tg *TelegramSenderImpl) SendPaid(attachment tb.Video, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions, stars int) (*tb.Message, error) {
 	return bot.SendPaid(rcp, stars, tb.PaidAlbum{&attachment}, opts)
 }
+
+// SendAlbum sends an album to Telegram
+func (tg *TelegramSenderImpl) SendAlbum(album tb.Album, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions) ([]tb.Message, error) {
+	return bot.SendAlbum(rcp, album, opts)
+}
+
+// SendPaidAlbum sends a paid album to Telegram
+func (tg *TelegramSenderImpl) SendPaidAlbum(album tb.PaidAlbum, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions, stars int) (*tb.Message, error) {
+	return bot.SendPaid(rcp, stars, album, opts)
+}
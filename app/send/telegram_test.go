@@ -1,6 +1,8 @@
 package send
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -13,11 +15,15 @@ import (
 // mockSender implements TelegramSender и просто запоминает, что ему прислали
 type mockSender struct {
 	VideoSent     *tb.Video
+	SendOptions   *tb.SendOptions
 	PaidAlbumSent *tb.PaidAlbum
+	AlbumSent     tb.Album
+	Stars         int
 }
 
 func (m *mockSender) Send(v tb.Video, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions) (*tb.Message, error) {
 	m.VideoSent = &v
+	m.SendOptions = opts
 	return &tb.Message{Text: "ok"}, nil
 }
 
@@ -27,6 +33,17 @@ func (m *mockSender) SendPaid(v tb.Video, bot *tb.Bot, rcp tb.Recipient, opts *t
 	return &tb.Message{Text: "ok"}, nil
 }
 
+func (m *mockSender) SendAlbum(a tb.Album, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions) ([]tb.Message, error) {
+	m.AlbumSent = a
+	return []tb.Message{{Text: "ok"}}, nil
+}
+
+func (m *mockSender) SendPaidAlbum(a tb.PaidAlbum, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions, stars int) (*tb.Message, error) {
+	m.PaidAlbumSent = &a
+	m.Stars = stars
+	return &tb.Message{Text: "ok"}, nil
+}
+
 func TestSend_SuccessVideo(t *testing.T) {
 	sender := &mockSender{}
 	client := TelegramClient{
@@ -48,51 +65,37 @@ func TestSend_SuccessVideo(t *testing.T) {
 		},
 	}
 
-	require.NoError(t, client.Send(file, 1000))
+	require.NoError(t, client.Send(Post{File: file, Stars: 1000}))
 	require.NotNil(t, sender.VideoSent, "должен был вызваться mockSender.Send")
 	require.Equal(t, 640, sender.VideoSent.Width)
 	require.Equal(t, 7, sender.VideoSent.Duration)
+	require.True(t, sender.VideoSent.Streaming)
+
+	file.Info.Container = "matroska,webm"
+	require.NoError(t, client.Send(Post{File: file}))
+	require.False(t, sender.VideoSent.Streaming, "only MP4 is streamed")
 }
 
-func TestSend_SkipIfBotNil(t *testing.T) {
-	// если Bot==nil, Send просто возвращает nil без ошибок
+func TestSend_FailIfBotNil(t *testing.T) {
+	// without a token nothing can be sent, the misconfiguration is reported
 	client := TelegramClient{
 		Opts: &Options{Channel: "@x"},
 		Bot:  nil,
 	}
-	require.NoError(t, client.Send(finder.File{Name: "any"}, 1000))
+	require.ErrorIs(t, client.Send(Post{File: finder.File{Name: "any"}, Stars: 1000}), ErrNotConfigured)
 }
 
-func TestSend_SkipIfChannelEmpty(t *testing.T) {
-	// если Channel=="", тоже молча ноль
+func TestSend_FailIfChannelEmpty(t *testing.T) {
 	client := TelegramClient{
 		Opts: &Options{Channel: ""},
 		Bot:  &tb.Bot{},
 	}
-	require.NoError(t, client.Send(finder.File{Name: "any"}, 1000))
+	require.ErrorIs(t, client.Send(Post{File: finder.File{Name: "any"}, Stars: 1000}), ErrNotConfigured)
 }
 
-func TestOptionsFromEnv(t *testing.T) {
-	t.Setenv("TELEGRAM_CHAN", "@foo")
-	t.Setenv("TELEGRAM_SERVER", "https://t.me")
-	t.Setenv("TELEGRAM_TOKEN", "tok")
-	t.Setenv("TELEGRAM_TIMEOUT", "5")
-
-	opts := optionsFromEnv()
-	require.Equal(t, "@foo", opts.Channel)
-	require.Equal(t, "https://t.me", opts.Server)
-	require.Equal(t, "tok", opts.Token)
-	require.Equal(t, 5*time.Minute, opts.Timeout)
-}
-
-func TestNewTelegramClientFromEnv_NoToken(t *testing.T) {
-	// когда переменная TELEGRAM_TOKEN пустая, бот не инициализируется (Bot=nil)
-	t.Setenv("TELEGRAM_CHAN", "chan")
-	t.Setenv("TELEGRAM_SERVER", "srv")
-	t.Setenv("TELEGRAM_TOKEN", "")
-	t.Setenv("TELEGRAM_TIMEOUT", "2")
-
-	cl, err := NewTelegramClientFromEnv()
+func TestNewTelegramClient_NoToken(t *testing.T) {
+	// без токена бот не инициализируется (Bot=nil)
+	cl, err := NewTelegramClient(&Options{Channel: "@chan", Server: "srv", Timeout: 2 * time.Minute})
 	require.NoError(t, err)
 
 	tc, ok := cl.(TelegramClient)
@@ -116,3 +119,179 @@ func TestRecipient_Formatting(t *testing.T) {
 		require.Equal(t, tt.want, r.Recipient(), "raw=%q", tt.raw)
 	}
 }
+
+// fakeTranscoder records the calls and returns the prepared files
+type fakeTranscoder struct {
+	compressed string
+	parts      []string
+	limit      int64
+}
+
+func (f *fakeTranscoder) Compress(path string, maxSize int64, duration int) (string, error) {
+	f.limit = maxSize
+	return f.compressed, nil
+}
+
+func (f *fakeTranscoder) Split(path string, maxSize, size int64, duration int) ([]string, error) {
+	f.limit = maxSize
+	return f.parts, nil
+}
+
+func writeFile(t *testing.T, name string, size int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0o600))
+	return path
+}
+
+func TestSend_TooLarge(t *testing.T) {
+	big := finder.File{Name: "big.mp4", Path: writeFile(t, "big.mp4", 100), Info: &finder.VideoInfo{Width: 640, Duration: 10}}
+
+	t.Run("fail", func(t *testing.T) {
+		sender := &mockSender{}
+		client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50, Fallback: FallbackFail}, Bot: &tb.Bot{}, TelegramSender: sender}
+		err := client.Send(Post{File: big})
+		require.ErrorIs(t, err, ErrTooLarge)
+		require.Nil(t, sender.VideoSent, "the upload isn't even tried")
+	})
+
+	t.Run("compress", func(t *testing.T) {
+		sender := &mockSender{}
+		tr := &fakeTranscoder{compressed: writeFile(t, "small.mp4", 40)}
+		client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50, Fallback: FallbackCompress}, Bot: &tb.Bot{}, TelegramSender: sender, Transcoder: tr}
+		require.NoError(t, client.Send(Post{File: big}))
+		require.NotNil(t, sender.VideoSent)
+		require.Equal(t, tr.compressed, sender.VideoSent.File.FileLocal)
+		require.Equal(t, "big.mp4", sender.VideoSent.FileName)
+		require.Equal(t, int64(50), tr.limit)
+		require.NoFileExists(t, tr.compressed, "the compressed file is removed")
+	})
+
+	t.Run("compress not enough", func(t *testing.T) {
+		tr := &fakeTranscoder{compressed: writeFile(t, "still-big.mp4", 60)}
+		client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50, Fallback: FallbackCompress}, Bot: &tb.Bot{}, TelegramSender: &mockSender{}, Transcoder: tr}
+		require.ErrorIs(t, client.Send(Post{File: big}), ErrTooLarge)
+	})
+
+	t.Run("split", func(t *testing.T) {
+		sender := &mockSender{}
+		tr := &fakeTranscoder{parts: []string{writeFile(t, "part000.mp4", 40), writeFile(t, "part001.mp4", 40)}}
+		client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50, Fallback: FallbackSplit}, Bot: &tb.Bot{}, TelegramSender: sender, Transcoder: tr}
+
+		require.NoError(t, client.Send(Post{File: big}))
+		require.Len(t, sender.AlbumSent, 2)
+		first := sender.AlbumSent[0].(*tb.Video)
+		require.Equal(t, "big.part1.mp4", first.FileName)
+		require.Equal(t, "big", first.Caption)
+		require.Empty(t, sender.AlbumSent[1].(*tb.Video).Caption)
+
+		require.NoError(t, client.Send(Post{File: big, Stars: 5}))
+		require.NotNil(t, sender.PaidAlbumSent)
+		require.Len(t, *sender.PaidAlbumSent, 2)
+		require.Equal(t, 5, sender.Stars)
+	})
+}
+
+func TestSend_Album(t *testing.T) {
+	a := finder.File{Name: "a.mp4", Path: writeFile(t, "a.mp4", 40)}
+	b := finder.File{Name: "b.mp4", Path: writeFile(t, "b.mp4", 40)}
+	sender := &mockSender{}
+	client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50}, Bot: &tb.Bot{}, TelegramSender: sender}
+
+	require.NoError(t, client.Send(Post{File: a, Album: []finder.File{b}}))
+	require.Len(t, sender.AlbumSent, 2)
+	require.Equal(t, "a", sender.AlbumSent[0].(*tb.Video).Caption)
+	require.Equal(t, "b.mp4", sender.AlbumSent[1].(*tb.Video).FileName)
+	require.Empty(t, sender.AlbumSent[1].(*tb.Video).Caption)
+
+	require.NoError(t, client.Send(Post{File: a, Album: []finder.File{b}, Stars: 3}))
+	require.Len(t, *sender.PaidAlbumSent, 2)
+	require.Equal(t, 3, sender.Stars)
+
+	big := finder.File{Name: "big.mp4", Path: writeFile(t, "big.mp4", 100)}
+	require.ErrorIs(t, client.Send(Post{File: a, Album: []finder.File{big}}), ErrTooLarge)
+}
+
+func TestSend_AlbumWithoutMessages(t *testing.T) {
+	a := finder.File{Name: "a.mp4", Path: writeFile(t, "a.mp4", 40)}
+	b := finder.File{Name: "b.mp4", Path: writeFile(t, "b.mp4", 40)}
+	client := TelegramClient{Opts: &Options{Channel: "@x", MaxUploadSize: 50}, Bot: &tb.Bot{}, TelegramSender: &emptyAlbumSender{}}
+	require.ErrorIs(t, client.Send(Post{File: a, Album: []finder.File{b}}), ErrNoMessages)
+}
+
+func TestSend_MapsErrors(t *testing.T) {
+	sender := &failingSender{err: tb.ErrChatNotFound}
+	client := TelegramClient{Opts: &Options{Channel: "@x"}, Bot: &tb.Bot{}, TelegramSender: sender}
+	err := client.Send(Post{File: finder.File{Name: "a.mp4", Path: "/tmp/a.mp4"}})
+	require.ErrorIs(t, err, ErrChatNotFound)
+	require.ErrorIs(t, err, tb.ErrChatNotFound)
+}
+
+func TestSend_ParseModeOfDestination(t *testing.T) {
+	opts := &Options{
+		Channel:      "@main",
+		Caption:      "<b>{{.Title}}</b>",
+		Destinations: []Destination{{Name: "md", Chat: "@md", ParseMode: tb.ModeMarkdownV2, Caption: "*{{.Title}}*"}},
+	}
+	tf, formatters, err := newFormatters(opts)
+	require.NoError(t, err)
+	sender := &mockSender{}
+	client := TelegramClient{Opts: opts, Bot: &tb.Bot{}, TelegramSender: sender, Formatter: tf, Formatters: formatters}
+	file := finder.File{Name: "a_b.mp4", Path: "/tmp/a_b.mp4"}
+
+	require.NoError(t, client.Send(Post{File: file}))
+	require.Equal(t, "<b>a_b</b>", sender.VideoSent.Caption)
+	require.Equal(t, tb.ModeHTML, sender.SendOptions.ParseMode)
+
+	require.NoError(t, client.Send(Post{File: file, Destination: "md"}))
+	require.Equal(t, `*a\_b*`, sender.VideoSent.Caption)
+	require.Equal(t, tb.ModeMarkdownV2, sender.SendOptions.ParseMode)
+}
+
+func TestSend_BadCaption(t *testing.T) {
+	sender := &mockSender{}
+	client := TelegramClient{Opts: &Options{Channel: "@x"}, Bot: &tb.Bot{}, TelegramSender: sender}
+	err := client.Send(Post{File: finder.File{Name: "a.mp4", Path: "/tmp/a.mp4"}, Caption: "<div>a</div>"})
+	require.ErrorIs(t, err, ErrBadCaption)
+	require.Nil(t, sender.VideoSent, "the invalid caption is not sent")
+	require.ErrorIs(t, client.CheckCaption("", "fish & chips"), ErrBadCaption)
+	require.NoError(t, client.CheckCaption("", "fish &amp; chips"))
+}
+
+// failingSender fails every upload with err
+type failingSender struct {
+	mockSender
+	err error
+}
+
+func (f *failingSender) Send(v tb.Video, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions) (*tb.Message, error) {
+	return nil, f.err
+}
+
+func TestOptions_UploadLimit(t *testing.T) {
+	require.Equal(t, PublicUploadLimit, (&Options{}).uploadLimit())
+	require.Equal(t, PublicUploadLimit, (&Options{Server: "https://api.telegram.org"}).uploadLimit())
+	require.Equal(t, LocalUploadLimit, (&Options{Server: "http://localhost:8081"}).uploadLimit())
+	require.Equal(t, int64(10), (&Options{Server: "http://localhost:8081", MaxUploadSize: 10}).uploadLimit())
+	require.Zero(t, (&Options{MaxUploadSize: -1}).uploadLimit())
+}
+
+func TestParseFallback(t *testing.T) {
+	f, err := ParseFallback("")
+	require.NoError(t, err)
+	require.Equal(t, FallbackText, f)
+	f, err = ParseFallback("split")
+	require.NoError(t, err)
+	require.Equal(t, FallbackSplit, f)
+	_, err = ParseFallback("zip")
+	require.Error(t, err)
+}
+
+// emptyAlbumSender sends the albums without returning their messages
+type emptyAlbumSender struct {
+	mockSender
+}
+
+func (e *emptyAlbumSender) SendAlbum(a tb.Album, bot *tb.Bot, rcp tb.Recipient, opts *tb.SendOptions) ([]tb.Message, error) {
+	return nil, nil
+}
@@ -0,0 +1,136 @@
+package telegramtest
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	htmlTagRe    = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)[^<>]*>`)
+	htmlEntityRe = regexp.MustCompile(`&[^;\s]*;?`)
+	// htmlTags are the tags supported in the HTML parse mode
+	htmlTags = map[string]bool{
+		"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+		"s": true, "strike": true, "del": true, "span": true, "tg-spoiler": true, "tg-emoji": true,
+		"a": true, "code": true, "pre": true, "blockquote": true,
+	}
+	// markdownV2Reserved must be escaped in MarkdownV2 outside of the entities
+	markdownV2Reserved = ">#+-=|{}.!()[]"
+)
+
+// checkText validates the formatting and the length of the text as Telegram does
+func checkText(text, parseMode string, limit int, tooLong string) *Failure {
+	plain := text
+	switch parseMode {
+	case "", "Markdown":
+	case "HTML":
+		var err error
+		if plain, err = parseHTML(text); err != nil {
+			return badRequest("can't parse entities: " + err.Error())
+		}
+	case "MarkdownV2":
+		if err := checkMarkdownV2(text); err != nil {
+			return badRequest("can't parse entities: " + err.Error())
+		}
+	default:
+		return badRequest("unsupported parse_mode")
+	}
+	// the limits are in UTF-16 code units of the text without formatting
+	if len(utf16.Encode([]rune(plain))) > limit {
+		return badRequest(tooLong)
+	}
+	return nil
+}
+
+// parseHTML checks the tags and the entities and returns the plain text
+func parseHTML(text string) (string, error) {
+	var stack []string
+	for _, m := range htmlTagRe.FindAllStringSubmatchIndex(text, -1) {
+		name := strings.ToLower(text[m[4]:m[5]])
+		if m[3] == m[2] {
+			if !htmlTags[name] {
+				return "", fmt.Errorf("Unsupported start tag %q at byte offset %d", name, m[0])
+			}
+			stack = append(stack, name)
+			continue
+		}
+		if len(stack) == 0 || stack[len(stack)-1] != name {
+			return "", fmt.Errorf("Unexpected end tag at byte offset %d", m[0])
+		}
+		stack = stack[:len(stack)-1]
+	}
+	if len(stack) > 0 {
+		return "", fmt.Errorf("Can't find end tag corresponding to start tag %q", stack[len(stack)-1])
+	}
+
+	plain := htmlTagRe.ReplaceAllString(text, "")
+	if i := strings.IndexAny(plain, "<>"); i >= 0 {
+		return "", fmt.Errorf("Unsupported start tag at byte offset %d", i)
+	}
+	for _, entity := range htmlEntityRe.FindAllString(plain, -1) {
+		if html.UnescapeString(entity) == entity {
+			return "", fmt.Errorf("Unsupported HTML entity %q", entity)
+		}
+	}
+	return html.UnescapeString(plain), nil
+}
+
+// checkMarkdownV2 checks the escaping of the reserved characters and the closing of the entities
+func checkMarkdownV2(text string) error {
+	open := map[string]int{}
+	link := 0 // 1 inside [text], 2 inside (url)
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\':
+			i++
+		case c == '`':
+			end := strings.IndexByte(text[i+1:], '`')
+			if end < 0 {
+				return fmt.Errorf("Can't find end of Code entity at byte offset %d", i)
+			}
+			i += end + 1
+		case c == '|' && i+1 < len(text) && text[i+1] == '|':
+			toggle(open, "||", i)
+			i++
+		case c == '_' && i+1 < len(text) && text[i+1] == '_':
+			toggle(open, "__", i)
+			i++
+		case c == '*' || c == '_' || c == '~':
+			toggle(open, string(c), i)
+		case c == '[' && link == 0:
+			link = 1
+		case c == ']' && link == 1 && i+1 < len(text) && text[i+1] == '(':
+			link = 2
+			i++
+		case c == ')' && link == 2:
+			link = 0
+		case link == 2:
+		case strings.IndexByte(markdownV2Reserved, c) >= 0:
+			return fmt.Errorf("Character '%c' is reserved and must be escaped with the preceding '\\'", c)
+		}
+	}
+	if link != 0 {
+		return fmt.Errorf("Can't find end of a URL")
+	}
+	for marker, offset := range open {
+		return fmt.Errorf("Can't find end of %s entity at byte offset %d", markdownV2Entities[marker], offset)
+	}
+	return nil
+}
+
+var markdownV2Entities = map[string]string{
+	"*": "Bold", "_": "Italic", "__": "Underline", "~": "Strikethrough", "||": "Spoiler",
+}
+
+// toggle opens the entity or closes the opened one
+func toggle(open map[string]int, marker string, offset int) {
+	if _, ok := open[marker]; ok {
+		delete(open, marker)
+		return
+	}
+	open[marker] = offset
+}
@@ -0,0 +1,382 @@
+// Package telegramtest provides an in-process fake of the Telegram Bot API for tests.
+package telegramtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is the bot token accepted by the server created with NewServer
+const Token = "123456:test-token"
+
+const (
+	maxCaptionLength = 1024
+	maxTextLength    = 4096
+)
+
+// Server is a fake Bot API recording the requests.
+// It supports getMe, sendMessage, sendVideo, sendPaidMedia and sendMediaGroup.
+type Server struct {
+	*httptest.Server
+	Token string
+	// MaxUploadSize rejects bigger uploaded files with 413 like the public Bot API, unlimited if 0
+	MaxUploadSize int64
+	// Chats are the known chats, any chat is accepted if empty
+	Chats []string
+
+	mu       sync.Mutex
+	requests []Request
+	failures map[string][]Failure
+	lastID   int
+}
+
+// Request is a recorded call of a Bot API method
+type Request struct {
+	Method string
+	// Params are the form fields or the JSON fields, nested values are JSON encoded
+	Params map[string]string
+	// Files are the uploaded files by the form field name
+	Files map[string]File
+}
+
+// File is an uploaded file
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Failure is an error response injected with FailNext
+type Failure struct {
+	Code        int
+	Description string
+	// RetryAfter is sent in the parameters of 429 responses
+	RetryAfter int
+}
+
+// TooManyRequests is the flood control error
+func TooManyRequests(retryAfter int) Failure {
+	return Failure{
+		Code:        http.StatusTooManyRequests,
+		Description: fmt.Sprintf("Too Many Requests: retry after %d", retryAfter),
+		RetryAfter:  retryAfter,
+	}
+}
+
+// EntityTooLarge is the error of an upload exceeding the server limit
+func EntityTooLarge() Failure {
+	return Failure{Code: http.StatusRequestEntityTooLarge, Description: "Request Entity Too Large"}
+}
+
+// ChatNotFound is the error of an unknown chat or a chat without the bot
+func ChatNotFound() Failure {
+	return Failure{Code: http.StatusBadRequest, Description: "Bad Request: chat not found"}
+}
+
+// NewServer starts the fake Bot API, the caller should call Close when finished
+func NewServer() *Server {
+	s := &Server{Token: Token, failures: make(map[string][]Failure)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// FailNext makes the next calls of the method fail in order
+func (s *Server) FailNext(method string, failures ...Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failures...)
+}
+
+// Requests returns the recorded requests of the methods, all requests if no methods are given
+func (s *Server) Requests(methods ...string) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []Request
+	for _, req := range s.requests {
+		if len(methods) == 0 || slices.Contains(methods, req.Method) {
+			result = append(result, req)
+		}
+	}
+	return result
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	token, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok || !strings.HasPrefix(r.URL.Path, "/bot") {
+		writeFailure(w, Failure{Code: http.StatusNotFound, Description: "Not Found"})
+		return
+	}
+	if token != s.Token {
+		writeFailure(w, Failure{Code: http.StatusUnauthorized, Description: "Unauthorized"})
+		return
+	}
+
+	// the whole body is read before responding, the client doesn't see a reset connection
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeFailure(w, Failure{Code: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+		return
+	}
+	req, err := parseRequest(method, r.Header.Get("Content-Type"), body)
+	if err != nil {
+		writeFailure(w, Failure{Code: http.StatusBadRequest, Description: "Bad Request: " + err.Error()})
+		return
+	}
+	for _, file := range req.Files {
+		if s.MaxUploadSize > 0 && int64(len(file.Data)) > s.MaxUploadSize {
+			writeFailure(w, EntityTooLarge())
+			return
+		}
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	var failure *Failure
+	if failures := s.failures[method]; len(failures) > 0 {
+		failure, s.failures[method] = &failures[0], failures[1:]
+	}
+	s.mu.Unlock()
+	if failure != nil {
+		writeFailure(w, *failure)
+		return
+	}
+
+	result, f := s.call(req)
+	if f != nil {
+		writeFailure(w, *f)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "result": result})
+}
+
+// call validates the request and returns the result of the method
+func (s *Server) call(req Request) (any, *Failure) {
+	if req.Method == "getMe" {
+		return map[string]any{"id": 123456, "is_bot": true, "first_name": "Test", "username": "test_bot"}, nil
+	}
+
+	p := req.Params
+	chat, f := s.chat(p["chat_id"])
+	if f != nil {
+		return nil, f
+	}
+	switch req.Method {
+	case "sendMessage":
+		if p["text"] == "" {
+			return nil, badRequest("message text is empty")
+		}
+		if f := checkText(p["text"], p["parse_mode"], maxTextLength, "message is too long"); f != nil {
+			return nil, f
+		}
+		msg := s.message(chat)
+		msg["text"] = p["text"]
+		return msg, nil
+	case "sendVideo":
+		video, f := s.video(req, "video")
+		if f != nil {
+			return nil, f
+		}
+		if f := checkText(p["caption"], p["parse_mode"], maxCaptionLength, "message caption is too long"); f != nil {
+			return nil, f
+		}
+		msg := s.message(chat)
+		msg["video"] = video
+		if p["caption"] != "" {
+			msg["caption"] = p["caption"]
+		}
+		return msg, nil
+	case "sendPaidMedia":
+		stars, err := strconv.Atoi(p["star_count"])
+		if err != nil || stars <= 0 {
+			return nil, badRequest("invalid star_count")
+		}
+		media, f := s.media(req)
+		if f != nil {
+			return nil, f
+		}
+		if f := checkText(p["caption"], p["parse_mode"], maxCaptionLength, "message caption is too long"); f != nil {
+			return nil, f
+		}
+		var paid []any
+		for _, m := range media {
+			paid = append(paid, map[string]any{"type": "video", "video": m})
+		}
+		msg := s.message(chat)
+		msg["paid_media"] = map[string]any{"star_count": stars, "paid_media": paid}
+		if p["caption"] != "" {
+			msg["caption"] = p["caption"]
+		}
+		return msg, nil
+	case "sendMediaGroup":
+		media, f := s.media(req)
+		if f != nil {
+			return nil, f
+		}
+		var messages []any
+		for _, m := range media {
+			msg := s.message(chat)
+			msg["video"] = m
+			messages = append(messages, msg)
+		}
+		return messages, nil
+	}
+	return nil, &Failure{Code: http.StatusNotFound, Description: "Not Found: method not found"}
+}
+
+// chat returns the chat of the chat_id parameter
+func (s *Server) chat(chatID string) (map[string]any, *Failure) {
+	if chatID == "" {
+		return nil, badRequest("chat_id is empty")
+	}
+	if len(s.Chats) > 0 && !slices.Contains(s.Chats, chatID) {
+		f := ChatNotFound()
+		return nil, &f
+	}
+	chat := map[string]any{"type": "channel"}
+	if id, err := strconv.ParseInt(chatID, 10, 64); err == nil {
+		chat["id"] = id
+	} else {
+		chat["id"] = -1001000000000 - int64(len(chatID))
+		chat["username"] = strings.TrimPrefix(chatID, "@")
+	}
+	return chat, nil
+}
+
+func (s *Server) message(chat map[string]any) map[string]any {
+	s.mu.Lock()
+	s.lastID++
+	id := s.lastID
+	s.mu.Unlock()
+	return map[string]any{"message_id": id, "date": time.Now().Unix(), "chat": chat}
+}
+
+// video returns the video of the form field, the field is a file or a file ID
+func (s *Server) video(req Request, field string) (map[string]any, *Failure) {
+	video := map[string]any{
+		"width":    atoi(req.Params["width"]),
+		"height":   atoi(req.Params["height"]),
+		"duration": atoi(req.Params["duration"]),
+	}
+	if file, ok := req.Files[field]; ok {
+		video["file_id"] = "file-" + file.Name
+		video["file_unique_id"] = "unique-" + file.Name
+		video["file_name"] = file.Name
+		video["file_size"] = len(file.Data)
+		return video, nil
+	}
+	if id := req.Params[field]; id != "" {
+		video["file_id"] = id
+		video["file_unique_id"] = "unique-" + id
+		return video, nil
+	}
+	return nil, badRequest("there is no " + field + " in the request")
+}
+
+// media returns the videos of the media parameter with attach:// references
+func (s *Server) media(req Request) ([]map[string]any, *Failure) {
+	var inputs []struct {
+		Type     string `json:"type"`
+		Media    string `json:"media"`
+		Width    int    `json:"width"`
+		Height   int    `json:"height"`
+		Duration int    `json:"duration"`
+	}
+	if err := json.Unmarshal([]byte(req.Params["media"]), &inputs); err != nil || len(inputs) == 0 {
+		return nil, badRequest("invalid media")
+	}
+	var result []map[string]any
+	for _, in := range inputs {
+		field, attached := strings.CutPrefix(in.Media, "attach://")
+		params := map[string]string{
+			"width":    strconv.Itoa(in.Width),
+			"height":   strconv.Itoa(in.Height),
+			"duration": strconv.Itoa(in.Duration),
+		}
+		if !attached {
+			field, params[field] = "media", in.Media
+		}
+		video, f := s.video(Request{Params: params, Files: req.Files}, field)
+		if f != nil {
+			return nil, f
+		}
+		result = append(result, video)
+	}
+	return result, nil
+}
+
+// parseRequest reads the JSON or multipart parameters
+func parseRequest(method, contentType string, body []byte) (Request, error) {
+	req := Request{Method: method, Params: make(map[string]string), Files: make(map[string]File)}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "multipart/form-data" {
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return req, nil
+			}
+			if err != nil {
+				return req, err
+			}
+			data, err := io.ReadAll(part)
+			if err != nil {
+				return req, err
+			}
+			// a part with an empty file name is a file too
+			_, disposition, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			if name, isFile := disposition["filename"]; isFile {
+				req.Files[part.FormName()] = File{Name: name, Data: data}
+				continue
+			}
+			req.Params[part.FormName()] = string(data)
+		}
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal(body, &values); err != nil {
+		return req, err
+	}
+	for name, v := range values {
+		if s, ok := v.(string); ok {
+			req.Params[name] = s
+			continue
+		}
+		data, _ := json.Marshal(v)
+		req.Params[name] = string(data)
+	}
+	return req, nil
+}
+
+func writeFailure(w http.ResponseWriter, f Failure) {
+	resp := map[string]any{"ok": false, "error_code": f.Code, "description": f.Description}
+	if f.RetryAfter > 0 {
+		resp["parameters"] = map[string]any{"retry_after": f.RetryAfter}
+	}
+	writeJSON(w, f.Code, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func badRequest(description string) *Failure {
+	return &Failure{Code: http.StatusBadRequest, Description: "Bad Request: " + description}
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,139 @@
+package telegramtest
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tb "gopkg.in/telebot.v4"
+)
+
+func newBot(t *testing.T) (*Server, *tb.Bot) {
+	t.Helper()
+	s := NewServer()
+	t.Cleanup(s.Close)
+	bot, err := tb.NewBot(tb.Settings{URL: s.URL, Token: Token, Client: &http.Client{}})
+	require.NoError(t, err)
+	return s, bot
+}
+
+func videoFile(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte("video data"), 0o600))
+	return path
+}
+
+func TestServer_GetMe(t *testing.T) {
+	s, bot := newBot(t)
+	assert.Equal(t, "test_bot", bot.Me.Username)
+	require.Len(t, s.Requests("getMe"), 1)
+
+	_, err := tb.NewBot(tb.Settings{URL: s.URL, Token: "wrong:token"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unauthorized")
+}
+
+func TestServer_SendVideo(t *testing.T) {
+	s, bot := newBot(t)
+	video := &tb.Video{File: tb.FromDisk(videoFile(t, "a.mp4")), FileName: "a.mp4", Width: 640, Height: 360, Duration: 5, Streaming: true, Caption: "<b>A</b>"}
+	msg, err := bot.Send(tb.ChatID(-100123), video, tb.ModeHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "<b>A</b>", msg.Caption)
+	require.NotNil(t, msg.Video)
+	assert.Equal(t, 640, msg.Video.Width)
+
+	reqs := s.Requests("sendVideo")
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "-100123", reqs[0].Params["chat_id"])
+	assert.Equal(t, "HTML", reqs[0].Params["parse_mode"])
+	assert.Equal(t, "true", reqs[0].Params["supports_streaming"])
+	assert.Equal(t, "a.mp4", reqs[0].Files["video"].Name)
+	assert.Equal(t, "video data", string(reqs[0].Files["video"].Data))
+}
+
+func TestServer_SendPaidAndAlbum(t *testing.T) {
+	s, bot := newBot(t)
+	path := videoFile(t, "a.mp4")
+
+	msg, err := bot.SendPaid(tb.ChatID(1), 25, tb.PaidAlbum{&tb.Video{File: tb.FromDisk(path), FileName: "a.mp4", Caption: "paid"}})
+	require.NoError(t, err)
+	assert.Equal(t, "paid", msg.Caption)
+	reqs := s.Requests("sendPaidMedia")
+	require.Len(t, reqs, 1)
+	assert.Equal(t, "25", reqs[0].Params["star_count"])
+	assert.Contains(t, reqs[0].Params["media"], "attach://0")
+	assert.Equal(t, "a.mp4", reqs[0].Files["0"].Name)
+
+	msgs, err := bot.SendAlbum(tb.ChatID(1), tb.Album{&tb.Video{File: tb.FromDisk(path)}, &tb.Video{File: tb.FromDisk(path)}})
+	require.NoError(t, err)
+	assert.Len(t, msgs, 2)
+	assert.Len(t, s.Requests("sendMediaGroup"), 1)
+}
+
+func TestServer_Failures(t *testing.T) {
+	s, bot := newBot(t)
+	s.FailNext("sendMessage", TooManyRequests(7), ChatNotFound())
+
+	_, err := bot.Send(tb.ChatID(1), "text")
+	var flood tb.FloodError
+	require.True(t, errors.As(err, &flood), "%v", err)
+	assert.Equal(t, 7, flood.RetryAfter)
+
+	_, err = bot.Send(tb.ChatID(1), "text")
+	assert.ErrorIs(t, err, tb.ErrChatNotFound)
+
+	_, err = bot.Send(tb.ChatID(1), "text")
+	assert.NoError(t, err)
+	assert.Len(t, s.Requests("sendMessage"), 3)
+
+	s.Chats = []string{"@known"}
+	_, err = bot.Send(tb.ChatID(1), "text")
+	assert.ErrorIs(t, err, tb.ErrChatNotFound)
+}
+
+func TestServer_MaxUploadSize(t *testing.T) {
+	s, bot := newBot(t)
+	s.MaxUploadSize = 100
+	path := filepath.Join(t.TempDir(), "big.mp4")
+	require.NoError(t, os.WriteFile(path, make([]byte, 1000), 0o600))
+
+	_, err := bot.Send(tb.ChatID(1), &tb.Video{File: tb.FromDisk(path)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Request Entity Too Large")
+}
+
+func TestCheckText(t *testing.T) {
+	tests := []struct {
+		text, mode string
+		err        string
+	}{
+		{"plain <b>", "", ""},
+		{"<b>bold</b> &amp; <a href=\"https://t.me\">link</a>", "HTML", ""},
+		{"<foo>x</foo>", "HTML", `Unsupported start tag "foo"`},
+		{"<b>x", "HTML", `Can't find end tag corresponding to start tag "b"`},
+		{"<b>x</i>", "HTML", "Unexpected end tag"},
+		{"a &nbsp b &bogus;", "HTML", `Unsupported HTML entity "&bogus;"`},
+		{`*bold* _it_ \. [link](https://t.me/x) ` + "`a.b`", "MarkdownV2", ""},
+		{"end.", "MarkdownV2", "Character '.' is reserved"},
+		{"*open", "MarkdownV2", "Can't find end of Bold entity"},
+		{"x", "Unknown", "unsupported parse_mode"},
+		{strings.Repeat("я", 101), "", "too long"},
+		{"<b>" + strings.Repeat("a", 100) + "</b>", "HTML", ""},
+	}
+	for _, tt := range tests {
+		f := checkText(tt.text, tt.mode, 100, "too long")
+		if tt.err == "" {
+			assert.Nil(t, f, tt.text)
+			continue
+		}
+		if assert.NotNil(t, f, tt.text) {
+			assert.Contains(t, f.Description, tt.err, tt.text)
+		}
+	}
+}
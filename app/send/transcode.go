@@ -0,0 +1,105 @@
+package send
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/meesooqa/files2tg/app/finder"
+)
+
+// Transcoder makes a video fit the upload limit
+type Transcoder interface {
+	// Compress re-encodes the video into a temporary file of at most maxSize bytes
+	Compress(path string, maxSize int64, duration int) (string, error)
+	// Split cuts the video into temporary parts of at most maxSize bytes each
+	Split(path string, maxSize, size int64, duration int) ([]string, error)
+}
+
+// FFmpegTranscoder compresses and splits the videos with ffmpeg
+type FFmpegTranscoder struct {
+	// AudioBitrate of the compressed video in bits per second
+	AudioBitrate int64
+}
+
+func NewFFmpegTranscoder() *FFmpegTranscoder {
+	return &FFmpegTranscoder{AudioBitrate: 128_000}
+}
+
+func (o *FFmpegTranscoder) Compress(path string, maxSize int64, duration int) (string, error) {
+	if duration <= 0 {
+		return "", errors.Errorf("can't compress %s of unknown duration", path)
+	}
+	// 5% are left for the container
+	bitrate := maxSize*8*95/100/int64(duration) - o.AudioBitrate
+	if bitrate < 100_000 {
+		return "", errors.Errorf("can't compress %s of %ds to %d bytes", path, duration, maxSize)
+	}
+
+	out, err := os.CreateTemp("", "files2tg-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+	b := strconv.FormatInt(bitrate, 10)
+	err = ffmpeg("-y", "-v", "error", "-i", path,
+		"-c:v", "libx264", "-b:v", b, "-maxrate", b, "-bufsize", strconv.FormatInt(2*bitrate, 10),
+		"-c:a", "aac", "-b:a", strconv.FormatInt(o.AudioBitrate, 10),
+		"-movflags", "+faststart", out.Name())
+	if err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
+
+func (o *FFmpegTranscoder) Split(path string, maxSize, size int64, duration int) ([]string, error) {
+	if duration <= 0 || size <= 0 {
+		return nil, errors.Errorf("can't split %s of unknown duration or size", path)
+	}
+	dir, err := os.MkdirTemp("", "files2tg-split-*")
+	if err != nil {
+		return nil, err
+	}
+	// the parts are cut at the key frames, so they are made 10% shorter
+	segment := float64(duration) * float64(maxSize) / float64(size) * 0.9
+	// only the video and the audio are copied, MP4 can't hold the data and subtitle streams of other containers
+	err = ffmpeg("-y", "-v", "error", "-i", path, "-map", "0:v", "-map", "0:a?", "-c", "copy",
+		"-f", "segment", "-segment_time", strconv.FormatFloat(segment, 'f', 1, 64), "-reset_timestamps", "1",
+		filepath.Join(dir, "part%03d.mp4"))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	parts, err := filepath.Glob(filepath.Join(dir, "part*.mp4"))
+	if err == nil && len(parts) == 0 {
+		err = errors.Errorf("no parts of %s", path)
+	}
+	for _, part := range parts {
+		if info, statErr := os.Stat(part); statErr == nil && info.Size() > maxSize {
+			err = errors.Errorf("part %s of %s is %d bytes, more than %d", filepath.Base(part), path, info.Size(), maxSize)
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return parts, nil
+}
+
+func ffmpeg(args ...string) error {
+	_, err := finder.RunFFmpeg(args...)
+	return err
+}
+
+// removeParts removes the parts made by FFmpegTranscoder.Split and their directory
+func removeParts(parts []string) {
+	for _, part := range parts {
+		os.Remove(part)
+	}
+	if len(parts) > 0 {
+		os.Remove(filepath.Dir(parts[0]))
+	}
+}
@@ -0,0 +1,68 @@
+package send
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func createFakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "ffmpeg"), []byte("#!/bin/sh\n"+script), 0755))
+	t.Setenv("PATH", tmpDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestFFmpegTranscoder_Compress(t *testing.T) {
+	// writes the output file passed as the last argument
+	createFakeFFmpeg(t, `eval out=\${$#}; printf 'small' > "$out"`)
+
+	path, err := NewFFmpegTranscoder().Compress("in.mp4", 50<<20, 60)
+	require.NoError(t, err)
+	defer os.Remove(path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "small", string(data))
+
+	_, err = NewFFmpegTranscoder().Compress("in.mp4", 1000, 60)
+	require.ErrorContains(t, err, "can't compress")
+}
+
+func TestFFmpegTranscoder_Split(t *testing.T) {
+	createFakeFFmpeg(t, `eval out=\${$#}; d=$(dirname "$out"); printf 'a' > "$d/part000.mp4"; printf 'b' > "$d/part001.mp4"`)
+
+	parts, err := NewFFmpegTranscoder().Split("in.mp4", 10, 15, 60)
+	require.NoError(t, err)
+	require.Len(t, parts, 2)
+	require.Equal(t, "part000.mp4", filepath.Base(parts[0]))
+	removeParts(parts)
+	require.NoDirExists(t, filepath.Dir(parts[0]))
+}
+
+func TestFFmpegTranscoder_SplitWithDataStream(t *testing.T) {
+	// the input has a data stream, e.g. the timecode of a MOV, that the MP4 muxer rejects
+	createFakeFFmpeg(t, `case " $* " in
+*" -map 0 "*) echo "Could not find tag for codec none in stream #2, codec not currently supported in container" >&2; exit 1 ;;
+esac
+case " $* " in
+*" -map 0:v -map 0:a? "*) ;;
+*) echo "unexpected arguments: $*" >&2; exit 1 ;;
+esac
+eval out=\${$#}; d=$(dirname "$out"); printf 'a' > "$d/part000.mp4"`)
+
+	parts, err := NewFFmpegTranscoder().Split("in.mov", 10, 15, 60)
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	removeParts(parts)
+}
+
+func TestFFmpegTranscoder_Error(t *testing.T) {
+	createFakeFFmpeg(t, `echo "in.mp4: Invalid data" >&2; exit 1`)
+
+	_, err := NewFFmpegTranscoder().Split("in.mp4", 10, 15, 60)
+	require.ErrorContains(t, err, "Invalid data")
+	_, err = NewFFmpegTranscoder().Compress("in.mp4", 50<<20, 60)
+	require.ErrorContains(t, err, "Invalid data")
+}
@@ -0,0 +1,393 @@
+package web
+
+import (
+	"cmp"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/send"
+)
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// apiError is the body of every failed API response
+type apiError struct {
+	Error apiErrorBody `json:"error"`
+}
+
+type apiErrorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// jobRequest describes a file to enqueue
+type jobRequest struct {
+	// Path as returned by GET /api/v1/files
+	Path string `json:"path"`
+	// Stars, Caption and Destination default to the ones of the file set by a manifest
+	Stars       *int   `json:"stars"`
+	Caption     string `json:"caption"`
+	Destination string `json:"destination"`
+}
+
+type jobsRequest struct {
+	Files []jobRequest `json:"files"`
+	// Clear removes all jobs from the queue before adding the new ones
+	Clear bool `json:"clear"`
+}
+
+type jobResponse struct {
+	ID          string        `json:"id"`
+	Status      job.JobStatus `json:"status"`
+	Error       string        `json:"error,omitempty"`
+	File        *finder.File  `json:"file,omitempty"`
+	Stars       int           `json:"stars"`
+	Caption     string        `json:"caption,omitempty"`
+	Destination string        `json:"destination,omitempty"`
+	PublishAt   time.Time     `json:"publish_at,omitzero"`
+	// Album are the files sent with File as an album
+	Album []finder.File `json:"album,omitempty"`
+}
+
+func newJobResponse(info job.JobInfo) jobResponse {
+	resp := jobResponse{
+		ID:     info.Job.GetID(),
+		Status: info.Status,
+		Error:  info.Error,
+	}
+	if j, ok := info.Job.(job.SendVideoJob); ok {
+		resp.File = &j.File
+		resp.Stars = j.Stars
+		resp.Caption = j.Caption
+		resp.Destination = j.Destination
+		resp.PublishAt = j.PublishAt
+		resp.Album = j.Album
+	}
+	return resp
+}
+
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Printf("[WARN] can't encode JSON response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: apiErrorBody{Code: code, Message: message}})
+}
+
+// writeJobError maps job queue errors to API errors
+func writeJobError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, job.ErrJobNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, job.ErrJobConflict):
+		writeAPIError(w, http.StatusConflict, "conflict", err.Error())
+	default:
+		writeAPIError(w, http.StatusInternalServerError, "internal", err.Error())
+	}
+}
+
+func (s *Server) getOpenAPICtrl(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+	if _, err := w.Write(openAPISpec); err != nil {
+		log.Printf("[WARN] can't write OpenAPI document: %v", err)
+	}
+}
+
+func (s *Server) apiNotFoundCtrl(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "not_found", fmt.Sprintf("%s %s is not found", r.Method, r.URL.Path))
+}
+
+func (s *Server) getFilesCtrl(w http.ResponseWriter, r *http.Request) {
+	files, err := s.scanFiles()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+		return
+	}
+	if files == nil {
+		files = []finder.File{}
+	}
+	writeJSON(w, http.StatusOK, files)
+}
+
+// getSkippedCtrl returns the files left out of the latest scan with the reasons
+func (s *Server) getSkippedCtrl(w http.ResponseWriter, r *http.Request) {
+	report, err := s.scanReport()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+		return
+	}
+	if report.Skipped == nil {
+		report.Skipped = []finder.Skipped{}
+	}
+	writeJSON(w, http.StatusOK, report.Skipped)
+}
+
+func (s *Server) getDuplicatesCtrl(w http.ResponseWriter, r *http.Request) {
+	report, err := s.scanReport()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+		return
+	}
+	if report.Duplicates == nil {
+		report.Duplicates = []finder.Duplicates{}
+	}
+	writeJSON(w, http.StatusOK, report.Duplicates)
+}
+
+func (s *Server) getSimilarCtrl(w http.ResponseWriter, r *http.Request) {
+	report, err := s.scanReport()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+		return
+	}
+	if report.Similar == nil {
+		report.Similar = []finder.Similar{}
+	}
+	writeJSON(w, http.StatusOK, report.Similar)
+}
+
+// thumbnailWidth is the default width of the thumbnails in pixels
+const thumbnailWidth = 160
+
+func (s *Server) getThumbnailCtrl(w http.ResponseWriter, r *http.Request) {
+	path, err := s.filePath(r.URL.Query().Get("path"))
+	if err != nil {
+		writeAPIError(w, http.StatusNotFound, "unknown_file", err.Error())
+		return
+	}
+	width := thumbnailWidth
+	if v := r.URL.Query().Get("width"); v != "" {
+		if width, err = strconv.Atoi(v); err != nil || width <= 0 || width > 1280 {
+			writeAPIError(w, http.StatusBadRequest, "invalid_width", "width must be between 1 and 1280")
+			return
+		}
+	}
+
+	img, err := s.Thumbnailer.Thumbnail(path, width)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "thumbnail_failed", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	if _, err := w.Write(img); err != nil {
+		log.Printf("[WARN] can't write thumbnail: %v", err)
+	}
+}
+
+// filePath checks that path points to a regular file inside one of the files directories,
+// the work directories of the remotes and the archives or listed in one of the manifests.
+// The files of the remotes and the archives are served by their copies in the work directories,
+// the symlinks are resolved, so a link doesn't lead out of the directories.
+func (s *Server) filePath(path string) (string, error) {
+	for _, manifest := range s.Manifests {
+		entries, err := finder.ReadManifest(manifest)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.Path != path {
+				continue
+			}
+			if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+				return path, nil
+			}
+		}
+	}
+	dirs := append([]string{}, s.FilesDirs...)
+	for _, remote := range s.Remotes {
+		dirs = append(dirs, remote.WorkDir)
+	}
+	for _, archives := range s.Archives {
+		dirs = append(dirs, archives.WorkDir)
+	}
+	for _, dir := range dirs {
+		if resolved, ok := fileIn(dir, path); ok {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("file %q is not found", path)
+}
+
+// fileIn returns the path with the symlinks resolved if it is a regular file inside dir
+func fileIn(dir, path string) (string, bool) {
+	root, err := resolvePath(dir)
+	if err != nil {
+		return "", false
+	}
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	info, err := os.Stat(resolved)
+	return resolved, err == nil && info.Mode().IsRegular()
+}
+
+// resolvePath returns the absolute path without the symlinks
+func resolvePath(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+func (s *Server) getJobsCtrl(w http.ResponseWriter, r *http.Request) {
+	jobs := s.JobQueue.GetJobs()
+	list := make([]jobResponse, 0, len(jobs))
+	for _, info := range jobs {
+		list = append(list, newJobResponse(info))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (s *Server) postJobsCtrl(w http.ResponseWriter, r *http.Request) {
+	var req jobsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return
+	}
+	if len(req.Files) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_body", "files must not be empty")
+		return
+	}
+
+	files, err := s.scanFiles()
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, "scan_failed", err.Error())
+		return
+	}
+	// only the scanned files may be sent
+	byPath := make(map[string]finder.File, len(files))
+	for _, file := range files {
+		byPath[file.Path] = file
+	}
+
+	jobs := make([]job.SendVideoJob, 0, len(req.Files))
+	for _, fr := range req.Files {
+		file, ok := byPath[fr.Path]
+		if !ok {
+			writeAPIError(w, http.StatusUnprocessableEntity, "unknown_file", fmt.Sprintf("file %q is not found", fr.Path))
+			return
+		}
+		stars := 0
+		switch {
+		case fr.Stars != nil:
+			stars = *fr.Stars
+		case file.Stars != nil:
+			stars = *file.Stars
+		}
+		if stars < 0 {
+			writeAPIError(w, http.StatusUnprocessableEntity, "invalid_stars", fmt.Sprintf("stars of %q must not be negative", fr.Path))
+			return
+		}
+		caption := cmp.Or(fr.Caption, file.Caption)
+		destination := cmp.Or(fr.Destination, file.Destination)
+		if checker, ok := s.TelegramClient.(send.DestinationChecker); ok {
+			if err := checker.CheckDestination(destination); err != nil {
+				writeAPIError(w, http.StatusBadRequest, "unknown_destination", fmt.Sprintf("destination of %q: %v", fr.Path, err))
+				return
+			}
+		}
+		if checker, ok := s.TelegramClient.(send.CaptionChecker); ok && caption != "" {
+			if err := checker.CheckCaption(destination, caption); err != nil {
+				writeAPIError(w, http.StatusUnprocessableEntity, "invalid_caption", fmt.Sprintf("caption of %q: %v", fr.Path, err))
+				return
+			}
+		}
+		// the files of an album requested one after another are sent together,
+		// the first one sets the caption, the stars and the destination
+		if last := len(jobs) - 1; last >= 0 && file.Album != "" && jobs[last].File.Album == file.Album &&
+			len(jobs[last].Album) < finder.MaxAlbumSize-1 {
+			jobs[last].Album = append(jobs[last].Album, file)
+			continue
+		}
+		jobs = append(jobs, job.SendVideoJob{
+			BaseJob:        job.BaseJob{ID: newJobID(file)},
+			TelegramClient: s.TelegramClient,
+			File:           file,
+			Stars:          stars,
+			Caption:        caption,
+			Destination:    destination,
+			PublishAt:      file.PublishAt,
+			Fetch:          s.fetch,
+			Pipeline:       s.Pipeline,
+			OnSent:         s.sent,
+		})
+	}
+
+	if req.Clear {
+		s.JobQueue.Clear()
+	}
+	list := make([]jobResponse, 0, len(jobs))
+	for _, j := range jobs {
+		s.JobQueue.AddJob(j)
+		list = append(list, newJobResponse(job.JobInfo{Job: j, Status: job.StatusQueued}))
+	}
+	writeJSON(w, http.StatusAccepted, list)
+}
+
+func (s *Server) getJobCtrl(w http.ResponseWriter, r *http.Request) {
+	info, err := s.JobQueue.GetJob(r.PathValue("id"))
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newJobResponse(info))
+}
+
+func (s *Server) deleteJobCtrl(w http.ResponseWriter, r *http.Request) {
+	if err := s.JobQueue.Cancel(r.PathValue("id")); err != nil {
+		writeJobError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) retryJobCtrl(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.JobQueue.Retry(id); err != nil {
+		writeJobError(w, err)
+		return
+	}
+	info, err := s.JobQueue.GetJob(id)
+	if err != nil {
+		writeJobError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, newJobResponse(info))
+}
+
+// getPreviewsCtrl returns the posts recorded in the dry run, the latest one is the last
+func (s *Server) getPreviewsCtrl(w http.ResponseWriter, r *http.Request) {
+	previewer, ok := s.TelegramClient.(send.Previewer)
+	if !ok {
+		writeAPIError(w, http.StatusNotFound, "not_found", "dry run is disabled")
+		return
+	}
+	previews := previewer.Previews()
+	if previews == nil {
+		previews = []send.Preview{}
+	}
+	writeJSON(w, http.StatusOK, previews)
+}
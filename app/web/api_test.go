@@ -0,0 +1,541 @@
+package web
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/send"
+)
+
+// fakeVIProvider treats every *.mp4 file as a video
+type fakeVIProvider struct{}
+
+func (p fakeVIProvider) GetVideoInfo(path string) (*finder.VideoInfo, error) {
+	if filepath.Ext(path) != ".mp4" {
+		return nil, errors.New("not a video")
+	}
+	return &finder.VideoInfo{CodecType: "video", Width: 640, Height: 360, Duration: 5}, nil
+}
+
+// fakeClient records sent posts
+type fakeClient struct {
+	posts []send.Post
+}
+
+func (c *fakeClient) Send(post send.Post) error {
+	c.posts = append(c.posts, post)
+	return nil
+}
+
+func (c *fakeClient) CheckDestination(destination string) error {
+	opts := &send.Options{Channel: "@main", Destinations: []send.Destination{{Name: "main", Chat: "@main"}}}
+	return opts.CheckDestination(destination)
+}
+
+func newTestServer(t *testing.T, names ...string) (*Server, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o600))
+	}
+	s := NewServer(job.NewJobQueue(), &fakeClient{})
+	s.FilesDirs = []string{dir}
+	s.VideoInfoProvider = fakeVIProvider{}
+	ts := httptest.NewServer(s.router())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func doJSON(t *testing.T, method, url, body string, out any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if out != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp
+}
+
+func TestAPI_GetFiles(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4", "notes.txt")
+
+	var files []finder.File
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, files, 1)
+	assert.Equal(t, "a.mp4", files[0].Name)
+	assert.Equal(t, filepath.Join(s.FilesDirs[0], "a.mp4"), files[0].Path)
+	assert.Equal(t, 640, files[0].Info.Width)
+}
+
+func TestAPI_GetSkipped(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4", "notes.txt")
+
+	// the files are scanned by the first request
+	var skipped []finder.Skipped
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/skipped", "", &skipped)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, filepath.Join(s.FilesDirs[0], "notes.txt"), skipped[0].Path)
+	assert.Equal(t, "not a video", skipped[0].Reason)
+
+	// the report of the latest scan is returned
+	require.NoError(t, os.Remove(skipped[0].Path))
+	resp = doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/skipped", "", &skipped)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Len(t, skipped, 1)
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", nil)
+	skipped = nil
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/skipped", "", &skipped)
+	assert.Equal(t, []finder.Skipped{}, skipped)
+}
+
+func TestAPI_GetDuplicates(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4", "b.mp4")
+	s.Deduplicator = finder.NewDeduplicator(finder.HashFast, finder.DuplicatesKeepFirst)
+
+	var duplicates []finder.Duplicates
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/duplicates", "", &duplicates)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, duplicates, 1)
+	pathA, pathB := filepath.Join(s.FilesDirs[0], "a.mp4"), filepath.Join(s.FilesDirs[0], "b.mp4")
+	assert.ElementsMatch(t, []string{pathA, pathB}, duplicates[0].Paths)
+
+	var files []finder.File
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	assert.Len(t, files, 1, "the copy is left out")
+	var skipped []finder.Skipped
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/skipped", "", &skipped)
+	require.Len(t, skipped, 1)
+	assert.Contains(t, skipped[0].Reason, "duplicate of")
+
+	require.NoError(t, os.WriteFile(pathB, []byte("other"), 0o600))
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/duplicates", "", &duplicates)
+	assert.Empty(t, duplicates)
+}
+
+// fakeFingerprinter makes the fingerprint of the file content
+type fakeFingerprinter struct{}
+
+func (fakeFingerprinter) Fingerprint(path string, duration int) (finder.Fingerprint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "data" {
+		return finder.Fingerprint{0xff00ff00ff00ff00}, nil
+	}
+	return finder.Fingerprint{0x5555555555555555}, nil
+}
+
+func TestAPI_GetSimilar(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4", "b.mp4")
+	pathC := filepath.Join(s.FilesDirs[0], "c.mp4")
+	require.NoError(t, os.WriteFile(pathC, []byte("other"), 0o600))
+	history, err := finder.NewHistory(filepath.Join(t.TempDir(), "history.json"))
+	require.NoError(t, err)
+	s.History = history
+	s.SimilarFinder = &finder.SimilarFinder{Fingerprinter: fakeFingerprinter{}, Threshold: 0.9, History: history}
+
+	var similar []finder.Similar
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/similar", "", &similar)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, similar, 1)
+	assert.Equal(t, finder.Similar{Path: filepath.Join(s.FilesDirs[0], "b.mp4"), Of: filepath.Join(s.FilesDirs[0], "a.mp4"), Similarity: 1}, similar[0])
+
+	// the sent file is recorded with its fingerprint and compared with on the next scan
+	files, err := s.scanFiles()
+	require.NoError(t, err)
+	require.NoError(t, s.sent(files[2]))
+	require.Len(t, history.Records(), 1)
+	assert.Equal(t, finder.Fingerprint{0x5555555555555555}, history.Records()[0].Fingerprint)
+	require.NoError(t, os.Remove(pathC))
+	require.NoError(t, os.WriteFile(filepath.Join(s.FilesDirs[0], "d.mp4"), []byte("other"), 0o600))
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", nil)
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files/similar", "", &similar)
+	require.Len(t, similar, 2)
+	assert.Equal(t, pathC, similar[1].Of)
+	assert.False(t, similar[1].SentAt.IsZero())
+}
+
+func TestAPI_PostJobs(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4", "b.mp4")
+	pathA := filepath.Join(s.FilesDirs[0], "a.mp4")
+	pathB := filepath.Join(s.FilesDirs[0], "b.mp4")
+
+	body := `{"files":[` +
+		`{"path":"` + pathB + `","stars":5,"caption":"<b>B</b>","destination":"@other"},` +
+		`{"path":"` + pathA + `"}]}`
+	var created []jobResponse
+	resp := doJSON(t, http.MethodPost, ts.URL+"/api/v1/jobs", body, &created)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Len(t, created, 2)
+	assert.Equal(t, "b.mp4", created[0].File.Name)
+	assert.Equal(t, 5, created[0].Stars)
+	assert.Equal(t, "<b>B</b>", created[0].Caption)
+	assert.Equal(t, "@other", created[0].Destination)
+	assert.Equal(t, job.StatusQueued, created[0].Status)
+
+	var got jobResponse
+	resp = doJSON(t, http.MethodGet, ts.URL+"/api/v1/jobs/"+created[1].ID, "", &got)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "a.mp4", got.File.Name)
+
+	var list []jobResponse
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/jobs", "", &list)
+	require.Len(t, list, 2)
+	assert.Equal(t, created[0].ID, list[0].ID)
+}
+
+func TestAPI_Manifest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.mp4", "b.mp4"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("data"), 0o600))
+	}
+	manifest := filepath.Join(dir, "list.jsonl")
+	require.NoError(t, os.WriteFile(manifest, []byte(
+		`{"path":"b.mp4","caption":"<b>B</b>","stars":7,"destination":"@other","publish_at":"2030-01-01T10:00:00Z"}`+"\n"+
+			`{"path":"a.mp4"}`+"\n"), 0o600))
+	s := &Server{
+		JobQueue:          job.NewJobQueue(),
+		TelegramClient:    &fakeClient{},
+		Manifests:         []string{manifest},
+		VideoInfoProvider: fakeVIProvider{},
+	}
+	ts := httptest.NewServer(s.router())
+	t.Cleanup(ts.Close)
+	assert.Empty(t, s.FilesDirs, "no default directory with a manifest")
+
+	var files []finder.File
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, files, 2)
+	assert.Equal(t, "b.mp4", files[0].Name, "the order of the manifest")
+	assert.Equal(t, "<b>B</b>", files[0].Caption)
+	assert.Equal(t, "a.mp4", files[1].Name)
+
+	// the manifest values are the defaults of the jobs
+	body := `{"files":[{"path":"` + files[0].Path + `"},{"path":"` + files[1].Path + `","stars":1}]}`
+	var created []jobResponse
+	resp = doJSON(t, http.MethodPost, ts.URL+"/api/v1/jobs", body, &created)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Len(t, created, 2)
+	assert.Equal(t, 7, created[0].Stars)
+	assert.Equal(t, "<b>B</b>", created[0].Caption)
+	assert.Equal(t, "@other", created[0].Destination)
+	assert.Equal(t, time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC), created[0].PublishAt.UTC())
+	assert.Equal(t, 1, created[1].Stars)
+	assert.True(t, created[1].PublishAt.IsZero())
+
+	path, err := s.filePath(files[1].Path)
+	require.NoError(t, err)
+	assert.Equal(t, files[1].Path, path)
+	_, err = s.filePath(manifest)
+	assert.Error(t, err, "only the listed files are served")
+}
+
+// dirSource is a remote source on the local disk
+type dirSource string
+
+func (d dirSource) List() ([]finder.Object, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var list []finder.Object
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			list = append(list, finder.Object{Path: entry.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	return list, nil
+}
+
+func (d dirSource) Open(path string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), path))
+}
+
+func (d dirSource) Remove(path string) error {
+	return os.Remove(filepath.Join(string(d), path))
+}
+
+func (d dirSource) Rename(path, newPath string) error {
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(string(d), newPath)), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(filepath.Join(string(d), path), filepath.Join(string(d), newPath))
+}
+
+func TestAPI_Remote(t *testing.T) {
+	remoteDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(remoteDir, "r.mp4"), []byte("data"), 0o600))
+	remote := &finder.Remote{Name: "nas", Source: dirSource(remoteDir), WorkDir: t.TempDir(), AfterSend: finder.AfterSendMove, MoveTo: "sent"}
+	s := &Server{
+		JobQueue:          job.NewJobQueue(),
+		TelegramClient:    &fakeClient{},
+		Remotes:           []*finder.Remote{remote},
+		VideoInfoProvider: fakeVIProvider{},
+	}
+	ts := httptest.NewServer(s.router())
+	t.Cleanup(ts.Close)
+
+	var files []finder.File
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, files, 1)
+	assert.Equal(t, filepath.Join(remote.WorkDir, "r.mp4"), files[0].Path)
+	assert.Equal(t, &finder.RemoteFile{Source: "nas", Path: "r.mp4", Pending: true}, files[0].Remote)
+	assert.NoFileExists(t, files[0].Path, "the file is downloaded by the job")
+
+	file, err := s.fetch(files[0])
+	require.NoError(t, err)
+	assert.False(t, file.Pending())
+	assert.Equal(t, 5, file.Info.Duration, "the downloaded file is probed")
+	path, err := s.filePath(file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, file.Path, path)
+
+	// the sent file is moved in the source
+	require.NoError(t, s.sent(file))
+	assert.FileExists(t, filepath.Join(remoteDir, "sent", "r.mp4"))
+	assert.NoFileExists(t, file.Path)
+	assert.NoError(t, s.sent(finder.File{Path: "local.mp4"}))
+}
+
+func TestAPI_RemoteDryRun(t *testing.T) {
+	remoteDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(remoteDir, "r.mp4"), []byte("data"), 0o600))
+	remote := &finder.Remote{Name: "nas", Source: dirSource(remoteDir), WorkDir: t.TempDir(), AfterSend: finder.AfterSendDelete}
+	s := &Server{
+		JobQueue:          job.NewJobQueue(),
+		TelegramClient:    &send.DryRunClient{Opts: &send.Options{Channel: "@main"}, Thumbnailer: fakeThumbnailer{}},
+		Remotes:           []*finder.Remote{remote},
+		VideoInfoProvider: fakeVIProvider{},
+	}
+
+	files, _, err := remote.Fetch()
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	file, err := s.fetch(files[0])
+	require.NoError(t, err)
+	// the dry run sends nothing, so the object isn't deleted
+	require.NoError(t, s.sent(file))
+	assert.FileExists(t, filepath.Join(remoteDir, "r.mp4"))
+	assert.FileExists(t, file.Path)
+}
+
+func TestAPI_Archive(t *testing.T) {
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "clips.zip"))
+	require.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"a.mp4", "b.mp4"} {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte("data"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	require.NoError(t, f.Close())
+	archives := &finder.Archives{Name: "zips", Pattern: filepath.Join(dir, "*.zip"), WorkDir: t.TempDir(), Album: true}
+	s := &Server{
+		JobQueue:          job.NewJobQueue(),
+		TelegramClient:    &fakeClient{},
+		Archives:          []*finder.Archives{archives},
+		VideoInfoProvider: fakeVIProvider{},
+	}
+	ts := httptest.NewServer(s.router())
+	t.Cleanup(ts.Close)
+
+	var files []finder.File
+	doJSON(t, http.MethodGet, ts.URL+"/api/v1/files", "", &files)
+	require.Len(t, files, 2)
+	assert.Equal(t, &finder.ArchiveFile{Archive: filepath.Join(dir, "clips.zip"), Entry: "a.mp4", Pending: true}, files[0].Archive)
+	assert.NoFileExists(t, files[0].Path, "the file is extracted by the job")
+
+	// the files of the album are sent in one job
+	var created []jobResponse
+	resp := doJSON(t, http.MethodPost, ts.URL+"/api/v1/jobs",
+		`{"files":[{"path":"`+files[0].Path+`","caption":"clips"},{"path":"`+files[1].Path+`"}]}`, &created)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	require.Len(t, created, 1)
+	assert.Equal(t, "a.mp4", created[0].File.Name)
+	assert.Equal(t, "clips", created[0].Caption)
+	require.Len(t, created[0].Album, 1)
+	assert.Equal(t, "b.mp4", created[0].Album[0].Name)
+
+	file, err := s.fetch(files[0])
+	require.NoError(t, err)
+	assert.False(t, file.Pending())
+	assert.Equal(t, 5, file.Info.Duration, "the extracted file is probed")
+	path, err := s.filePath(file.Path)
+	require.NoError(t, err)
+	assert.Equal(t, file.Path, path)
+}
+
+func TestAPI_PostJobsErrors(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4")
+	path := filepath.Join(s.FilesDirs[0], "a.mp4")
+
+	tests := []struct {
+		name, body string
+		status     int
+		code       string
+	}{
+		{"invalid json", `{`, http.StatusBadRequest, "invalid_body"},
+		{"no files", `{"files":[]}`, http.StatusBadRequest, "invalid_body"},
+		{"unknown file", `{"files":[{"path":"/etc/passwd"}]}`, http.StatusUnprocessableEntity, "unknown_file"},
+		{"unknown destination", `{"files":[{"path":"` + path + `","destination":"mian"}]}`, http.StatusBadRequest, "unknown_destination"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var apiErr apiError
+			resp := doJSON(t, http.MethodPost, ts.URL+"/api/v1/jobs", tt.body, &apiErr)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.code, apiErr.Error.Code)
+			assert.NotEmpty(t, apiErr.Error.Message)
+		})
+	}
+}
+
+func TestAPI_DeleteAndRetryJob(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4")
+	var created []jobResponse
+	doJSON(t, http.MethodPost, ts.URL+"/api/v1/jobs", `{"files":[{"path":"`+filepath.Join(s.FilesDirs[0], "a.mp4")+`"}]}`, &created)
+	require.Len(t, created, 1)
+	jobURL := ts.URL + "/api/v1/jobs/" + created[0].ID
+
+	resp := doJSON(t, http.MethodDelete, jobURL, "", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	var got jobResponse
+	doJSON(t, http.MethodGet, jobURL, "", &got)
+	assert.Equal(t, job.StatusCanceled, got.Status)
+
+	resp = doJSON(t, http.MethodPost, jobURL+"/retry", "", &got)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, job.StatusQueued, got.Status)
+
+	var apiErr apiError
+	resp = doJSON(t, http.MethodPost, jobURL+"/retry", "", &apiErr)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, "conflict", apiErr.Error.Code)
+
+	resp = doJSON(t, http.MethodGet, ts.URL+"/api/v1/jobs/unknown", "", &apiErr)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "not_found", apiErr.Error.Code)
+}
+
+func TestAPI_OpenAPI(t *testing.T) {
+	_, ts := newTestServer(t)
+	resp, err := http.Get(ts.URL + "/api/v1/openapi.yaml")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "yaml")
+}
+
+// fakeThumbnailer returns the path as the image
+type fakeThumbnailer struct{}
+
+func (fakeThumbnailer) Thumbnail(path string, width int) ([]byte, error) {
+	return []byte(filepath.Base(path)), nil
+}
+
+func TestAPI_GetThumbnail(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4")
+	s.Thumbnailer = fakeThumbnailer{}
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(ts.URL + "/api/v1/files/thumbnail?path=" + url.QueryEscape(path))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	resp, body := get(filepath.Join(s.FilesDirs[0], "a.mp4"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "image/jpeg", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "a.mp4", body)
+
+	// a link inside the directory is served by its target inside, not by one outside
+	inside := filepath.Join(s.FilesDirs[0], "inside.mp4")
+	require.NoError(t, os.Symlink(filepath.Join(s.FilesDirs[0], "a.mp4"), inside))
+	resp, body = get(inside)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "a.mp4", body)
+	outside := filepath.Join(s.FilesDirs[0], "outside.mp4")
+	require.NoError(t, os.Symlink(writeTempFile(t, "secret.mp4"), outside))
+
+	for _, path := range []string{"/etc/passwd", filepath.Join(s.FilesDirs[0], "..", "x.mp4"), s.FilesDirs[0], "", outside} {
+		resp, _ = get(path)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+// writeTempFile writes a file to a new temporary directory and returns its path
+func writeTempFile(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(name), 0o600))
+	return path
+}
+
+func TestDryRun(t *testing.T) {
+	s, ts := newTestServer(t, "a.mp4")
+	var err error
+	s.templates, err = s.parseTemplates()
+	require.NoError(t, err)
+
+	var apiErr apiError
+	resp := doJSON(t, http.MethodGet, ts.URL+"/api/v1/previews", "", &apiErr)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	client := &send.DryRunClient{Opts: &send.Options{Channel: "@main"}, Thumbnailer: fakeThumbnailer{}}
+	s.TelegramClient = client
+	file, err := finder.NewProvider(fakeVIProvider{}).GetFile(filepath.Join(s.FilesDirs[0], "a.mp4"))
+	require.NoError(t, err)
+	require.ErrorIs(t, client.Send(send.Post{File: file, Caption: `<b>A</b><script>x</script>`}), send.ErrBadCaption)
+	require.NoError(t, client.Send(send.Post{File: file, Stars: 7, Caption: `<b>A</b>&lt;script&gt;x&lt;/script&gt;`}))
+
+	var previews []send.Preview
+	resp = doJSON(t, http.MethodGet, ts.URL+"/api/v1/previews", "", &previews)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Len(t, previews, 1)
+	assert.Equal(t, "@main", previews[0].Chat)
+	assert.Equal(t, 7, previews[0].Stars)
+	assert.Equal(t, "a.mp4", string(previews[0].Thumbnail))
+
+	resp, err = http.Get(ts.URL + "/dry-run")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `href="/dry-run"`)
+	assert.Contains(t, string(body), `<b>A</b>&lt;script&gt;x&lt;/script&gt;`)
+	assert.Contains(t, string(body), `src="data:image/jpeg;base64,YS5tcDQ="`)
+	assert.Contains(t, string(body), "@main")
+}
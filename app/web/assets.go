@@ -0,0 +1,21 @@
+package web
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embeddedAssets keeps the templates and static files inside the binary
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// assets returns the file system with "templates" and "static" directories:
+// AssetsDir on disk if it is set, otherwise the embedded one
+func (s *Server) assets() fs.FS {
+	if s.AssetsDir != "" {
+		return os.DirFS(s.AssetsDir)
+	}
+	return embeddedAssets
+}
@@ -0,0 +1,53 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/job"
+)
+
+func TestAssets_Embedded(t *testing.T) {
+	s := &Server{JobQueue: job.NewJobQueue()}
+	tmpl, err := s.parseTemplates()
+	require.NoError(t, err)
+	for _, name := range []string{"index.html", "files.html", "login.html", "nav"} {
+		assert.NotNil(t, tmpl.Lookup(name), name)
+	}
+
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+	resp, err := http.Get(ts.URL + "/static/styles/styles.css")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "@import")
+}
+
+func TestAssets_OverrideDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "templates"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "static"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "templates", "index.html"), []byte("dev {{.Page}}"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "static", "app.css"), []byte("body{}"), 0o600))
+
+	s := &Server{JobQueue: job.NewJobQueue(), AssetsDir: dir}
+	var err error
+	s.templates, err = s.parseTemplates()
+	require.NoError(t, err)
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "dev index", readBody(t, resp))
+
+	resp, err = http.Get(ts.URL + "/static/app.css")
+	require.NoError(t, err)
+	assert.Equal(t, "body{}", readBody(t, resp))
+}
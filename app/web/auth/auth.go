@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Authenticator checks the credentials of a request
+type Authenticator interface {
+	// Authenticate returns the user name if the request carries valid credentials
+	Authenticate(r *http.Request) (string, bool)
+}
+
+type ctxKey struct{}
+
+// authenticatorKey keeps the authenticator that accepted the request
+type authenticatorKey struct{}
+
+// UserFromContext returns the name of the authenticated user
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(ctxKey{}).(string)
+	return user
+}
+
+// Require passes the request to next if any of authenticators accepts it, otherwise calls deny
+func Require(next http.Handler, deny http.HandlerFunc, authenticators ...Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, a := range authenticators {
+			if user, ok := a.Authenticate(r); ok {
+				ctx := context.WithValue(r.Context(), ctxKey{}, user)
+				next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, authenticatorKey{}, a)))
+				return
+			}
+		}
+		deny(w, r)
+	})
+}
+
+// BearerToken accepts requests with "Authorization: Bearer <Token>" header
+type BearerToken struct {
+	Token string
+}
+
+func (o BearerToken) Authenticate(r *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || o.Token == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(o.Token)) != 1 {
+		return "", false
+	}
+	return "api", true
+}
+
+// Users checks passwords against bcrypt hashes
+type Users map[string]string
+
+// Check returns true if the password matches the user's hash
+func (o Users) Check(user, password string) bool {
+	hash, ok := o[user]
+	if !ok {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// BasicAuth accepts requests with HTTP basic credentials of the Users
+type BasicAuth struct {
+	Users Users
+}
+
+func (o BasicAuth) Authenticate(r *http.Request) (string, bool) {
+	user, password, ok := r.BasicAuth()
+	if !ok || !o.Users.Check(user, password) {
+		return "", false
+	}
+	return user, true
+}
+
+// ParseUsers parses "user:bcrypt-hash" pairs separated by commas
+func ParseUsers(s string) (Users, error) {
+	users := Users{}
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		user, hash, ok := strings.Cut(pair, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("invalid user %q, expected user:bcrypt-hash", pair)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash of user %q: %w", user, err)
+		}
+		users[user] = hash
+	}
+	return users, nil
+}
+
+// Mode of the UI authentication
+type Mode string
+
+const (
+	ModeBasic   Mode = "basic"
+	ModeSession Mode = "session"
+)
+
+// Options of the control panel authentication
+type Options struct {
+	// APIToken is the static bearer token for the API
+	APIToken string
+	// Users of the UI with bcrypt-hashed passwords
+	Users Users
+	Mode  Mode
+	// SessionSecret signs the session cookies, required in session mode
+	SessionSecret string
+	SessionTTL    time.Duration
+	// TelegramBotToken enables the Telegram Login Widget for the TelegramUsers
+	TelegramBotToken string
+	TelegramBotName  string
+	TelegramUsers    []int64
+	// HTTPSProxy marks the cookies secure when a proxy terminates HTTPS in front of the server
+	HTTPSProxy bool
+}
+
+// Enabled returns true if any credentials are configured
+func (o Options) Enabled() bool {
+	return o.APIToken != "" || len(o.Users) > 0 || len(o.TelegramUsers) > 0
+}
+
+// Auth combines the configured authenticators
+type Auth struct {
+	Opts     Options
+	Sessions *Sessions
+	CSRF     *CSRF
+	Telegram *TelegramLogin
+	ui       []Authenticator
+	api      []Authenticator
+}
+
+func New(opts Options) (*Auth, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeBasic
+	}
+	if opts.Mode != ModeBasic && opts.Mode != ModeSession {
+		return nil, fmt.Errorf("unknown auth mode %q", opts.Mode)
+	}
+	if len(opts.TelegramUsers) > 0 {
+		if opts.TelegramBotToken == "" {
+			return nil, errors.New("telegram login requires the bot token")
+		}
+		// the widget can only sign in with a session
+		opts.Mode = ModeSession
+	}
+
+	a := &Auth{Opts: opts, CSRF: NewCSRF(opts.HTTPSProxy)}
+	if opts.Mode == ModeSession {
+		if len(opts.SessionSecret) < 32 {
+			return nil, errors.New("session secret must be at least 32 characters long")
+		}
+		a.Sessions = NewSessions(opts.SessionSecret, opts.SessionTTL, opts.HTTPSProxy)
+		a.ui = append(a.ui, a.Sessions)
+	} else {
+		a.ui = append(a.ui, BasicAuth{Users: opts.Users})
+	}
+	if len(opts.TelegramUsers) > 0 {
+		a.Telegram = NewTelegramLogin(opts.TelegramBotToken, opts.TelegramUsers)
+	}
+	if opts.APIToken != "" {
+		a.api = append(a.api, BearerToken{Token: opts.APIToken})
+	}
+	// the UI calls the API with its own credentials
+	a.api = append(a.api, a.ui...)
+	return a, nil
+}
+
+// UI protects the pages of the control panel
+func (a *Auth) UI(next http.Handler) http.Handler {
+	return Require(a.CSRF.Protect(next), a.denyUI, a.ui...)
+}
+
+// API protects the JSON API
+func (a *Auth) API(next http.Handler) http.Handler {
+	return Require(a.CSRF.Protect(next), denyAPI, a.api...)
+}
+
+func (a *Auth) denyUI(w http.ResponseWriter, r *http.Request) {
+	if a.Opts.Mode == ModeSession {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="files2tg", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+// secure returns true if the cookies of the request must only be sent over HTTPS
+func secure(r *http.Request, httpsProxy bool) bool {
+	return r.TLS != nil || httpsProxy
+}
+
+func denyAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	_, _ = w.Write([]byte(`{"error":{"code":"unauthorized","message":"authentication is required"}}` + "\n"))
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testUsers(t *testing.T) Users {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	return Users{"admin": string(hash)}
+}
+
+func TestBearerToken(t *testing.T) {
+	a := BearerToken{Token: "tok"}
+	tests := []struct {
+		header string
+		ok     bool
+	}{
+		{"Bearer tok", true},
+		{"Bearer wrong", false},
+		{"tok", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", tt.header)
+		_, ok := a.Authenticate(r)
+		assert.Equal(t, tt.ok, ok, tt.header)
+	}
+
+	// an empty token never matches
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer ")
+	_, ok := BearerToken{}.Authenticate(r)
+	assert.False(t, ok)
+}
+
+func TestBasicAuth(t *testing.T) {
+	a := BasicAuth{Users: testUsers(t)}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.SetBasicAuth("admin", "secret")
+	user, ok := a.Authenticate(r)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", user)
+
+	r.SetBasicAuth("admin", "wrong")
+	_, ok = a.Authenticate(r)
+	assert.False(t, ok)
+
+	r.SetBasicAuth("unknown", "secret")
+	_, ok = a.Authenticate(r)
+	assert.False(t, ok)
+}
+
+func TestParseUsers(t *testing.T) {
+	users := testUsers(t)
+	parsed, err := ParseUsers(" admin:" + users["admin"] + ", ")
+	require.NoError(t, err)
+	assert.Equal(t, users, parsed)
+
+	_, err = ParseUsers("admin")
+	assert.Error(t, err)
+	_, err = ParseUsers("admin:plain")
+	assert.ErrorContains(t, err, "invalid bcrypt hash")
+}
+
+func TestSessions(t *testing.T) {
+	s := NewSessions(strings.Repeat("s", 32), time.Hour, false)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	w := httptest.NewRecorder()
+	s.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), "admin")
+	cookie := w.Result().Cookies()[0]
+	assert.False(t, cookie.Secure)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	user, ok := s.Authenticate(r)
+	assert.True(t, ok)
+	assert.Equal(t, "admin", user)
+
+	t.Run("tampered", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		// "root" instead of "admin" with the original signature
+		_, rest, _ := strings.Cut(cookie.Value, ".")
+		r.AddCookie(&http.Cookie{Name: cookie.Name, Value: "cm9vdA." + rest})
+		_, ok := s.Authenticate(r)
+		assert.False(t, ok)
+	})
+
+	t.Run("other secret", func(t *testing.T) {
+		other := NewSessions(strings.Repeat("x", 32), time.Hour, false)
+		_, ok := other.Authenticate(r)
+		assert.False(t, ok)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		s.now = func() time.Time { return now.Add(2 * time.Hour) }
+		defer func() { s.now = func() time.Time { return now } }()
+		_, ok := s.Authenticate(r)
+		assert.False(t, ok)
+	})
+
+	t.Run("end", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.End(w, httptest.NewRequest(http.MethodPost, "/logout", nil))
+		assert.Equal(t, -1, w.Result().Cookies()[0].MaxAge)
+	})
+
+	t.Run("secure", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		s.Start(w, httptest.NewRequest(http.MethodPost, "https://example.com/login", nil), "admin")
+		assert.True(t, w.Result().Cookies()[0].Secure)
+
+		w = httptest.NewRecorder()
+		proxied := NewSessions(strings.Repeat("s", 32), time.Hour, true)
+		proxied.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), "admin")
+		assert.True(t, w.Result().Cookies()[0].Secure)
+	})
+}
+
+func TestCSRF(t *testing.T) {
+	c := NewCSRF(false)
+	w := httptest.NewRecorder()
+	token := c.Token(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NotEmpty(t, token)
+	cookie := w.Result().Cookies()[0]
+	assert.False(t, cookie.Secure)
+
+	// the token of the cookie is reused
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	assert.Equal(t, token, c.Token(httptest.NewRecorder(), r))
+
+	post := func(form url.Values, header string, withCookie bool) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header != "" {
+			r.Header.Set(CSRFHeader, header)
+		}
+		if withCookie {
+			r.AddCookie(cookie)
+		}
+		return r
+	}
+
+	assert.True(t, c.Valid(httptest.NewRequest(http.MethodGet, "/", nil)))
+	assert.True(t, c.Valid(post(url.Values{CSRFField: {token}}, "", true)))
+	assert.True(t, c.Valid(post(nil, token, true)))
+	assert.False(t, c.Valid(post(url.Values{CSRFField: {token}}, "", false)))
+	assert.False(t, c.Valid(post(url.Values{CSRFField: {"wrong"}}, "", true)))
+	assert.False(t, c.Valid(post(nil, "", true)))
+
+	// the header alone is not enough, the bearer token must have authenticated the request
+	bearer := post(nil, "", false)
+	bearer.Header.Set("Authorization", "Bearer tok")
+	assert.False(t, c.Valid(bearer))
+	bearer = bearer.WithContext(context.WithValue(bearer.Context(), authenticatorKey{}, BearerToken{Token: "tok"}))
+	assert.True(t, c.Valid(bearer))
+
+	w = httptest.NewRecorder()
+	NewCSRF(true).Token(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, w.Result().Cookies()[0].Secure)
+}
+
+// signTelegram signs the widget data like Telegram does
+func signTelegram(botToken string, values url.Values) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+"="+values.Get(key))
+	}
+	secret := sha256.Sum256([]byte(botToken))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestTelegramLogin_Verify(t *testing.T) {
+	tl := NewTelegramLogin("bot:token", []int64{42})
+	now := time.Now()
+	tl.now = func() time.Time { return now }
+
+	data := func(id string, authDate time.Time) url.Values {
+		v := url.Values{
+			"id":         {id},
+			"first_name": {"John"},
+			"username":   {"john"},
+			"auth_date":  {strconv.FormatInt(authDate.Unix(), 10)},
+		}
+		signTelegram("bot:token", v)
+		return v
+	}
+
+	user, err := tl.Verify(data("42", now))
+	require.NoError(t, err)
+	assert.Equal(t, "@john", user)
+
+	_, err = tl.Verify(data("7", now))
+	assert.ErrorContains(t, err, "not allowed")
+
+	_, err = tl.Verify(data("42", now.Add(-48*time.Hour)))
+	assert.ErrorContains(t, err, "outdated")
+
+	tampered := data("42", now)
+	tampered.Set("id", "43")
+	_, err = tl.Verify(tampered)
+	assert.ErrorContains(t, err, "invalid hash")
+
+	_, err = tl.Verify(url.Values{"id": {"42"}})
+	assert.ErrorContains(t, err, "hash is missing")
+}
+
+func TestNew(t *testing.T) {
+	a, err := New(Options{Users: testUsers(t)})
+	require.NoError(t, err)
+	assert.Equal(t, ModeBasic, a.Opts.Mode)
+	assert.Nil(t, a.Sessions)
+
+	_, err = New(Options{Mode: ModeSession, SessionSecret: "short"})
+	assert.ErrorContains(t, err, "session secret")
+
+	_, err = New(Options{Mode: "magic"})
+	assert.ErrorContains(t, err, "unknown auth mode")
+
+	_, err = New(Options{TelegramUsers: []int64{1}})
+	assert.ErrorContains(t, err, "bot token")
+
+	a, err = New(Options{TelegramUsers: []int64{1}, TelegramBotToken: "t", SessionSecret: strings.Repeat("s", 32)})
+	require.NoError(t, err)
+	assert.Equal(t, ModeSession, a.Opts.Mode)
+	assert.NotNil(t, a.Telegram)
+}
+
+func TestAuth_Middleware(t *testing.T) {
+	a, err := New(Options{APIToken: "tok", Users: testUsers(t)})
+	require.NoError(t, err)
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(UserFromContext(r.Context())))
+	})
+
+	t.Run("ui requires basic auth", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		a.UI(ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Basic")
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth("admin", "secret")
+		a.UI(ok).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "admin", w.Body.String())
+	})
+
+	t.Run("ui does not accept the api token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer tok")
+		a.UI(ok).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("api accepts token and ui credentials", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		a.API(ok).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), `"unauthorized"`)
+
+		w = httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", nil)
+		r.Header.Set("Authorization", "Bearer tok")
+		a.API(ok).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/api/v1/jobs", nil)
+		r.SetBasicAuth("admin", "secret")
+		a.API(ok).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("unsafe ui request requires csrf token", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/send", nil)
+		r.SetBasicAuth("admin", "secret")
+		a.UI(ok).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestAuth_BearerHeaderWithSession(t *testing.T) {
+	a, err := New(Options{APIToken: "tok", Users: testUsers(t), Mode: ModeSession, SessionSecret: strings.Repeat("s", 32)})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	a.Sessions.Start(w, httptest.NewRequest(http.MethodPost, "/login", nil), "admin")
+	session := w.Result().Cookies()[0]
+
+	// the session authenticates the request, so the bearer header does not skip the check
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/jobs", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	r.AddCookie(session)
+	a.API(http.NotFoundHandler()).ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuth_SessionModeRedirectsToLogin(t *testing.T) {
+	a, err := New(Options{Users: testUsers(t), Mode: ModeSession, SessionSecret: strings.Repeat("s", 32)})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	a.UI(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+)
+
+const (
+	csrfCookie = "files2tg_csrf"
+	// CSRFField is the name of the hidden form field with the token
+	CSRFField = "csrf_token"
+	// CSRFHeader is the name of the header with the token for fetch requests
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF implements the double-submit cookie protection:
+// unsafe requests must repeat the cookie value in a form field or a header
+type CSRF struct {
+	httpsProxy bool
+}
+
+func NewCSRF(httpsProxy bool) *CSRF {
+	return &CSRF{httpsProxy: httpsProxy}
+}
+
+// Token returns the token of the request, setting a new cookie if needed
+func (o *CSRF) Token(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	token := base64.RawURLEncoding.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   secure(r, o.httpsProxy),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token
+}
+
+// Protect rejects unsafe requests without a valid token.
+// Requests authenticated by the bearer token are not sent by browsers on their own, so they are not checked.
+func (o *CSRF) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !o.Valid(r) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Valid returns true if the request is safe or carries the token
+func (o *CSRF) Valid(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	if _, ok := r.Context().Value(authenticatorKey{}).(BearerToken); ok {
+		return true
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	token := r.Header.Get(CSRFHeader)
+	if token == "" {
+		token = r.PostFormValue(CSRFField)
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) == 1
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionCookie = "files2tg_session"
+
+// Sessions keeps the signed-in user in an HMAC-signed cookie
+type Sessions struct {
+	secret     []byte
+	ttl        time.Duration
+	httpsProxy bool
+	now        func() time.Time
+}
+
+func NewSessions(secret string, ttl time.Duration, httpsProxy bool) *Sessions {
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	return &Sessions{secret: []byte(secret), ttl: ttl, httpsProxy: httpsProxy, now: time.Now}
+}
+
+// Start signs in the user
+func (o *Sessions) Start(w http.ResponseWriter, r *http.Request, user string) {
+	expires := o.now().Add(o.ttl)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    payload + "." + o.sign(payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secure(r, o.httpsProxy),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// End signs out the user
+func (o *Sessions) End(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secure(r, o.httpsProxy),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (o *Sessions) Authenticate(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return "", false
+	}
+	payload, signature, ok := cutLast(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(o.sign(payload))) {
+		return "", false
+	}
+	encodedUser, expiresRaw, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+	expires, err := strconv.ParseInt(expiresRaw, 10, 64)
+	if err != nil || o.now().Unix() > expires {
+		return "", false
+	}
+	user, err := base64.RawURLEncoding.DecodeString(encodedUser)
+	if err != nil {
+		return "", false
+	}
+	return string(user), true
+}
+
+func (o *Sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, o.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TelegramLogin verifies the data of the Telegram Login Widget,
+// see https://core.telegram.org/widgets/login#checking-authorization
+type TelegramLogin struct {
+	secret []byte
+	users  []int64
+	// MaxAge of the authorization data
+	MaxAge time.Duration
+	now    func() time.Time
+}
+
+func NewTelegramLogin(botToken string, users []int64) *TelegramLogin {
+	secret := sha256.Sum256([]byte(botToken))
+	return &TelegramLogin{
+		secret: secret[:],
+		users:  users,
+		MaxAge: 24 * time.Hour,
+		now:    time.Now,
+	}
+}
+
+// Verify checks the widget data and returns the user name of an allowed user
+func (o *TelegramLogin) Verify(values url.Values) (string, error) {
+	hash := values.Get("hash")
+	if hash == "" {
+		return "", errors.New("hash is missing")
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key != "hash" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	lines := make([]string, 0, len(keys))
+	for _, key := range keys {
+		lines = append(lines, key+"="+values.Get(key))
+	}
+	mac := hmac.New(sha256.New, o.secret)
+	mac.Write([]byte(strings.Join(lines, "\n")))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(hash)) {
+		return "", errors.New("invalid hash")
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil || o.now().Sub(time.Unix(authDate, 0)) > o.MaxAge {
+		return "", errors.New("authorization data is outdated")
+	}
+	id, err := strconv.ParseInt(values.Get("id"), 10, 64)
+	if err != nil {
+		return "", errors.New("invalid user id")
+	}
+	if !slices.Contains(o.users, id) {
+		return "", errors.New("user is not allowed")
+	}
+	if username := values.Get("username"); username != "" {
+		return "@" + username, nil
+	}
+	return "tg:" + values.Get("id"), nil
+}
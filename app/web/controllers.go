@@ -1,18 +1,94 @@
 package web
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"html/template"
+	"io"
+	"log"
 	"net/http"
 	"time"
 
+	tb "gopkg.in/telebot.v4"
+
 	"github.com/meesooqa/files2tg/app/finder"
 	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/web/auth"
 )
 
+// pageData is passed to every page template
+type pageData struct {
+	// Page is the name of the current page for the navigation
+	Page string
+	// User is the signed-in user, empty if there is no authentication
+	User      string
+	CSRFToken string
+	// CanLogout is true if the user has signed in with a session
+	CanLogout bool
+	// DryRun is true if the posts are recorded instead of being sent
+	DryRun   bool
+	Statuses map[string]job.JobStatus
+	Previews []previewView
+}
+
+// previewView is a send.Preview rendered by the dry run page
+type previewView struct {
+	send.Preview
+	// CaptionHTML is the caption as Telegram would render it
+	CaptionHTML template.HTML
+	// ThumbnailURL is a data URL of the thumbnail
+	ThumbnailURL template.URL
+}
+
+func (s *Server) newPageData(w http.ResponseWriter, r *http.Request) pageData {
+	_, dryRun := s.TelegramClient.(send.Previewer)
+	data := pageData{User: auth.UserFromContext(r.Context()), DryRun: dryRun}
+	if s.Auth != nil {
+		data.CSRFToken = s.Auth.CSRF.Token(w, r)
+		data.CanLogout = s.Auth.Sessions != nil
+	}
+	return data
+}
+
 func (s *Server) getIndexPageCtrl(w http.ResponseWriter, r *http.Request) {
-	statuses := s.JobQueue.GetJobsStatuses()
-	s.templates.Execute(w, statuses)
+	data := s.newPageData(w, r)
+	data.Page = "index"
+	data.Statuses = s.JobQueue.GetJobsStatuses()
+	s.templates.ExecuteTemplate(w, "index.html", data)
+}
+
+func (s *Server) getFilesPageCtrl(w http.ResponseWriter, r *http.Request) {
+	data := s.newPageData(w, r)
+	data.Page = "files"
+	s.templates.ExecuteTemplate(w, "files.html", data)
+}
+
+func (s *Server) getDryRunPageCtrl(w http.ResponseWriter, r *http.Request) {
+	previewer, ok := s.TelegramClient.(send.Previewer)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	data := s.newPageData(w, r)
+	data.Page = "dry-run"
+	previews := previewer.Previews()
+	for i := len(previews) - 1; i >= 0; i-- {
+		p := previewView{Preview: previews[i], CaptionHTML: telegramHTML(previews[i].Caption)}
+		if p.ParseMode != string(tb.ModeHTML) {
+			// MarkdownV2 is shown as is
+			p.CaptionHTML = template.HTML(template.HTMLEscapeString(p.Caption))
+		}
+		if len(p.Thumbnail) > 0 {
+			// the thumbnail is made by ffmpeg, so the data URL is trusted
+			p.ThumbnailURL = template.URL("data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(p.Thumbnail))
+		}
+		data.Previews = append(data.Previews, p)
+	}
+	s.templates.ExecuteTemplate(w, "dryrun.html", data)
 }
 
 func (s *Server) getStatusPageCtrl(w http.ResponseWriter, r *http.Request) {
@@ -23,6 +99,65 @@ func (s *Server) getStatusPageCtrl(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// getEventsCtrl streams job events as Server-Sent Events.
+// The first event is a "snapshot" with the current statuses, followed by job events named by their type.
+func (s *Server) getEventsCtrl(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	// the stream outlives the server's WriteTimeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, cancel := s.JobQueue.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := writeSSE(w, "snapshot", s.JobQueue.GetJobsStatuses()); err != nil {
+		return
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(30 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeSSE(w, string(event.Type), event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeSSE writes a single Server-Sent Event with JSON data
+func writeSSE(w io.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
 func (s *Server) send(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodPost {
 		s.addJobsChunk()
@@ -32,35 +167,150 @@ func (s *Server) send(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) addJobsChunk() {
-	// TODO move "dir" to config
-	dir := "var/files"
+// scanFiles returns the files of the sources and keeps the report of the skipped ones
+func (s *Server) scanFiles() ([]finder.File, error) {
+	filesProvider := finder.NewProvider(s.VideoInfoProvider)
+	if s.ScanWorkers > 0 {
+		filesProvider.Workers = s.ScanWorkers
+	}
+	filesProvider.Sorters = s.Sorters
+	scanner := &finder.Scanner{
+		Provider:      filesProvider,
+		Dirs:          s.FilesDirs,
+		Manifests:     s.Manifests,
+		Remotes:       s.Remotes,
+		Archives:      s.Archives,
+		Deduplicator:  s.Deduplicator,
+		SimilarFinder: s.SimilarFinder,
+	}
+	files, report, err := scanner.Scan()
+	if err != nil {
+		return nil, err
+	}
+	if len(report.Skipped) > 0 {
+		log.Printf("[INFO] %d files are skipped, see GET /api/v1/files/skipped", len(report.Skipped))
+	}
+	s.reportMu.Lock()
+	s.report = &report
+	s.reportMu.Unlock()
+	return files, nil
+}
+
+// scanReport returns the report of the latest scan, the files are scanned if there is none yet
+func (s *Server) scanReport() (finder.ScanReport, error) {
+	s.reportMu.Lock()
+	report := s.report
+	s.reportMu.Unlock()
+	if report != nil {
+		return *report, nil
+	}
+	if _, err := s.scanFiles(); err != nil {
+		return finder.ScanReport{}, err
+	}
+	return s.scanReport()
+}
+
+// fetch downloads or extracts the pending file of a remote source or archives and probes it
+func (s *Server) fetch(file finder.File) (finder.File, error) {
+	if !file.Pending() {
+		return file, nil
+	}
+	var err error
+	if file.Remote != nil {
+		file, err = s.download(file)
+	} else {
+		file, err = s.extract(file)
+	}
+	if err != nil {
+		return file, err
+	}
+	if file.Info, err = s.VideoInfoProvider.GetVideoInfo(file.Path); err != nil {
+		return file, fmt.Errorf("failed to get video info for %s: %w", file.Path, err)
+	}
+	return file, nil
+}
+
+// download downloads the file with its remote source
+func (s *Server) download(file finder.File) (finder.File, error) {
+	for _, remote := range s.Remotes {
+		if remote.Name == file.Remote.Source {
+			return remote.Download(file)
+		}
+	}
+	return file, fmt.Errorf("remote source %q is not found", file.Remote.Source)
+}
+
+// extract extracts the file with the archives matching its archive
+func (s *Server) extract(file finder.File) (finder.File, error) {
+	for _, archives := range s.Archives {
+		if archives.Matches(file.Archive.Archive) {
+			return archives.Extract(file)
+		}
+	}
+	return file, fmt.Errorf("archives of %s are not found", file.Archive.Archive)
+}
 
-	videoInfoProvider := finder.NewVideoInfoProvider()
-	filesProvider := finder.NewProvider(videoInfoProvider)
-	files, err := filesProvider.GetListFilesSorted(dir, ".")
+// sent records the sent file in the history and does the action of the remote source with it
+func (s *Server) sent(file finder.File) error {
+	if s.History != nil {
+		if err := s.History.Add(file, time.Now()); err != nil {
+			log.Printf("[WARN] can't record %s in the history: %v", file.Path, err)
+		}
+	}
+	// the dry run sends nothing, so the remote file is kept as it is
+	if _, dryRun := s.TelegramClient.(send.Previewer); dryRun || file.Remote == nil {
+		return nil
+	}
+	for _, remote := range s.Remotes {
+		if remote.Name == file.Remote.Source {
+			return remote.Sent(file)
+		}
+	}
+	return fmt.Errorf("remote source %q is not found", file.Remote.Source)
+}
+
+// newJobID returns ID of the job sending the file, the hash of its origin tells apart
+// the files of the same name and time in the different sources
+func newJobID(file finder.File) string {
+	origin := file.Path
+	switch {
+	case file.Remote != nil:
+		origin = file.Remote.Source + ":" + file.Remote.Path
+	case file.Archive != nil:
+		origin = file.Archive.Archive + ":" + file.Archive.Entry
+	}
+	h := sha256.Sum256([]byte(origin))
+	return fmt.Sprintf("%s-%s-%s", file.Name, file.ModTime.Format(time.RFC3339), hex.EncodeToString(h[:4]))
+}
+
+func (s *Server) addJobsChunk() {
+	files, err := s.scanFiles()
 	if err != nil {
-		fmt.Printf("GetListFilesSorted: %v\n", err)
+		log.Printf("[WARN] can't scan the files: %v", err)
 		return
 	}
 
 	s.JobQueue.Clear()
-	for i, file := range files {
-		// fmt.Printf("  %s — %s\n", file.Name, file.ModTime.Format(time.RFC3339))
-		// jobId := uuid.New().String()
-		jobId := fmt.Sprintf("%s-%s", file.Name, file.ModTime.Format(time.RFC3339))
-
-		// TODO stars 10
-		stars := 10
-		if i%10 == 0 {
-			stars = 0
-		}
+	for i, album := range finder.Albums(files) {
+		file := album[0]
+		jobId := newJobID(file)
 
+		stars := s.Stars(i)
+		if file.Stars != nil {
+			stars = *file.Stars
+		}
 		s.JobQueue.AddJob(job.SendVideoJob{
 			BaseJob:        job.BaseJob{ID: jobId},
 			TelegramClient: s.TelegramClient,
 			File:           file,
 			Stars:          stars,
+			Caption:        file.Caption,
+			Destination:    file.Destination,
+			PublishAt:      file.PublishAt,
+			Album:          album[1:],
+			Fetch:          s.fetch,
+			Pipeline:       s.Pipeline,
+			OnSent:         s.sent,
 		})
 	}
 }
@@ -0,0 +1,83 @@
+package web
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/meesooqa/files2tg/app/finder"
+	"github.com/meesooqa/files2tg/app/job"
+)
+
+// readSSE reads the next "event:" and "data:" pair from the stream
+func readSSE(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func TestGetEventsCtrl(t *testing.T) {
+	jq := job.NewJobQueue()
+	jq.UpdateStatus("old", job.StatusDone)
+	s := &Server{JobQueue: jq}
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/events")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	r := bufio.NewReader(resp.Body)
+	event, data := readSSE(t, r)
+	assert.Equal(t, "snapshot", event)
+	assert.JSONEq(t, `{"old":"done"}`, data)
+
+	// the subscription is registered before the snapshot is written
+	jq.ReportProgress("new", 42)
+	event, data = readSSE(t, r)
+	assert.Equal(t, "progress", event)
+	assert.Contains(t, data, `"job_id":"new"`)
+	assert.Contains(t, data, `"progress":42`)
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body)
+}
+
+func TestNewJobID(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	local := finder.File{Name: "a.mp4", Path: "/videos/a.mp4", ModTime: modTime}
+	other := finder.File{Name: "a.mp4", Path: "/other/a.mp4", ModTime: modTime}
+	remote := finder.File{Name: "a.mp4", Path: "/work/nas/a.mp4", ModTime: modTime, Remote: &finder.RemoteFile{Source: "nas", Path: "a.mp4"}}
+
+	assert.Equal(t, newJobID(local), newJobID(local))
+	assert.True(t, strings.HasPrefix(newJobID(local), "a.mp4-2024-05-01T10:00:00Z-"))
+	assert.NotEqual(t, newJobID(local), newJobID(other), "the same name and time in another directory")
+	pending := remote
+	pending.Remote = &finder.RemoteFile{Source: "nas", Path: "a.mp4", Pending: true}
+	assert.Equal(t, newJobID(remote), newJobID(pending), "the remote file is known by its origin")
+	assert.NotEqual(t, newJobID(local), newJobID(remote))
+}
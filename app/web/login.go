@@ -0,0 +1,70 @@
+package web
+
+import (
+	"log"
+	"net/http"
+)
+
+// loginPageData is passed to the login template
+type loginPageData struct {
+	CSRFToken string
+	Error     string
+	// TelegramBotName enables the Telegram Login Widget
+	TelegramBotName string
+}
+
+func (s *Server) renderLoginPage(w http.ResponseWriter, r *http.Request, status int, errMessage string) {
+	data := loginPageData{
+		CSRFToken: s.Auth.CSRF.Token(w, r),
+		Error:     errMessage,
+	}
+	if s.Auth.Telegram != nil {
+		data.TelegramBotName = s.Auth.Opts.TelegramBotName
+	}
+	w.WriteHeader(status)
+	s.templates.ExecuteTemplate(w, "login.html", data)
+}
+
+func (s *Server) getLoginPageCtrl(w http.ResponseWriter, r *http.Request) {
+	s.renderLoginPage(w, r, http.StatusOK, "")
+}
+
+func (s *Server) postLoginCtrl(w http.ResponseWriter, r *http.Request) {
+	if !s.Auth.CSRF.Valid(r) {
+		s.renderLoginPage(w, r, http.StatusForbidden, "The form has expired, please try again")
+		return
+	}
+	user := r.PostFormValue("username")
+	if !s.Auth.Opts.Users.Check(user, r.PostFormValue("password")) {
+		log.Printf("[WARN] failed login of %q from %s", user, r.RemoteAddr)
+		s.renderLoginPage(w, r, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+	s.Auth.Sessions.Start(w, r, user)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// getTelegramLoginCtrl is the auth URL of the Telegram Login Widget
+func (s *Server) getTelegramLoginCtrl(w http.ResponseWriter, r *http.Request) {
+	if s.Auth.Telegram == nil {
+		http.NotFound(w, r)
+		return
+	}
+	user, err := s.Auth.Telegram.Verify(r.URL.Query())
+	if err != nil {
+		log.Printf("[WARN] failed telegram login from %s: %v", r.RemoteAddr, err)
+		s.renderLoginPage(w, r, http.StatusUnauthorized, "Telegram login failed")
+		return
+	}
+	s.Auth.Sessions.Start(w, r, user)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) postLogoutCtrl(w http.ResponseWriter, r *http.Request) {
+	if !s.Auth.CSRF.Valid(r) {
+		http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+		return
+	}
+	s.Auth.Sessions.End(w, r)
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/web/auth"
+)
+
+func TestLogin(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	a, err := auth.New(auth.Options{
+		Users:         auth.Users{"admin": string(hash)},
+		Mode:          auth.ModeSession,
+		SessionSecret: strings.Repeat("s", 32),
+	})
+	require.NoError(t, err)
+	s := &Server{JobQueue: job.NewJobQueue(), Auth: a}
+	s.templates, err = s.parseTemplates()
+	require.NoError(t, err)
+	ts := httptest.NewServer(s.router())
+	defer ts.Close()
+
+	jar, err := cookiejar.New(nil)
+	require.NoError(t, err)
+	client := &http.Client{Jar: jar}
+
+	// not signed in users are redirected to the login page
+	resp, err := client.Get(ts.URL + "/")
+	require.NoError(t, err)
+	body := readBody(t, resp)
+	assert.Equal(t, ts.URL+"/login", resp.Request.URL.String())
+	token := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindStringSubmatch(body)
+	require.Len(t, token, 2)
+
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"wrong"}, "csrf_token": {token[1]}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, readBody(t, resp), "Invalid username or password")
+
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"secret"}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "csrf token is required")
+	readBody(t, resp)
+
+	resp, err = client.PostForm(ts.URL+"/login", url.Values{"username": {"admin"}, "password": {"secret"}, "csrf_token": {token[1]}})
+	require.NoError(t, err)
+	body = readBody(t, resp)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ts.URL+"/", resp.Request.URL.String())
+	assert.Contains(t, body, "Task List")
+	assert.Contains(t, body, "admin")
+
+	resp, err = client.PostForm(ts.URL+"/logout", url.Values{"csrf_token": {token[1]}})
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, ts.URL+"/login", resp.Request.URL.String())
+
+	resp, err = client.Get(ts.URL + "/api/v1/jobs")
+	require.NoError(t, err)
+	readBody(t, resp)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
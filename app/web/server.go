@@ -2,60 +2,174 @@ package web
 
 import (
 	"context"
-	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/meesooqa/files2tg/app/finder"
 	"github.com/meesooqa/files2tg/app/job"
+	"github.com/meesooqa/files2tg/app/process"
 	"github.com/meesooqa/files2tg/app/send"
+	"github.com/meesooqa/files2tg/app/web/auth"
 )
 
 type Server struct {
-	TemplLocationPattern string
-	TemplStaticLocation  string
-	JobQueue             job.JobQueuer
-	TelegramClient       send.Client
+	// AssetsDir overrides the embedded templates and static files with a directory on disk,
+	// e.g. "app/web" to edit them without rebuilding
+	AssetsDir      string
+	JobQueue       job.JobQueuer
+	TelegramClient send.Client
+	// FilesDirs are the directories with the files to send, see config.Config.SourceDirs
+	FilesDirs []string
+	// Manifests list the files to send in their order, see finder.ReadManifest
+	Manifests []string
+	// Remotes are the remote sources, their files are downloaded by the jobs
+	Remotes []*finder.Remote
+	// Archives are the archives, their files are extracted by the jobs and their albums are sent as one post
+	Archives []*finder.Archives
+	// Deduplicator finds the copies of the same video in a scan, nil disables the search
+	Deduplicator *finder.Deduplicator
+	// SimilarFinder flags the near-duplicates in a scan, nil disables the fingerprints
+	SimilarFinder *finder.SimilarFinder
+	// History records the sent files, nil disables it
+	History *finder.History
+	// Pipeline processes the files in the jobs before they are sent, nil sends them as they are
+	Pipeline *process.Pipeline
+	// Stars returns the price of i-th video sent with Run, 10 stars with every 10th video free by NewServer
+	Stars func(i int) int
+	// VideoInfoProvider probes the scanned and fetched files, ffprobe falling back to the MP4 parser by NewServer
+	VideoInfoProvider finder.VIProvider
+	// ScanWorkers is the number of files probed at once, the default of finder.NewProvider if 0
+	ScanWorkers int
+	// Sorters order the files of FilesDirs, by modification time if a directory has none
+	Sorters map[string]finder.Sorter
+	// Thumbnailer makes the thumbnails of GET /api/v1/files/thumbnail, ffmpeg by NewServer
+	Thumbnailer finder.Thumbnailer
+	// Auth protects the control panel, no authentication if nil
+	Auth *auth.Auth
 
 	httpServer *http.Server
 	templates  *template.Template
+
+	// report of the latest scan, nil before the first one
+	reportMu sync.Mutex
+	report   *finder.ScanReport
+}
+
+// NewServer returns the server of the job queue sending the files with the client,
+// Stars, VideoInfoProvider and Thumbnailer are set to their defaults
+func NewServer(jobQueue job.JobQueuer, client send.Client) *Server {
+	return &Server{
+		JobQueue:          jobQueue,
+		TelegramClient:    client,
+		Stars:             defaultStars,
+		VideoInfoProvider: finder.NewChainProvider(finder.NewVideoInfoProvider(), finder.NewMP4InfoProvider()),
+		Thumbnailer:       finder.NewFFmpegThumbnailer(),
+	}
 }
 
-func (s *Server) Run(ctx context.Context, port int) {
-	log.Printf("[INFO] starting server on port %d", port)
+func (s *Server) Run(ctx context.Context, addr string) {
+	log.Printf("[INFO] starting server on %s", addr)
 
-	if s.TemplLocationPattern == "" {
-		s.TemplLocationPattern = "app/web/templates/*"
+	if s.AssetsDir != "" {
+		log.Printf("[DEBUG] loading templates and static files from %s", s.AssetsDir)
+	}
+	handler, err := s.Handler()
+	if err != nil {
+		log.Fatalf("[ERROR] can't parse templates, %v", err)
 	}
-	log.Printf("[DEBUG] loading templates from %s", s.TemplLocationPattern)
-	s.templates = template.Must(template.ParseGlob(s.TemplLocationPattern))
 
 	s.httpServer = &http.Server{
-		Addr:              fmt.Sprintf(":%d", port),
-		Handler:           s.router(),
+		Addr:              addr,
+		Handler:           handler,
 		ReadHeaderTimeout: 5 * time.Second,
 		WriteTimeout:      10 * time.Second, // HTTPResponseTimeout
 		IdleTimeout:       60 * time.Second,
 	}
 
-	err := s.httpServer.ListenAndServe()
+	err = s.httpServer.ListenAndServe()
 	log.Printf("[WARN] http server terminated, %s", err)
 }
 
+// Handler returns the handler of the control panel and the API served by Run
+func (s *Server) Handler() (http.Handler, error) {
+	templates, err := s.parseTemplates()
+	if err != nil {
+		return nil, err
+	}
+	s.templates = templates
+	return s.router(), nil
+}
+
+// defaultStars makes every 10th video free and the others cost 10 stars
+func defaultStars(i int) int {
+	if i%10 == 0 {
+		return 0
+	}
+	return 10
+}
+
+func (s *Server) parseTemplates() (*template.Template, error) {
+	return template.ParseFS(s.assets(), "templates/*")
+}
+
 func (s *Server) router() http.Handler {
 	mux := http.NewServeMux()
 
 	// Static
-	if s.TemplStaticLocation == "" {
-		s.TemplStaticLocation = "app/web/static"
-	}
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(s.TemplStaticLocation))))
+	// fs.Sub fails on an invalid path only
+	static, _ := fs.Sub(s.assets(), "static")
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
 
 	// Route
-	mux.HandleFunc("/", s.getIndexPageCtrl)
-	mux.HandleFunc("/status", s.getStatusPageCtrl)
-	mux.HandleFunc("/send", s.send)
+	mux.Handle("/", s.ui(s.getIndexPageCtrl))
+	mux.Handle("/files", s.ui(s.getFilesPageCtrl))
+	mux.Handle("/status", s.ui(s.getStatusPageCtrl))
+	mux.Handle("/events", s.ui(s.getEventsCtrl))
+	mux.Handle("/send", s.ui(s.send))
+	mux.Handle("GET /dry-run", s.ui(s.getDryRunPageCtrl))
+
+	// Login
+	if s.Auth != nil && s.Auth.Sessions != nil {
+		mux.HandleFunc("GET /login", s.getLoginPageCtrl)
+		mux.HandleFunc("POST /login", s.postLoginCtrl)
+		mux.HandleFunc("GET /login/telegram", s.getTelegramLoginCtrl)
+		mux.HandleFunc("POST /logout", s.postLogoutCtrl)
+	}
+
+	// API
+	mux.Handle("GET /api/v1/openapi.yaml", s.api(s.getOpenAPICtrl))
+	mux.Handle("GET /api/v1/files", s.api(s.getFilesCtrl))
+	mux.Handle("GET /api/v1/files/thumbnail", s.api(s.getThumbnailCtrl))
+	mux.Handle("GET /api/v1/files/skipped", s.api(s.getSkippedCtrl))
+	mux.Handle("GET /api/v1/files/duplicates", s.api(s.getDuplicatesCtrl))
+	mux.Handle("GET /api/v1/files/similar", s.api(s.getSimilarCtrl))
+	mux.Handle("GET /api/v1/jobs", s.api(s.getJobsCtrl))
+	mux.Handle("POST /api/v1/jobs", s.api(s.postJobsCtrl))
+	mux.Handle("GET /api/v1/jobs/{id}", s.api(s.getJobCtrl))
+	mux.Handle("DELETE /api/v1/jobs/{id}", s.api(s.deleteJobCtrl))
+	mux.Handle("POST /api/v1/jobs/{id}/retry", s.api(s.retryJobCtrl))
+	mux.Handle("GET /api/v1/previews", s.api(s.getPreviewsCtrl))
+	mux.Handle("/api/", s.api(s.apiNotFoundCtrl))
 
 	return mux
 }
+
+// ui protects a page of the control panel
+func (s *Server) ui(h http.HandlerFunc) http.Handler {
+	if s.Auth == nil {
+		return h
+	}
+	return s.Auth.UI(h)
+}
+
+// api protects an API endpoint
+func (s *Server) api(h http.HandlerFunc) http.Handler {
+	if s.Auth == nil {
+		return h
+	}
+	return s.Auth.API(h)
+}
@@ -0,0 +1,257 @@
+function formatDuration(seconds) {
+    let m = Math.floor(seconds / 60);
+    let s = String(seconds % 60).padStart(2, '0');
+    return `${m}:${s}`;
+}
+
+function formatSize(bytes) {
+    let units = ['B', 'KB', 'MB', 'GB'];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+        bytes /= 1024;
+        i++;
+    }
+    return `${bytes.toFixed(i ? 1 : 0)} ${units[i]}`;
+}
+
+function cell(content) {
+    let td = document.createElement('td');
+    if (content instanceof Node) {
+        td.appendChild(content);
+    } else {
+        td.textContent = content;
+    }
+    return td;
+}
+
+function input(type, className) {
+    let el = document.createElement('input');
+    el.type = type;
+    el.className = className;
+    return el;
+}
+
+let dragged = null;
+
+function makeDraggable(row) {
+    row.draggable = true;
+    row.addEventListener('dragstart', (e) => {
+        dragged = row;
+        row.classList.add('picker__row_dragged');
+        e.dataTransfer.effectAllowed = 'move';
+    });
+    row.addEventListener('dragend', () => {
+        row.classList.remove('picker__row_dragged');
+        dragged = null;
+    });
+    row.addEventListener('dragover', (e) => {
+        if (!dragged || dragged === row) {
+            return;
+        }
+        e.preventDefault();
+        let rect = row.getBoundingClientRect();
+        let after = e.clientY > rect.top + rect.height / 2;
+        row.parentNode.insertBefore(dragged, after ? row.nextSibling : row);
+    });
+}
+
+function fileRow(file) {
+    let row = document.createElement('tr');
+    row.dataset.path = file.path;
+
+    let handle = document.createElement('span');
+    handle.className = 'picker__handle';
+    handle.textContent = '☰';
+    handle.title = 'Drag to reorder';
+
+    let thumb = document.createElement('img');
+    thumb.className = 'picker__thumb';
+    thumb.loading = 'lazy';
+    thumb.alt = '';
+    thumb.src = '/api/v1/files/thumbnail?path=' + encodeURIComponent(file.path);
+
+    let caption = input('text', 'picker__caption');
+    caption.placeholder = 'Default caption';
+    caption.value = file.caption || '';
+    let stars = input('number', 'picker__stars');
+    stars.min = 0;
+    stars.value = file.stars || 0;
+
+    let info = file.info || {};
+    row.appendChild(cell(handle));
+    row.appendChild(cell(input('checkbox', 'picker__select')));
+    row.appendChild(cell(thumb));
+    row.appendChild(cell(file.name));
+    row.appendChild(cell(formatDuration(info.duration_seconds || 0)));
+    row.appendChild(cell(`${info.width}×${info.height}`));
+    row.appendChild(cell(formatSize(file.size)));
+    row.appendChild(cell(caption));
+    row.appendChild(cell(stars));
+    makeDraggable(row);
+    return row;
+}
+
+function selectedFiles() {
+    let files = [];
+    for (let row of document.getElementById('filesBody').rows) {
+        if (!row.querySelector('.picker__select').checked) {
+            continue;
+        }
+        files.push({
+            path: row.dataset.path,
+            caption: row.querySelector('.picker__caption').value.trim(),
+            stars: parseInt(row.querySelector('.picker__stars').value, 10) || 0,
+        });
+    }
+    return files;
+}
+
+function updateSendButton() {
+    document.getElementById('pickerSend').disabled = selectedFiles().length === 0;
+}
+
+function showMessage(text) {
+    document.getElementById('pickerMessage').textContent = text;
+}
+
+async function loadFiles() {
+    try {
+        let response = await fetch('/api/v1/files');
+        let data = await response.json();
+        if (!response.ok) {
+            showMessage(data.error.message);
+            return;
+        }
+        let tbody = document.getElementById('filesBody');
+        tbody.innerHTML = '';
+        for (let file of data) {
+            tbody.appendChild(fileRow(file));
+        }
+        if (data.length === 0) {
+            showMessage('No files found');
+        }
+    } catch (err) {
+        console.error('Error while getting files:', err);
+    }
+}
+
+function skippedRow(skipped) {
+    let row = document.createElement('tr');
+    row.appendChild(cell(skipped.path));
+    let reason = cell(skipped.reason);
+    if (skipped.stderr) {
+        let stderr = document.createElement('pre');
+        stderr.className = 'skipped__stderr';
+        stderr.textContent = skipped.stderr;
+        reason.appendChild(stderr);
+    }
+    row.appendChild(reason);
+    return row;
+}
+
+// loadSkipped shows the files skipped by the scan of loadFiles
+async function loadSkipped() {
+    try {
+        let response = await fetch('/api/v1/files/skipped');
+        if (!response.ok) {
+            return;
+        }
+        let data = await response.json();
+        let tbody = document.getElementById('skippedBody');
+        tbody.innerHTML = '';
+        for (let skipped of data) {
+            tbody.appendChild(skippedRow(skipped));
+        }
+        document.getElementById('skipped').hidden = data.length === 0;
+    } catch (err) {
+        console.error('Error while getting skipped files:', err);
+    }
+}
+
+function duplicatesRow(paths, match) {
+    let row = document.createElement('tr');
+    let td = document.createElement('td');
+    for (let path of paths) {
+        let line = document.createElement('div');
+        line.textContent = path;
+        td.appendChild(line);
+    }
+    row.appendChild(td);
+    row.appendChild(cell(match));
+    return row;
+}
+
+function similarMatch(similar) {
+    let match = Math.round(similar.similarity * 100) + '% similar';
+    if (similar.sent_at) {
+        match += ', sent ' + new Date(similar.sent_at).toLocaleString();
+    }
+    return match;
+}
+
+async function fetchList(url) {
+    let response = await fetch(url);
+    return response.ok ? response.json() : [];
+}
+
+// loadDuplicates shows the copies and the near-duplicates found by the scan of loadFiles
+async function loadDuplicates() {
+    try {
+        let [duplicates, similar] = await Promise.all([
+            fetchList('/api/v1/files/duplicates'),
+            fetchList('/api/v1/files/similar'),
+        ]);
+        let tbody = document.getElementById('duplicatesBody');
+        tbody.innerHTML = '';
+        for (let group of duplicates) {
+            tbody.appendChild(duplicatesRow(group.paths, group.hash));
+        }
+        for (let s of similar) {
+            tbody.appendChild(duplicatesRow([s.path, s.of], similarMatch(s)));
+        }
+        document.getElementById('duplicates').hidden = duplicates.length + similar.length === 0;
+    } catch (err) {
+        console.error('Error while getting duplicates:', err);
+    }
+}
+
+async function sendSelected(e) {
+    e.preventDefault();
+    let body = {
+        files: selectedFiles(),
+        clear: document.getElementById('pickerClear').checked,
+    };
+    try {
+        let response = await fetch('/api/v1/jobs', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': document.querySelector('meta[name="csrf-token"]').content,
+            },
+            body: JSON.stringify(body),
+        });
+        if (response.ok) {
+            window.location = '/';
+            return;
+        }
+        let data = await response.json();
+        showMessage(data.error.message);
+    } catch (err) {
+        console.error('Error while sending files:', err);
+    }
+}
+
+function init() {
+    let tbody = document.getElementById('filesBody');
+    tbody.addEventListener('change', updateSendButton);
+    document.getElementById('pickerAll').addEventListener('change', (e) => {
+        for (let checkbox of tbody.querySelectorAll('.picker__select')) {
+            checkbox.checked = e.target.checked;
+        }
+        updateSendButton();
+    });
+    document.getElementById('picker').addEventListener('submit', sendSelected);
+    loadFiles().then(loadSkipped).then(loadDuplicates);
+}
+
+window.onload = init;
@@ -1,32 +1,57 @@
-async function fetchStatuses() {
-    try {
-        let response = await fetch('/status');
-        if (response.ok) {
-            let data = await response.json();
-            updateTable(data);
-        } else {
-        }
-    } catch (err) {
-        console.error('Error while getting statuses:', err);
-    }
-}
+const rows = new Map();
 
-function updateTable(data) {
+function render(data) {
     let tbody = document.getElementById('jobsBody');
     tbody.innerHTML = '';
+    rows.clear();
     for (let id in data) {
-        let row = document.createElement('tr');
+        updateRow(id, data[id]);
+    }
+}
+
+function updateRow(id, status) {
+    let row = rows.get(id);
+    if (!row) {
+        row = document.createElement('tr');
         let cellID = document.createElement('td');
         let cellStatus = document.createElement('td');
-
         cellID.textContent = id;
-        cellStatus.textContent = data[id];
-
         row.appendChild(cellID);
         row.appendChild(cellStatus);
-        tbody.appendChild(row);
+        document.getElementById('jobsBody').appendChild(row);
+        rows.set(id, row);
+    }
+    row.cells[1].textContent = status;
+}
+
+function removeRow(id) {
+    let row = rows.get(id);
+    if (row) {
+        row.remove();
+        rows.delete(id);
+    }
+}
+
+function subscribe() {
+    let source = new EventSource('/events');
+
+    source.addEventListener('snapshot', (e) => render(JSON.parse(e.data)));
+    source.addEventListener('cleared', () => render({}));
+    source.addEventListener('removed', (e) => removeRow(JSON.parse(e.data).job_id));
+    for (let type of ['enqueued', 'scheduled', 'started', 'done', 'failed', 'canceled']) {
+        source.addEventListener(type, (e) => {
+            let event = JSON.parse(e.data);
+            updateRow(event.job_id, event.status);
+        });
     }
+    source.addEventListener('progress', (e) => {
+        let event = JSON.parse(e.data);
+        updateRow(event.job_id, `${event.status} ${event.progress}%`);
+    });
+    source.onerror = (err) => {
+        // EventSource reconnects by itself and receives a fresh snapshot
+        console.error('Error while streaming statuses:', err);
+    };
 }
 
-setInterval(fetchStatuses, 3000);
-window.onload = fetchStatuses;
+window.onload = subscribe;
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	telegramTagRe  = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)([^<>]*)>`)
+	telegramHrefRe = regexp.MustCompile(`(?i)href\s*=\s*"([^"]*)"`)
+	// telegramTags are the tags supported by Telegram in the HTML parse mode
+	telegramTags = map[string]bool{
+		"b": true, "strong": true, "i": true, "em": true, "u": true, "ins": true,
+		"s": true, "strike": true, "del": true, "span": true, "tg-spoiler": true,
+		"a": true, "code": true, "pre": true, "blockquote": true,
+	}
+)
+
+// telegramHTML renders the caption in the HTML parse mode safely:
+// the tags supported by Telegram are kept without attributes except a link, everything else is escaped
+func telegramHTML(caption string) template.HTML {
+	var b strings.Builder
+	text := func(s string) {
+		b.WriteString(template.HTMLEscapeString(html.UnescapeString(s)))
+	}
+
+	last := 0
+	for _, m := range telegramTagRe.FindAllStringSubmatchIndex(caption, -1) {
+		text(caption[last:m[0]])
+		last = m[1]
+
+		closing := m[3] > m[2]
+		name := strings.ToLower(caption[m[4]:m[5]])
+		if !telegramTags[name] {
+			text(caption[m[0]:m[1]])
+			continue
+		}
+		switch {
+		case closing:
+			b.WriteString("</" + name + ">")
+		case name == "a":
+			b.WriteString("<a")
+			if href := telegramHrefRe.FindStringSubmatch(caption[m[6]:m[7]]); href != nil {
+				if u, err := url.Parse(html.UnescapeString(href[1])); err == nil && (u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "tg") {
+					b.WriteString(` href="` + template.HTMLEscapeString(u.String()) + `" rel="noopener noreferrer"`)
+				}
+			}
+			b.WriteString(">")
+		default:
+			b.WriteString("<" + name + ">")
+		}
+	}
+	text(caption[last:])
+	return template.HTML(b.String())
+}
@@ -0,0 +1,26 @@
+package web
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTelegramHTML(t *testing.T) {
+	tests := []struct {
+		caption string
+		want    template.HTML
+	}{
+		{"plain &amp; simple", "plain &amp; simple"},
+		{"<b>bold</b> <I>italic</I>", "<b>bold</b> <i>italic</i>"},
+		{`<b onclick="alert(1)">x</b>`, "<b>x</b>"},
+		{`<script>alert(1)</script>`, "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{`<a href="https://t.me/x?a=1&amp;b=2">link</a>`, `<a href="https://t.me/x?a=1&amp;b=2" rel="noopener noreferrer">link</a>`},
+		{`<a href="javascript:alert(1)">link</a>`, "<a>link</a>"},
+		{`<img src=x onerror="alert(1)">`, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, telegramHTML(tt.caption), tt.caption)
+	}
+}
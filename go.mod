@@ -4,14 +4,31 @@ go 1.24.1
 
 require (
 	github.com/joho/godotenv v1.5.1
+	github.com/minio/minio-go/v7 v7.0.90
 	github.com/pkg/errors v0.9.1
+	github.com/pkg/sftp v1.13.9
 	github.com/stretchr/testify v1.10.0
+	github.com/studio-b12/gowebdav v0.10.0
+	golang.org/x/crypto v0.39.0
+	golang.org/x/net v0.38.0
 	gopkg.in/telebot.v4 v4.0.0-beta.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/dustin/go-humanize v1.0.1 // indirect
+	github.com/go-ini/ini v1.67.0 // indirect
+	github.com/goccy/go-json v0.10.5 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/klauspost/compress v1.18.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.2.10 // indirect
+	github.com/kr/fs v0.1.0 // indirect
+	github.com/minio/crc64nvme v1.0.1 // indirect
+	github.com/minio/md5-simd v1.1.2 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/rs/xid v1.6.0 // indirect
 	github.com/stretchr/objx v0.5.2 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	golang.org/x/text v0.26.0 // indirect
 )